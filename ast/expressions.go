@@ -136,3 +136,22 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 func (ie *IndexExpression) GetPosition() token.Position { return ie.Token.Position }
+
+type FieldAccessExpression struct {
+	Token token.Token // The . token
+	Left  Expression
+	Field *Identifier
+}
+
+func (fa *FieldAccessExpression) expressionNode()      {}
+func (fa *FieldAccessExpression) TokenLiteral() string { return fa.Token.Literal }
+func (fa *FieldAccessExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(fa.Left.String())
+	out.WriteString(".")
+	out.WriteString(fa.Field.String())
+	out.WriteString(")")
+	return out.String()
+}
+func (fa *FieldAccessExpression) GetPosition() token.Position { return fa.Token.Position }
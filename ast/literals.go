@@ -41,6 +41,7 @@ type FunctionLiteral struct {
 	Parameters []*FunctionParameter
 	Body       *BlockStatement
 	ReturnType *Identifier
+	Name       string // the name it is bound to, if any
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -123,3 +124,35 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 func (hl *HashLiteral) GetPosition() token.Position { return hl.Token.Position }
+
+type StructLiteral struct {
+	Token token.Token // the first token of the struct name
+	// the module exporting the struct, nil for structs declared in the same file
+	Module *Identifier
+	Name   *Identifier
+	Fields []*StructFieldValue
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) String() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for _, f := range sl.Fields {
+		fields = append(fields, f.Name.String()+": "+f.Value.String())
+	}
+	if sl.Module != nil {
+		out.WriteString(sl.Module.String() + ".")
+	}
+	out.WriteString(sl.Name.String())
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+func (sl *StructLiteral) GetPosition() token.Position { return sl.Token.Position }
+
+type StructFieldValue struct {
+	Name  *Identifier
+	Value Expression
+}
@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"kol/token"
+	"strings"
 )
 
 type Statement interface {
@@ -36,9 +37,10 @@ func (ls *LetStatement) String() string {
 func (ls *LetStatement) GetPosition() token.Position { return ls.Token.Position }
 
 type ReassignStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token
+	Name     *Identifier
+	Operator string // = or a compound assignment like +=, whose operation is part of Value
+	Value    Expression
 }
 
 func (rs *ReassignStatement) statementNode()       {}
@@ -91,6 +93,15 @@ func (bs *BreakStatement) String() string {
 }
 func (bs *BreakStatement) GetPosition() token.Position { return bs.Token.Position }
 
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()              {}
+func (cs *ContinueStatement) TokenLiteral() string        { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string              { return cs.TokenLiteral() + ";" }
+func (cs *ContinueStatement) GetPosition() token.Position { return cs.Token.Position }
+
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
 	Expression Expression
@@ -109,6 +120,7 @@ func (es *ExpressionStatement) GetPosition() token.Position { return es.Token.Po
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Token // the } token
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -121,3 +133,74 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 func (bs *BlockStatement) GetPosition() token.Position { return bs.Token.Position }
+
+type StructStatement struct {
+	Token  token.Token // The 'struct' token
+	Name   *Identifier
+	Fields []*StructField
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+	out.WriteString(ss.TokenLiteral() + " ")
+	out.WriteString(ss.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
+func (ss *StructStatement) GetPosition() token.Position { return ss.Token.Position }
+
+type StructField struct {
+	Token token.Token
+	Ident Identifier
+	Type  Identifier
+}
+
+func (sf *StructField) TokenLiteral() string { return sf.Token.Literal }
+func (sf *StructField) String() string {
+	return sf.Ident.String() + " " + sf.Type.Value
+}
+func (sf *StructField) GetPosition() token.Position { return sf.Token.Position }
+
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+	Name  *Identifier // the name the module is bound to
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " \"" + is.Path + "\";"
+}
+func (is *ImportStatement) GetPosition() token.Position { return is.Token.Position }
+
+type ExportStatement struct {
+	Token     token.Token
+	Statement Statement // a let or struct statement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+func (es *ExportStatement) GetPosition() token.Position { return es.Token.Position }
+
+// ExportedName returns the name the exported statement declares
+func (es *ExportStatement) ExportedName() string {
+	switch stmt := es.Statement.(type) {
+	case *LetStatement:
+		return stmt.Name.Value
+	case *StructStatement:
+		return stmt.Name.Value
+	}
+	return ""
+}
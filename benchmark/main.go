@@ -1,18 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"kol/compiler"
-	"kol/evaluator"
-	"kol/lexer"
-	"kol/object"
-	"kol/parser"
-	"kol/vm"
+	"kol/engine"
 	"time"
 )
 
-var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var engineName = flag.String("engine", "vm", "use 'vm' or 'eval'")
 var input = `
 let fibonacci = fun(x int) int {
 if (x == 0) {
@@ -30,36 +26,21 @@ fibonacci(35);
 
 func main() {
 	flag.Parse()
-	var duration time.Duration
-	var result object.Object
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	if *engine == "vm" {
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Printf("compiler error: %s", err)
-			return
-		}
-		machine := vm.New(comp.Bytecode())
-		start := time.Now()
-		err = machine.Run()
-		if err != nil {
-			fmt.Printf("vm error: %s", err)
-			return
-		}
-		duration = time.Since(start)
-		result = machine.LastPoppedStackElem()
-	} else {
-		env := object.NewEnvironment()
-		start := time.Now()
-		result = evaluator.Eval(program, env)
-		duration = time.Since(start)
+	e, err := engine.New(*engineName, engine.Options{})
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
+	start := time.Now()
+	result, err := e.Run(context.Background(), "benchmark.kol", input)
+	if err != nil {
+		fmt.Printf("%s error: %s", *engineName, err)
+		return
+	}
+	duration := time.Since(start)
 	fmt.Printf(
 		"engine=%s, result=%s, duration=%s\n",
-		*engine,
+		*engineName,
 		result.Inspect(),
 		duration)
 }
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"kol/compiler"
+	"kol/diagnostic"
+	"kol/vm"
+	"os"
+)
+
+func BuildBytecode(input string, fileName string, output string) bool {
+	program, ok := parse(input, fileName)
+	if !ok || !checkTypes(program, input, fileName) {
+		return false
+	}
+
+	comp := compiler.New()
+	comp.SetFileName(fileName)
+	err := comp.Compile(program)
+	if err != nil {
+		printDiagnostics(diagnostic.FromError(err, diagnostic.CompileError), input, fileName)
+		return false
+	}
+
+	var buf bytes.Buffer
+	err = comp.Bytecode().Encode(&buf)
+	if err != nil {
+		fmt.Fprintf(errOut, "Woops! Writing bytecode failed:\n %s\n", err)
+		return false
+	}
+	err = os.WriteFile(output, buf.Bytes(), 0644)
+	if err != nil {
+		fmt.Fprintf(errOut, "Woops! Writing bytecode failed:\n %s\n", err)
+		return false
+	}
+	return true
+}
+func RunBytecode(data []byte) bool {
+	bytecode, err := compiler.Decode(bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(errOut, "Woops! Loading bytecode failed:\n %s\n", err)
+		return false
+	}
+	machine := vm.New(bytecode)
+	err = machine.Run()
+	if err != nil {
+		// the sources of a compiled program are read from the files in its source maps
+		printDiagnostics(diagnostic.FromError(err, diagnostic.RuntimeError), "", "")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"kol/ast"
+	"kol/lexer"
+	"kol/parser"
+	"kol/typecheck"
+)
+
+// Check parses and type checks a program without running it
+func Check(input string, fileName string) bool {
+	program, ok := parse(input, fileName)
+	if !ok {
+		return false
+	}
+	if !checkTypes(program, input, fileName) {
+		return false
+	}
+	if diagnosticFormat == "json" {
+		printDiagnostics(nil, input, fileName)
+	}
+	return true
+}
+
+// parse parses a file and prints its syntax errors
+func parse(input string, fileName string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printDiagnostics(p.Diagnostics(), input, fileName)
+		return nil, false
+	}
+	return program, true
+}
+func checkTypes(program *ast.Program, input string, fileName string) bool {
+	errors := typecheck.Check(program)
+	if len(errors) == 0 {
+		return true
+	}
+	printDiagnostics(errors, input, fileName)
+	return false
+}
@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"fmt"
+	"kol/dap"
+)
+
+// StartDebugAdapter speaks the Debug Adapter Protocol over stdin and stdout until the editor disconnects
+func StartDebugAdapter() bool {
+	err := dap.NewServer(in, out).Run()
+	if err != nil {
+		// stdout carries the protocol, so errors go to stderr
+		fmt.Fprintf(errOut, "Woops! The debug adapter stopped:\n %s\n", err)
+		return false
+	}
+	return true
+}
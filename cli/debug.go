@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"kol/compiler"
+	"kol/debugger"
+	"kol/diagnostic"
+	"kol/object"
+	"kol/vm"
+)
+
+// Debug compiles a program and runs it in the step debugger, which reads its commands from stdin
+func Debug(input string, fileName string) bool {
+	program, ok := parse(input, fileName)
+	if !ok || !checkTypes(program, input, fileName) {
+		return false
+	}
+
+	// the symbol table is kept to show the globals by name
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	comp.SetFileName(fileName)
+	err := comp.Compile(program)
+	if err != nil {
+		printDiagnostics(diagnostic.FromError(err, diagnostic.CompileError), input, fileName)
+		return false
+	}
+
+	machine := vm.New(comp.Bytecode())
+	d := debugger.New(in, out, fileName, input, symbolTable.Definitions())
+	machine.SetHook(d.Hook)
+	err = machine.Run()
+	if err != nil && err != vm.ErrStopped {
+		printDiagnostics(diagnostic.FromError(err, diagnostic.RuntimeError), input, fileName)
+		return false
+	}
+	return true
+}
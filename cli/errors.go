@@ -1,9 +1,44 @@
 package cli
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"kol/diagnostic"
+	"os"
+)
 
-func printParserErrors(errors []string) {
-	for _, msg := range errors {
-		fmt.Println("\t" + msg + "\n")
+// diagnosticFormat selects how the errors of a file are printed, as rendered text or as JSON
+var diagnosticFormat = "text"
+
+func SetDiagnosticFormat(format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q, expected text or json", format)
+	}
+	diagnosticFormat = format
+	return nil
+}
+
+// printDiagnostics prints the diagnostics found in the file fileName with the content input to stderr.
+// Diagnostics in other files show the source read from disk.
+func printDiagnostics(diagnostics []*diagnostic.Diagnostic, input string, fileName string) {
+	writeDiagnostics(errOut, diagnostics, input, fileName)
+}
+func writeDiagnostics(w io.Writer, diagnostics []*diagnostic.Diagnostic, input string, fileName string) {
+	for _, d := range diagnostics {
+		if d.Span.File == "" {
+			d.Span.File = fileName
+		}
+	}
+	if diagnosticFormat == "json" {
+		diagnostic.WriteJSON(w, diagnostics)
+		return
+	}
+	for _, d := range diagnostics {
+		source := input
+		if d.Span.File != fileName {
+			content, _ := os.ReadFile(d.Span.File)
+			source = string(content)
+		}
+		fmt.Fprintln(w, d.Render(source))
 	}
 }
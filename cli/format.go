@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"kol/format"
+	"os"
+)
+
+// Format reformats the given files in place. With check set the files are left alone and
+// the ones that aren't formatted are listed instead, which makes it return false.
+// Without files the program is read from stdin and the formatted program written to stdout.
+// Errors go to stderr so they never end up in the formatted program.
+func Format(fileNames []string, check bool) bool {
+	if len(fileNames) == 0 {
+		input, err := io.ReadAll(in)
+		if err != nil {
+			fmt.Fprintf(errOut, "Woops! Reading stdin failed:\n %s\n", err)
+			return false
+		}
+		formatted, ok := formatSource(string(input), "<stdin>")
+		if !ok {
+			return false
+		}
+		if check {
+			return formatted == string(input)
+		}
+		io.WriteString(out, formatted)
+		return true
+	}
+
+	ok := true
+	for _, fileName := range fileNames {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintf(errOut, "Encountered Error: %s\n", err)
+			ok = false
+			continue
+		}
+		formatted, formattable := formatSource(string(content), fileName)
+		switch {
+		case !formattable:
+			ok = false
+		case formatted == string(content):
+		case check:
+			fmt.Fprintln(out, fileName)
+			ok = false
+		default:
+			err = os.WriteFile(fileName, []byte(formatted), 0644)
+			if err != nil {
+				fmt.Fprintf(errOut, "Woops! Writing %s failed:\n %s\n", fileName, err)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+func formatSource(input string, fileName string) (string, bool) {
+	formatted, diagnostics := format.Source(input)
+	if len(diagnostics) != 0 {
+		printDiagnostics(diagnostics, input, fileName)
+		return "", false
+	}
+	return formatted, true
+}
@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"fmt"
+	"kol/lsp"
+)
+
+// StartLanguageServer speaks the Language Server Protocol over stdin and stdout until the editor exits
+func StartLanguageServer() bool {
+	err := lsp.NewServer(in, out).Run()
+	if err != nil {
+		// stdout carries the protocol, so errors go to stderr
+		fmt.Fprintf(errOut, "Woops! The language server stopped:\n %s\n", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"kol/compiler"
+	"kol/diagnostic"
+	"kol/profile"
+	"kol/vm"
+	"os"
+	"time"
+)
+
+// Profile runs a program under the profiler and writes a profile for go tool pprof to output
+func Profile(input string, fileName string, output string, rate int) bool {
+	program, ok := parse(input, fileName)
+	if !ok || !checkTypes(program, input, fileName) {
+		return false
+	}
+
+	comp := compiler.New()
+	comp.SetFileName(fileName)
+	err := comp.Compile(program)
+	if err != nil {
+		printDiagnostics(diagnostic.FromError(err, diagnostic.CompileError), input, fileName)
+		return false
+	}
+
+	machine := vm.New(comp.Bytecode())
+	profiler := profile.New(time.Second / time.Duration(rate))
+	machine.SetHook(profiler.Hook)
+	profiler.Start()
+	err = machine.Run()
+	p := profiler.Stop()
+	if err != nil {
+		printDiagnostics(diagnostic.FromError(err, diagnostic.RuntimeError), input, fileName)
+		return false
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		fmt.Fprintf(errOut, "Woops! Writing the profile failed:\n %s\n", err)
+		return false
+	}
+	defer file.Close()
+	err = p.Write(file)
+	if err != nil {
+		fmt.Fprintf(errOut, "Woops! Writing the profile failed:\n %s\n", err)
+		return false
+	}
+	fmt.Fprintf(out, "Profile written to %s, open it with: go tool pprof -http=: %s\n", output, output)
+	return true
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"kol/diagnostic"
+	"kol/engine"
+	"kol/object"
+	"os"
+	"os/user"
+)
+
+const PROMPT = ">>"
+
+var in io.Reader = os.Stdin
+var out io.Writer = os.Stdout
+
+// errOut is where commands write diagnostics and errors, out is left to what programs print
+var errOut io.Writer = os.Stderr
+
+// Run runs a program on the engine and prints its errors
+func Run(e engine.Engine, input string, fileName string) bool {
+	_, err := e.Run(context.Background(), fileName, input)
+	if err != nil {
+		printDiagnostics(diagnostic.FromError(err, diagnostic.RuntimeError), input, fileName)
+		return false
+	}
+	return true
+}
+
+// StartRepl reads lines from stdin and evaluates them on the engine until stdin ends
+func StartRepl(e engine.Engine) {
+	user, err := user.Current()
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintf(out, "Hello %s! This is the Kol programming language!\n", user.Username)
+	fmt.Fprintf(out, "Feel free to type in commands\n")
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, PROMPT)
+		scanned := scanner.Scan()
+		if !scanned {
+			return
+		}
+		result, err := e.Eval(context.Background(), scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "Woops! %s\n", err)
+			continue
+		}
+		if result != nil && result.Type() != object.VOID_OBJ {
+			io.WriteString(out, result.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"kol/engine"
+	"kol/object"
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticsOnStderr(t *testing.T) {
+	defer func(stdout, stderr io.Writer) {
+		out, errOut = stdout, stderr
+		diagnosticFormat = "text"
+	}(out, errOut)
+
+	input := "let divisor = 0;\nprintln(\"%s\", \"before\");\nprintln(\"%s\", 10 % divisor);"
+	for _, name := range engine.Names {
+		for _, format := range []string{"text", "json"} {
+			var stdout, stderr strings.Builder
+			out, errOut = &stdout, &stderr
+			if err := SetDiagnosticFormat(format); err != nil {
+				t.Fatal(err)
+			}
+			e, err := engine.New(name, engine.Options{IO: &object.IO{In: strings.NewReader(""), Out: out, Err: errOut}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if Run(e, input, "main.kol") {
+				t.Fatalf("%s: expected the program to fail", name)
+			}
+			if stdout.String() != "before\n" {
+				t.Errorf("%s, %s: expected only the output of the program on stdout, got %q", name, format, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), "Can't take the remainder of a division by zero") {
+				t.Errorf("%s, %s: expected the error on stderr, got %q", name, format, stderr.String())
+			}
+			if format == "json" && !json.Valid([]byte(stderr.String())) {
+				t.Errorf("%s: expected JSON diagnostics on stderr, got %q", name, stderr.String())
+			}
+		}
+	}
+}
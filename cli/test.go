@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"kol/diagnostic"
+	"kol/testrunner"
+	"os"
+	"strings"
+	"time"
+)
+
+// Test runs the tests of the test files in path and prints the failed ones like go test, verbose
+// lists the passed ones too. It returns false if a test failed or a file couldn't be loaded.
+func Test(path string, options testrunner.Options, verbose bool) bool {
+	fileNames, err := testrunner.Files(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "Encountered Error: %s\n", err)
+		return false
+	}
+	if len(fileNames) == 0 {
+		fmt.Fprintf(out, "?   \t%s\t[no test files]\n", path)
+		return true
+	}
+	ok := true
+	for _, fileName := range fileNames {
+		start := time.Now()
+		results, err := testrunner.RunFile(context.Background(), fileName, options)
+		if err != nil {
+			content, _ := os.ReadFile(fileName)
+			printDiagnostics(diagnostic.FromError(err, diagnostic.RuntimeError), string(content), fileName)
+			fmt.Fprintf(out, "FAIL\t%s\t[load failed]\n", fileName)
+			ok = false
+			continue
+		}
+		passed := true
+		for _, result := range results {
+			if result.Passed() {
+				if verbose {
+					fmt.Fprintf(out, "--- PASS: %s (%.2fs)\n", result.Name, result.Duration.Seconds())
+				}
+				continue
+			}
+			passed = false
+			printFailure(result)
+		}
+		duration := time.Since(start).Seconds()
+		switch {
+		case !passed:
+			fmt.Fprintf(out, "FAIL\t%s\t%.2fs\n", fileName, duration)
+			ok = false
+		case len(results) == 0:
+			fmt.Fprintf(out, "ok  \t%s\t%.2fs [no tests to run]\n", fileName, duration)
+		default:
+			fmt.Fprintf(out, "ok  \t%s\t%.2fs\n", fileName, duration)
+		}
+	}
+	return ok
+}
+
+// printFailure prints where a test is and the errors it failed with, followed by what it printed
+func printFailure(result *testrunner.Result) {
+	fmt.Fprintf(out, "--- FAIL: %s (%s:%d:%d, %.2fs)\n", result.Name, result.File, result.Position.Line, result.Position.Column, result.Duration.Seconds())
+	for _, d := range result.Failure {
+		fmt.Fprintln(out, indent(d.Location()+": "+d.Message))
+		for _, note := range d.Notes {
+			fmt.Fprintln(out, indent("  "+note))
+		}
+	}
+	if result.Output != "" {
+		fmt.Fprintln(out, indent("output:"))
+		fmt.Fprintln(out, indent(indent(strings.TrimSuffix(result.Output, "\n"))))
+	}
+}
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(text, "\n", "\n    ")
+}
@@ -18,6 +18,7 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
 
 	OpTrue
 	OpFalse
@@ -27,12 +28,15 @@ const (
 	OpNotEqual
 	OpGreaterThan
 	OpGreaterEqualsThan
+	OpLessThan
+	OpLessEqualsThan
 
 	OpMinus
 	OpBang
 
 	OpJump
 	OpJumpNotTrue
+	OpAssertBoolean
 
 	OpGetGlobal
 	OpSetGlobal
@@ -40,16 +44,26 @@ const (
 	OpSetLocal
 	OpGetFree
 	OpSetFree
+	OpDefineGlobal
+	OpDefineLocal
 
 	OpArray
 	OpHash
 	OpIndex
+	OpStruct
+	OpGetField
+	OpModule
 
 	OpCall
+	OpTailCall
 	OpReturnValue
-	OpBreakValue
 	OpReturn
 	OpClosure
+	OpCaptureLocal
+	OpCaptureFree
+	OpCaptureGlobal
+	OpCloseUpvalues
+	OpCloseGlobalUpvalues
 
 	OpGetBuiltin
 )
@@ -57,49 +71,76 @@ const (
 type Definition struct {
 	Name          string
 	OperandWidths []int
+	// the instruction creates a new object or call frame
+	Allocates bool
 }
 
 var definitions = map[Opcode]*Definition{
-	OpConstant: {"OpConstant", []int{2}},
-	OpPop:      {"OpPop", []int{}},
-
-	OpAdd: {"OpAdd", []int{}},
-	OpSub: {"OpSub", []int{}},
-	OpMul: {"OpMul", []int{}},
-	OpDiv: {"OpDiv", []int{}},
-
-	OpTrue:  {"OpTrue", []int{}},
-	OpFalse: {"OpFalse", []int{}},
-	OpNull:  {"OpNull", []int{}},
-
-	OpEqual:             {"OpEqual", []int{}},
-	OpNotEqual:          {"OpNotEqual", []int{}},
-	OpGreaterThan:       {"OpGreaterThan", []int{}},
-	OpGreaterEqualsThan: {"OpGreaterEqualsThan", []int{}},
-	OpMinus:             {"OpMinus", []int{}},
-	OpBang:              {"OpBang", []int{}},
-
-	OpJump:        {"OpJump", []int{2}},
-	OpJumpNotTrue: {"OpJumpNotTrue", []int{2}},
-
-	OpGetGlobal: {"OpGetGlobal", []int{2}},
-	OpSetGlobal: {"OpSetGlobal", []int{2}},
-	OpGetLocal:  {"OpGetLocal", []int{1}},
-	OpSetLocal:  {"OpSetLocal", []int{1}},
-	OpGetFree:   {"OpGetFree", []int{1}},
-	OpSetFree:   {"OpSetFree", []int{1}},
-
-	OpArray: {"OpArray", []int{2}},
-	OpHash:  {"OpHash", []int{2}},
-	OpIndex: {"OpIndex", []int{}},
-
-	OpCall:        {"OpCall", []int{1}},
-	OpReturnValue: {"OpReturnValue", []int{}},
-	OpReturn:      {"OpReturn", []int{}},
-	OpBreakValue:  {"OpBreakValue", []int{}},
-	OpClosure:     {"OpClosure", []int{2, 1}},
-
-	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+	OpConstant: {"OpConstant", []int{2}, false},
+	OpPop:      {"OpPop", []int{}, false},
+
+	OpAdd: {"OpAdd", []int{}, true},
+	OpSub: {"OpSub", []int{}, true},
+	OpMul: {"OpMul", []int{}, true},
+	OpDiv: {"OpDiv", []int{}, true},
+	OpMod: {"OpMod", []int{}, true},
+
+	OpTrue:  {"OpTrue", []int{}, false},
+	OpFalse: {"OpFalse", []int{}, false},
+	OpNull:  {"OpNull", []int{}, false},
+
+	OpEqual:             {"OpEqual", []int{}, false},
+	OpNotEqual:          {"OpNotEqual", []int{}, false},
+	OpGreaterThan:       {"OpGreaterThan", []int{}, false},
+	OpGreaterEqualsThan: {"OpGreaterEqualsThan", []int{}, false},
+	OpLessThan:          {"OpLessThan", []int{}, false},
+	OpLessEqualsThan:    {"OpLessEqualsThan", []int{}, false},
+	OpMinus:             {"OpMinus", []int{}, true},
+	OpBang:              {"OpBang", []int{}, false},
+
+	OpJump:        {"OpJump", []int{2}, false},
+	OpJumpNotTrue: {"OpJumpNotTrue", []int{2}, false},
+
+	OpAssertBoolean: {"OpAssertBoolean", []int{}, false},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}, false},
+	OpSetGlobal: {"OpSetGlobal", []int{2}, false},
+	OpGetLocal:  {"OpGetLocal", []int{1}, false},
+	OpSetLocal:  {"OpSetLocal", []int{1}, false},
+	OpGetFree:   {"OpGetFree", []int{1}, false},
+	OpSetFree:   {"OpSetFree", []int{1}, false},
+	// set a variable a declaration creates, unlike a reassignment it may hold a value of another type
+	// left in its slot by the previous iteration of a loop
+	OpDefineGlobal: {"OpDefineGlobal", []int{2}, false},
+	OpDefineLocal:  {"OpDefineLocal", []int{1}, false},
+
+	OpArray: {"OpArray", []int{2}, true},
+	OpHash:  {"OpHash", []int{2}, true},
+	OpIndex: {"OpIndex", []int{}, false},
+
+	OpStruct:   {"OpStruct", []int{2}, true},
+	OpGetField: {"OpGetField", []int{2}, false},
+	OpModule:   {"OpModule", []int{2}, true},
+
+	OpCall:        {"OpCall", []int{1}, true},
+	OpReturnValue: {"OpReturnValue", []int{}, false},
+	OpReturn:      {"OpReturn", []int{}, false},
+	OpClosure:     {"OpClosure", []int{2, 1}, true},
+
+	// a call whose result is returned right away, it reuses the frame of the returning function
+	OpTailCall: {"OpTailCall", []int{1}, true},
+
+	// push the variable cell of a local or free variable for the next OpClosure
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}, true},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}, false},
+	// globals declared in the body of a top level loop are captured like locals, every iteration has its own
+	OpCaptureGlobal: {"OpCaptureGlobal", []int{2}, true},
+
+	// close the upvalues of the locals or globals from the operand on, which a loop iteration declared
+	OpCloseUpvalues:       {"OpCloseUpvalues", []int{1}, false},
+	OpCloseGlobalUpvalues: {"OpCloseGlobalUpvalues", []int{2}, false},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}, false},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -110,6 +151,12 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// Allocates reports whether an instruction creates a new object or call frame
+func Allocates(op Opcode) bool {
+	def, ok := definitions[op]
+	return ok && def.Allocates
+}
+
 func Make(op Opcode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
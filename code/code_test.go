@@ -77,3 +77,10 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+func TestAllocates(t *testing.T) {
+	for op, expected := range map[Opcode]bool{OpAdd: true, OpClosure: true, OpCall: true, OpTailCall: true, OpGetLocal: false, OpPop: false, Opcode(255): false} {
+		if Allocates(op) != expected {
+			t.Errorf("expected Allocates(%d) to be %t", op, expected)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package code
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// Fingerprint identifies the opcode set: it changes whenever an opcode is added, removed,
+// renumbered or gets different operands, so serialized bytecode can be checked before running it
+func Fingerprint() uint32 {
+	ops := make([]int, 0, len(definitions))
+	for op := range definitions {
+		ops = append(ops, int(op))
+	}
+	sort.Ints(ops)
+
+	h := fnv.New32a()
+	for _, op := range ops {
+		def := definitions[Opcode(op)]
+		h.Write([]byte{byte(op)})
+		h.Write([]byte(def.Name))
+		for _, w := range def.OperandWidths {
+			h.Write([]byte{byte(w)})
+		}
+	}
+	return h.Sum32()
+}
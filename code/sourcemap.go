@@ -0,0 +1,49 @@
+package code
+
+import (
+	"kol/token"
+	"sort"
+)
+
+// SourceMap maps instruction offsets back to the source position they were compiled from
+type SourceMap struct {
+	File    string
+	Entries []SourceMapEntry
+}
+type SourceMapEntry struct {
+	Offset   int
+	Position token.Position
+}
+
+func (sm *SourceMap) Add(offset int, pos token.Position) {
+	if len(sm.Entries) > 0 {
+		last := &sm.Entries[len(sm.Entries)-1]
+		if last.Offset == offset {
+			last.Position = pos
+			return
+		}
+		if last.Position == pos {
+			return
+		}
+	}
+	sm.Entries = append(sm.Entries, SourceMapEntry{Offset: offset, Position: pos})
+}
+
+// Truncate drops every entry at or after offset, used when instructions are removed again
+func (sm *SourceMap) Truncate(offset int) {
+	i := sort.Search(len(sm.Entries), func(i int) bool {
+		return sm.Entries[i].Offset >= offset
+	})
+	sm.Entries = sm.Entries[:i]
+}
+
+// Lookup returns the position of the instruction containing offset
+func (sm *SourceMap) Lookup(offset int) (token.Position, bool) {
+	i := sort.Search(len(sm.Entries), func(i int) bool {
+		return sm.Entries[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}, false
+	}
+	return sm.Entries[i-1].Position, true
+}
@@ -0,0 +1,48 @@
+package code
+
+import (
+	"kol/token"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	sm := SourceMap{}
+	sm.Add(0, token.Position{Line: 1, Column: 1})
+	sm.Add(3, token.Position{Line: 1, Column: 1})
+	sm.Add(4, token.Position{Line: 2, Column: 5})
+	sm.Add(7, token.Position{Line: 3, Column: 2})
+	sm.Add(7, token.Position{Line: 3, Column: 9})
+
+	if len(sm.Entries) != 3 {
+		t.Fatalf("wrong number of entries. want=3, got=%d", len(sm.Entries))
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, token.Position{Line: 1, Column: 1}},
+		{3, token.Position{Line: 1, Column: 1}},
+		{4, token.Position{Line: 2, Column: 5}},
+		{6, token.Position{Line: 2, Column: 5}},
+		{7, token.Position{Line: 3, Column: 9}},
+		{100, token.Position{Line: 3, Column: 9}},
+	}
+	for _, tt := range tests {
+		pos, ok := sm.Lookup(tt.offset)
+		if !ok {
+			t.Fatalf("no position for offset %d", tt.offset)
+		}
+		if pos != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%+v, got=%+v", tt.offset, tt.expected, pos)
+		}
+	}
+
+	sm.Truncate(4)
+	if pos, _ := sm.Lookup(7); pos != (token.Position{Line: 1, Column: 1}) {
+		t.Errorf("truncated entry still found. got=%+v", pos)
+	}
+	if _, ok := (&SourceMap{}).Lookup(0); ok {
+		t.Errorf("empty source map returned a position")
+	}
+}
@@ -1,9 +1,10 @@
 package compiler
 
 import (
-	"fmt"
 	"kol/ast"
 	"kol/code"
+	"kol/diagnostic"
+	"kol/module"
 	"kol/object"
 	"kol/token"
 	"sort"
@@ -14,11 +15,27 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+
+	fileName string
+	// the module being compiled, empty for the program itself
+	module string
+	// position of the node currently being compiled, recorded for every emitted instruction
+	position token.Position
+
+	loader *module.Loader
+	// the symbols the already compiled modules are stored in, by file name
+	modules map[string]Symbol
 }
 
 func New() *Compiler {
+	return NewWithBuiltins(object.Builtins)
+}
+
+// NewWithBuiltins creates a compiler for programs calling the given builtins, the VM running
+// the bytecode has to be given the same ones
+func NewWithBuiltins(builtins []object.BuiltinDefinition) *Compiler {
 	symbolTable := NewSymbolTable()
-	for i, v := range object.Builtins {
+	for i, v := range builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
 
@@ -32,6 +49,8 @@ func New() *Compiler {
 		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+		loader:      module.NewLoader(),
+		modules:     make(map[string]Symbol),
 	}
 }
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
@@ -41,7 +60,29 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// SetLoader sets the loader used to read imported modules
+func (c *Compiler) SetLoader(loader *module.Loader) {
+	c.loader = loader
+}
+
+// SetFileName sets the file name reported in the source maps of the compiled code
+func (c *Compiler) SetFileName(name string) {
+	c.fileName = name
+	c.scopes[c.scopeIndex].sourceMap.File = name
+}
+
+// SymbolTable returns the symbols of the main program, its globals are stored in the VM by their index
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil {
+		previous := c.position
+		c.position = node.GetPosition()
+		defer func() { c.position = previous }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -57,29 +98,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
-		}
-		if node.Operator == "<=" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterEqualsThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
 		}
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -99,16 +119,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
 		case ">":
 			c.emit(code.OpGreaterThan)
 		case ">=":
 			c.emit(code.OpGreaterEqualsThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessEqualsThan)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return createError("unknown operator %s", node.GetPosition(), node.Operator)
+			return c.createError("unknown operator %s", node.GetPosition(), node.Operator)
 		}
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
@@ -121,31 +147,31 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "-":
 			c.emit(code.OpMinus)
 		default:
-			return createError("unknown operator %s", node.GetPosition(), node.Operator)
+			return c.createError("unknown operator %s", node.GetPosition(), node.Operator)
 		}
 	case *ast.LetStatement:
 		if c.symbolTable.HasValue(node.Name.Value) {
-			return createError("Variable %s is already defined", node.GetPosition(), node.Name.Value)
+			return c.createError("Variable %s is already defined", node.GetPosition(), node.Name.Value)
 		}
-		symbol := c.symbolTable.Define(node.Name.Value, node.Mutable)
+		symbol := c.define(node.Name.Value, node.Mutable)
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 
 		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
+			c.emit(code.OpDefineGlobal, symbol.Index)
 		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+			c.emit(code.OpDefineLocal, symbol.Index)
 		}
 	case *ast.ReassignStatement:
 		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
 
 		if !ok {
-			return createError("Variable %s is not defined", node.GetPosition(), node.Name.Value)
+			return c.createError("Variable %s is not defined", node.GetPosition(), node.Name.Value)
 		}
 		if !symbol.Mutable {
-			return createError("Variable %s is not mutable", node.GetPosition(), node.Name.Value)
+			return c.createError("Variable %s is not mutable", node.GetPosition(), node.Name.Value)
 		}
 
 		err := c.Compile(node.Value)
@@ -163,7 +189,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return createError("undefined variable %s", node.GetPosition(), node.Value)
+			return c.createError("undefined variable %s", node.GetPosition(), node.Value)
 		}
 
 		c.loadSymbol(symbol)
@@ -175,14 +201,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpNotTruePos := c.emit(code.OpJumpNotTrue, 9999)
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBlockValue(node.Consequence)
 		if err != nil {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
 		jumpPos := c.emit(code.OpJump, 9999)
 		afterConsequencePos := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruePos, afterConsequencePos)
@@ -190,13 +213,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBlockValue(node.Alternative)
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
 		}
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
@@ -209,15 +229,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpNotTruePos := c.emit(code.OpJumpNotTrue, 9999)
 
+		// the body is run for its side effects only, so every value it produces is popped
+		c.enterLoop(beforeJumpPos)
 		err = c.Compile(node.Consequence)
 		if err != nil {
 			return err
 		}
+		loop := c.leaveLoop()
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
+		continuePos := len(c.currentInstructions())
+		if !c.closeIterationVariables(loop) {
+			continuePos = beforeJumpPos
+		}
+		for _, pos := range loop.continuePositions {
+			c.changeOperand(pos, continuePos)
 		}
-
 		c.emit(code.OpJump, beforeJumpPos)
 
 		afterConsequencePos := len(c.currentInstructions())
@@ -226,20 +252,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBlockValue(node.Alternative)
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
+		}
+
+		afterLoopPos := len(c.currentInstructions())
+		for _, pos := range loop.breakPositions {
+			c.changeOperand(pos, afterLoopPos)
+		}
+		// a break skips the end of the iteration
+		if len(loop.breakPositions) != 0 {
+			c.closeIterationVariables(loop)
 		}
 	case *ast.BlockStatement:
-		for _, s := range node.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
-			}
+		// blocks have their own scope, their variables can be declared again outside of them
+		table := c.symbolTable
+		table.EnterBlock()
+		err := c.compileStatements(node)
+		table.LeaveBlock()
+		if err != nil {
+			return err
 		}
 	case *ast.FunctionLiteral:
 		c.enterScope()
@@ -248,7 +282,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.symbolTable.Define(p.Ident.Value, false)
 		}
 
-		err := c.Compile(node.Body)
+		// the parameters and the body share the scope of the function
+		err := c.compileStatements(node.Body)
 		if err != nil {
 			return err
 		}
@@ -257,23 +292,35 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		if !c.lastInstructionIs(code.OpReturnValue) {
 			if node.ReturnType.Value != "void" {
-				return createError("Expected return type %s, not void", node.GetPosition(), node.ReturnType.Value)
+				return c.createError("Expected return type %s, not void", node.GetPosition(), node.ReturnType.Value)
 			}
 			c.emit(code.OpReturn)
 		}
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		var localNames, freeNames []string
+		for _, s := range c.symbolTable.Slots() {
+			localNames = append(localNames, s.Name)
+		}
+		for _, s := range freeSymbols {
+			freeNames = append(freeNames, s.Name)
+		}
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.captureSymbol(s)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
 		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
@@ -290,13 +337,39 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpCall, len(node.Arguments))
 	case *ast.ReturnStatement:
+		if c.scopes[c.scopeIndex].module {
+			return c.createError("return outside of a function", node.GetPosition())
+		}
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		if c.lastInstructionIs(code.OpCall) {
+			c.makeTailCall(&c.scopes[c.scopeIndex].lastInstruction)
+		}
 		c.emit(code.OpReturnValue)
 	case *ast.BreakStatement:
-		return createError("Break statements are not supported in the compiled version", node.GetPosition())
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.createError("break outside of a loop", node.GetPosition())
+		}
+		if node.BreakValue == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.Compile(node.BreakValue)
+			if err != nil {
+				return err
+			}
+		}
+		pos := c.emit(code.OpJump, 9999)
+		loop.breakPositions = append(loop.breakPositions, pos)
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return c.createError("continue outside of a loop", node.GetPosition())
+		}
+		pos := c.emit(code.OpJump, 9999)
+		loop.continuePositions = append(loop.continuePositions, pos)
 	case *ast.BooleanLiteral:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -349,12 +422,121 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.StructStatement:
+		if c.symbolTable.HasValue(node.Name.Value) {
+			return c.createError("Variable %s is already defined", node.GetPosition(), node.Name.Value)
+		}
+		definition := &object.StructDefinition{Name: node.Name.Value, Module: c.module}
+		for _, field := range node.Fields {
+			definition.Fields = append(definition.Fields, object.StructField{Name: field.Ident.Value, Type: object.QualifyType(c.module, field.Type.Value)})
+		}
+		symbol := c.define(node.Name.Value, false)
+		c.emit(code.OpConstant, c.addConstant(definition))
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpDefineGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpDefineLocal, symbol.Index)
+		}
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+	case *ast.ExportStatement:
+		return c.Compile(node.Statement)
+	case *ast.StructLiteral:
+		var err error
+		if node.Module != nil {
+			err = c.Compile(&ast.FieldAccessExpression{Token: node.Token, Left: node.Module, Field: node.Name})
+		} else {
+			err = c.Compile(node.Name)
+		}
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		for _, field := range node.Fields {
+			if seen[field.Name.Value] {
+				return c.createError("Field %s is set more than once", field.Name.GetPosition(), field.Name.Value)
+			}
+			seen[field.Name.Value] = true
+
+			name := &object.String{Value: field.Name.Value}
+			c.emit(code.OpConstant, c.addConstant(name))
+			err := c.Compile(field.Value)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpStruct, len(node.Fields)*2)
+	case *ast.FieldAccessExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		name := &object.String{Value: node.Field.Value}
+		c.emit(code.OpGetField, c.addConstant(name))
+	}
+	return nil
+}
+
+func (c *Compiler) compileStatements(block *ast.BlockStatement) error {
+	for _, s := range block.Statements {
+		err := c.Compile(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBlockValue compiles a block used as an expression, leaving its value on the stack
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpAssertBoolean)
+	jumpNotTruePos := c.emit(code.OpJumpNotTrue, 9999)
+
+	if node.Operator == "&&" {
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpAssertBoolean)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruePos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	c.emit(code.OpTrue)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruePos, len(c.currentInstructions()))
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
 	}
+	c.emit(code.OpAssertBoolean)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
 	return nil
 }
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
+	c.scopes[c.scopeIndex].sourceMap.Add(pos, c.position)
 
 	c.setLastInstruction(op, pos)
 
@@ -388,6 +570,7 @@ func (c *Compiler) removeLastPop() {
 	old := c.currentInstructions()
 	new := old[:last.Position]
 	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 func (c *Compiler) changeOperand(opPos int, operand int) {
@@ -409,6 +592,21 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+
+	// a call right before the pop now returns its result
+	previous := &c.scopes[c.scopeIndex].previousInstruction
+	if previous.Opcode == code.OpCall && previous.Position+len(code.Make(code.OpCall, 0)) == lastPos {
+		c.makeTailCall(previous)
+	}
+}
+
+// makeTailCall turns a call followed by a return into a tail call, only functions have a frame to reuse
+func (c *Compiler) makeTailCall(call *EmittedInstruction) {
+	if c.scopeIndex == 0 || c.scopes[c.scopeIndex].module {
+		return
+	}
+	c.currentInstructions()[call.Position] = byte(code.OpTailCall)
+	call.Opcode = code.OpTailCall
 }
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
@@ -422,7 +620,32 @@ func (c *Compiler) loadSymbol(s Symbol) {
 		c.emit(code.OpGetBuiltin, s.Index)
 	}
 }
-func createError(msg string, pos token.Position, a ...interface{}) error {
-	newMsg := fmt.Sprintf(msg, a...)
-	return fmt.Errorf("Error at %d:%d: %s", pos.Line, pos.Column, newMsg)
+
+// captureSymbol pushes the cell of a variable captured by a closure, so the closure shares it
+// with the enclosing function instead of copying its value
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	case GlobalScope:
+		c.emit(code.OpCaptureGlobal, s.Index)
+	}
+}
+
+// define defines a variable in the current scope. Globals declared in a loop body are captured by
+// closures like locals, so that each iteration has its own.
+func (c *Compiler) define(name string, mutable bool) Symbol {
+	symbol := c.symbolTable.Define(name, mutable)
+	if symbol.Scope == GlobalScope && c.currentLoop() != nil {
+		symbol.Iteration = true
+		c.symbolTable.store[name] = symbol
+	}
+	return symbol
+}
+func (c *Compiler) createError(msg string, pos token.Position, a ...interface{}) error {
+	d := diagnostic.New(diagnostic.CompileError, diagnostic.At(pos), msg, a...)
+	d.Span.File = c.fileName
+	return d
 }
@@ -67,6 +67,16 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "7 % 2",
+			expectedConstants: []interface{}{7, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "-1",
 			expectedConstants: []interface{}{1},
@@ -180,21 +190,21 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input:             "1 <= 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterEqualsThan),
+				code.Make(code.OpLessEqualsThan),
 				code.Make(code.OpPop),
 			},
 		},
@@ -249,6 +259,55 @@ func TestBooleanExpressions(t *testing.T) {
 	}
 	runCompilerTests(t, tests)
 }
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpAssertBoolean),
+				// 0002
+				code.Make(code.OpJumpNotTrue, 10),
+				// 0005
+				code.Make(code.OpFalse),
+				// 0006
+				code.Make(code.OpAssertBoolean),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpFalse),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpAssertBoolean),
+				// 0002
+				code.Make(code.OpJumpNotTrue, 9),
+				// 0005
+				code.Make(code.OpTrue),
+				// 0006
+				code.Make(code.OpJump, 11),
+				// 0009
+				code.Make(code.OpFalse),
+				// 0010
+				code.Make(code.OpAssertBoolean),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -308,23 +367,124 @@ for (true) { 10 }; 3333;
 				// 0000
 				code.Make(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpNotTrue, 10),
+				code.Make(code.OpJumpNotTrue, 11),
 				// 0004
 				code.Make(code.OpConstant, 0),
 				// 0007
+				code.Make(code.OpPop),
+				// 0008
 				code.Make(code.OpJump, 0),
-				code.Make(code.OpNull),
 				// 0011
-				code.Make(code.OpPop),
+				code.Make(code.OpNull),
 				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpConstant, 1),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// closures keep the variables of their iteration, the ones the body declared are closed after it
+			input: `
+let mut i = 0; for (i < 1) { let j = i; i = j + 1 }
+`,
+			expectedConstants: []interface{}{0, 1, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpDefineGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
 				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThan),
+				// 0013
+				code.Make(code.OpJumpNotTrue, 38),
+				// 0016
+				code.Make(code.OpGetGlobal, 0),
+				// 0019
+				code.Make(code.OpDefineGlobal, 1),
+				// 0022
+				code.Make(code.OpGetGlobal, 1),
+				// 0025
+				code.Make(code.OpConstant, 2),
+				// 0028
+				code.Make(code.OpAdd),
+				// 0029
+				code.Make(code.OpSetGlobal, 0),
+				// 0032
+				code.Make(code.OpCloseGlobalUpvalues, 1),
+				// 0035
+				code.Make(code.OpJump, 6),
+				// 0038
+				code.Make(code.OpNull),
+				// 0039
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+for (true) { if (false) { continue; }; break 10; }
+`,
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTrue, 26),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTrue, 15),
+				// 0008
+				code.Make(code.OpJump, 0),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpJump, 16),
 				// 0015
+				code.Make(code.OpNull),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpConstant, 0),
+				// 0020
+				code.Make(code.OpJump, 27),
+				// 0023
+				code.Make(code.OpJump, 0),
+				// 0026
+				code.Make(code.OpNull),
+				// 0027
 				code.Make(code.OpPop),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
+func TestLoopControlOutsideOfLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break 1;", "Error at 1:1: break outside of a loop"},
+		{"continue;", "Error at 1:1: continue outside of a loop"},
+		{"for true { fun() { break; } }", "Error at 1:20: break outside of a loop"},
+		{"if (true) { let x = 1 }; x", "Error at 1:26: undefined variable x"},
+		{"let f = fun(a int) int { let a = 2; a }", "Error at 1:26: Variable a is already defined"},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("expected compiler error for %q", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -335,9 +495,9 @@ let two = 2;
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpDefineGlobal, 1),
 			},
 		},
 		{
@@ -348,7 +508,7 @@ one;
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0), code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0), code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -361,9 +521,9 @@ two;
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpDefineGlobal, 1),
 				code.Make(code.OpGetGlobal, 1),
 				code.Make(code.OpPop),
 			},
@@ -616,7 +776,7 @@ noArg();
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0), // The compiled function
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
 				code.Make(code.OpPop),
@@ -635,7 +795,7 @@ let oneArg = fun(a int) { a };oneArg(24);
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 0, 0),
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpCall, 1),
@@ -662,7 +822,7 @@ manyArg(24, 25, 26);
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 0, 0),
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
@@ -741,7 +901,7 @@ fun() { num }
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
@@ -757,7 +917,7 @@ num
 				55,
 				[]code.Instructions{
 					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpDefineLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpReturnValue),
 				},
@@ -780,9 +940,9 @@ a + b
 				77,
 				[]code.Instructions{
 					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpDefineLocal, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpDefineLocal, 1),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpAdd), code.Make(code.OpReturnValue),
@@ -821,7 +981,7 @@ push([], 1);
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 1),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -833,6 +993,95 @@ push([], 1);
 	}
 	runCompilerTests(t, tests)
 }
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fun(f fn) int { return f() }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fun(f fn) int { f() }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the result is still used after the call
+			input: `fun(f fn) int { f() + 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// only the call of the alternative is directly followed by the return
+			input: `fun(f fn) int { if (true) { f() } else { f() } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpJumpNotTrue, 11),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpJump, 15),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the main program has no frame to reuse
+			input: `let f = fun() int { 1 }; f()`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpDefineGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
 func TestClosures(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -850,7 +1099,7 @@ return a + b
 					code.Make(code.OpAdd),
 					code.Make(code.OpReturnValue),
 				}, []code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -880,13 +1129,13 @@ a + b + c
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -917,7 +1166,7 @@ global + a + b + c;
 				88,
 				[]code.Instructions{
 					code.Make(code.OpConstant, 3),
-					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpDefineLocal, 0),
 					code.Make(code.OpGetGlobal, 0),
 					code.Make(code.OpGetFree, 0),
 					code.Make(code.OpAdd),
@@ -928,23 +1177,23 @@ global + a + b + c;
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpConstant, 2), code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2), code.Make(code.OpDefineLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpDefineLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDefineGlobal, 0),
 				code.Make(code.OpClosure, 6, 0),
 				code.Make(code.OpPop),
 			},
@@ -952,6 +1201,30 @@ global + a + b + c;
 	}
 	runCompilerTests(t, tests)
 }
+func TestStructs(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "struct Point { x int }; Point{x: 1}.x",
+			expectedConstants: []interface{}{
+				&object.StructDefinition{Name: "Point"},
+				"x",
+				1,
+				"x",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefineGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpStruct, 2),
+				code.Make(code.OpGetField, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
 
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
@@ -1025,6 +1298,16 @@ func testConstants(
 				return fmt.Errorf("constant %d - testStringObject failed: %s",
 					i, err)
 			}
+		case *object.StructDefinition:
+			def, ok := actual[i].(*object.StructDefinition)
+			if !ok {
+				return fmt.Errorf("constant %d - not a struct definition: %T",
+					i, actual[i])
+			}
+			if def.Name != constant.Name {
+				return fmt.Errorf("constant %d - wrong struct name. got=%q, want=%q",
+					i, def.Name, constant.Name)
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
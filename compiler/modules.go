@@ -0,0 +1,88 @@
+package compiler
+
+import (
+	"errors"
+	"kol/ast"
+	"kol/code"
+	"kol/diagnostic"
+	"kol/module"
+	"kol/object"
+)
+
+// compileImportStatement compiles a module the first time it is imported into a function
+// that runs its top level code and returns the module object
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) error {
+	if c.symbolTable.HasValue(node.Name.Value) {
+		return c.createError("Variable %s is already defined", node.GetPosition(), node.Name.Value)
+	}
+	fileName := module.Resolve(c.fileName, node.Path)
+	imported, compiled := c.modules[fileName]
+	if compiled {
+		c.emit(code.OpGetGlobal, imported.Index)
+	} else {
+		program, err := c.loader.Load(c.fileName, fileName)
+		var parseErr *module.ParseError
+		if errors.As(err, &parseErr) {
+			return err
+		}
+		if err != nil {
+			d := diagnostic.New(diagnostic.ImportError, diagnostic.At(node.GetPosition()), "%s", err)
+			d.Span.File = c.fileName
+			return d
+		}
+		err = c.compileModule(node.Name.Value, fileName, program)
+		c.loader.Done()
+		if err != nil {
+			return err
+		}
+	}
+	symbol := c.symbolTable.Define(node.Name.Value, false)
+	c.emit(code.OpDefineGlobal, symbol.Index)
+	if !compiled {
+		c.modules[fileName] = symbol
+	}
+	return nil
+}
+func (c *Compiler) compileModule(name string, fileName string, program *ast.Program) error {
+	importerFileName := c.fileName
+	importerModule := c.module
+	importerSymbols := c.symbolTable
+	defer func() {
+		c.fileName = importerFileName
+		c.module = importerModule
+		c.symbolTable = importerSymbols
+	}()
+
+	c.fileName = fileName
+	c.module = name
+	c.enterScope()
+	c.symbolTable = importerSymbols.NewSegment()
+	c.scopes[c.scopeIndex].module = true
+
+	err := c.Compile(program)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+	exports := module.Exports(program)
+	for _, export := range exports {
+		symbol, _ := c.symbolTable.Resolve(export)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: export}))
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpModule, len(exports)*2)
+	c.emit(code.OpReturnValue)
+
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	compiledFn := &object.CompiledFunction{
+		Instructions: instructions,
+		Name:         "<module " + name + ">",
+		SourceMap:    sourceMap,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), 0)
+	c.emit(code.OpCall, 0)
+	return nil
+}
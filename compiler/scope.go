@@ -6,21 +6,71 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+
+	// the loops currently being compiled, innermost last
+	loops []*LoopScope
+	// set for the top level code of an imported module
+	module bool
 }
 type EmittedInstruction struct {
 	Opcode   code.Opcode
 	Position int
 }
 
+// LoopScope holds the jumps a loop body needs to patch or target
+type LoopScope struct {
+	start             int
+	breakPositions    []int
+	continuePositions []int
+	// the first local and global index the body can declare
+	firstLocal, firstGlobal int
+}
+
 func (c *Compiler) enterScope() {
 	scope := CompilationScope{
 		instructions:    code.Instructions{},
 		lastInstruction: EmittedInstruction{}, previousInstruction: EmittedInstruction{},
+		sourceMap: code.SourceMap{File: c.fileName},
 	}
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex++
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
+func (c *Compiler) enterLoop(start int) {
+	loops := c.scopes[c.scopeIndex].loops
+	loop := &LoopScope{start: start, firstLocal: c.symbolTable.numDefinitions, firstGlobal: *c.symbolTable.numGlobals}
+	c.scopes[c.scopeIndex].loops = append(loops, loop)
+}
+
+// closeIterationVariables closes the upvalues of the variables the body of a loop declared, so closures
+// created in one iteration keep its values like in the evaluator. It returns false if there are none.
+func (c *Compiler) closeIterationVariables(loop *LoopScope) bool {
+	if c.symbolTable.Outer == nil {
+		if *c.symbolTable.numGlobals == loop.firstGlobal {
+			return false
+		}
+		c.emit(code.OpCloseGlobalUpvalues, loop.firstGlobal)
+		return true
+	}
+	if c.symbolTable.numDefinitions == loop.firstLocal {
+		return false
+	}
+	c.emit(code.OpCloseUpvalues, loop.firstLocal)
+	return true
+}
+func (c *Compiler) leaveLoop() *LoopScope {
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+	return loops[len(loops)-1]
+}
+func (c *Compiler) currentLoop() *LoopScope {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
 func (c *Compiler) leaveScope() code.Instructions {
 	instructions := c.currentInstructions()
 	c.scopes = c.scopes[:len(c.scopes)-1]
@@ -0,0 +1,280 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"kol/code"
+	"kol/object"
+	"kol/token"
+	"math"
+)
+
+// Layout of a .kolc file:
+//
+//	magic       4 bytes  "KOLC"
+//	version     uint16
+//	opcodes     uint32   code.Fingerprint() of the compiler that wrote the file
+//	length      uint32   length of the payload
+//	payload     instructions, source map and constant pool of the main program
+//	checksum    uint32   CRC-32 of the payload
+const (
+	FormatVersion = 3
+	formatMagic   = "KOLC"
+)
+
+const (
+	tagInteger byte = iota
+	tagFloat
+	tagString
+	tagCompiledFunction
+	tagStructDefinition
+)
+
+var ErrInvalidBytecodeFile = errors.New("not a compiled kol file")
+
+// Encode writes the bytecode in the versioned .kolc format
+func (b *Bytecode) Encode(w io.Writer) error {
+	payload := &encoder{}
+	payload.instructions(b.Instructions)
+	payload.sourceMap(b.SourceMap)
+	payload.uvarint(uint64(len(b.Constants)))
+	for _, constant := range b.Constants {
+		err := payload.constant(constant)
+		if err != nil {
+			return err
+		}
+	}
+
+	header := make([]byte, 0, 14)
+	header = append(header, formatMagic...)
+	header = binary.BigEndian.AppendUint16(header, FormatVersion)
+	header = binary.BigEndian.AppendUint32(header, code.Fingerprint())
+	header = binary.BigEndian.AppendUint32(header, uint32(payload.buf.Len()))
+
+	checksum := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(payload.buf.Bytes()))
+	for _, part := range [][]byte{header, payload.buf.Bytes(), checksum} {
+		_, err := w.Write(part)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads bytecode written by Encode, rejecting files from other format versions or opcode sets
+func Decode(r io.Reader) (*Bytecode, error) {
+	header := make([]byte, 14)
+	_, err := io.ReadFull(r, header)
+	if err != nil || string(header[:4]) != formatMagic {
+		return nil, ErrInvalidBytecodeFile
+	}
+	version := binary.BigEndian.Uint16(header[4:])
+	if version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, expected %d", version, FormatVersion)
+	}
+	if binary.BigEndian.Uint32(header[6:]) != code.Fingerprint() {
+		return nil, fmt.Errorf("bytecode was compiled with an incompatible opcode set, recompile it")
+	}
+
+	// the length isn't trusted until the payload is read, a corrupted one can't allocate more than the file holds
+	length := int64(binary.BigEndian.Uint32(header[10:]))
+	payload, err := io.ReadAll(io.LimitReader(r, length))
+	if err != nil || int64(len(payload)) != length {
+		return nil, fmt.Errorf("bytecode file is truncated")
+	}
+	checksum := make([]byte, 4)
+	_, err = io.ReadFull(r, checksum)
+	if err != nil || binary.BigEndian.Uint32(checksum) != crc32.ChecksumIEEE(payload) {
+		return nil, fmt.Errorf("bytecode file is corrupted: checksum mismatch")
+	}
+
+	d := &decoder{buf: payload}
+	bytecode := &Bytecode{}
+	bytecode.Instructions = d.instructions()
+	bytecode.SourceMap = d.sourceMap()
+	numConstants := d.uvarint()
+	for i := uint64(0); i < numConstants && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return bytecode, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uvarint(v uint64) { e.buf.Write(binary.AppendUvarint(nil, v)) }
+func (e *encoder) varint(v int64)   { e.buf.Write(binary.AppendVarint(nil, v)) }
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+func (e *encoder) strings(s []string) {
+	e.uvarint(uint64(len(s)))
+	for _, str := range s {
+		e.string(str)
+	}
+}
+func (e *encoder) instructions(ins code.Instructions) {
+	e.uvarint(uint64(len(ins)))
+	e.buf.Write(ins)
+}
+func (e *encoder) sourceMap(sm code.SourceMap) {
+	e.string(sm.File)
+	e.uvarint(uint64(len(sm.Entries)))
+	for _, entry := range sm.Entries {
+		e.uvarint(uint64(entry.Offset))
+		e.uvarint(uint64(entry.Position.Line))
+		e.uvarint(uint64(entry.Position.Column))
+	}
+}
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.varint(obj.Value)
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		e.uvarint(math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagCompiledFunction)
+		e.instructions(obj.Instructions)
+		e.uvarint(uint64(obj.NumLocals))
+		e.uvarint(uint64(obj.NumParameters))
+		e.string(obj.Name)
+		e.sourceMap(obj.SourceMap)
+		e.strings(obj.LocalNames)
+		e.strings(obj.FreeNames)
+	case *object.StructDefinition:
+		e.buf.WriteByte(tagStructDefinition)
+		e.string(obj.Name)
+		e.string(obj.Module)
+		e.uvarint(uint64(len(obj.Fields)))
+		for _, field := range obj.Fields {
+			e.string(field.Name)
+			e.string(field.Type)
+		}
+	default:
+		return fmt.Errorf("can't serialize constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("bytecode file is corrupted: unexpected end of data")
+	}
+}
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.pos += n
+	return v
+}
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.pos:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.pos += n
+	return v
+}
+func (d *decoder) bytes() []byte {
+	length := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if length > uint64(len(d.buf)-d.pos) {
+		d.fail()
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+int(length)]
+	d.pos += int(length)
+	return b
+}
+func (d *decoder) string() string { return string(d.bytes()) }
+func (d *decoder) strings() []string {
+	var s []string
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		s = append(s, d.string())
+	}
+	return s
+}
+func (d *decoder) instructions() code.Instructions {
+	return append(code.Instructions{}, d.bytes()...)
+}
+func (d *decoder) sourceMap() code.SourceMap {
+	sm := code.SourceMap{File: d.string()}
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		offset := int(d.uvarint())
+		pos := token.Position{Line: int(d.uvarint()), Column: int(d.uvarint())}
+		sm.Entries = append(sm.Entries, code.SourceMapEntry{Offset: offset, Position: pos})
+	}
+	return sm
+}
+func (d *decoder) constant() object.Object {
+	if d.pos >= len(d.buf) {
+		d.fail()
+		return nil
+	}
+	tag := d.buf[d.pos]
+	d.pos++
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: d.varint()}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uvarint())}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagCompiledFunction:
+		fn := &object.CompiledFunction{}
+		fn.Instructions = d.instructions()
+		fn.NumLocals = int(d.uvarint())
+		fn.NumParameters = int(d.uvarint())
+		fn.Name = d.string()
+		fn.SourceMap = d.sourceMap()
+		fn.LocalNames = d.strings()
+		fn.FreeNames = d.strings()
+		return fn
+	case tagStructDefinition:
+		def := &object.StructDefinition{Name: d.string(), Module: d.string()}
+		count := d.uvarint()
+		for i := uint64(0); i < count && d.err == nil; i++ {
+			def.Fields = append(def.Fields, object.StructField{Name: d.string(), Type: d.string()})
+		}
+		return def
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("bytecode file is corrupted: unknown constant tag %d", tag)
+		}
+		return nil
+	}
+}
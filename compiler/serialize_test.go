@@ -0,0 +1,108 @@
+package compiler
+
+import (
+	"bytes"
+	"kol/code"
+	"kol/module"
+	"kol/object"
+	"reflect"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+import "geometry"
+struct Point { x int, y float }
+let add = fun(a int, b int) int { a + b };
+let p = Point{x: add(1, -2), y: 2.5};
+"name" + str(p.x);
+geometry.Point{x: 1};
+`
+	comp := New()
+	comp.SetFileName("main.kol")
+	loader := module.NewLoader()
+	loader.ReadFile = func(name string) ([]byte, error) {
+		return []byte("export struct Point { x int }"), nil
+	}
+	comp.SetLoader(loader)
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{bytecode.Instructions}, decoded.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	if !reflect.DeepEqual(bytecode.SourceMap, decoded.SourceMap) {
+		t.Errorf("source map differs. want=%+v, got=%+v", bytecode.SourceMap, decoded.SourceMap)
+	}
+	if len(decoded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bytecode.Constants), len(decoded.Constants))
+	}
+	for i, constant := range bytecode.Constants {
+		if !reflect.DeepEqual(constant, decoded.Constants[i]) {
+			t.Errorf("constant %d differs. want=%+v, got=%+v", i, constant, decoded.Constants[i])
+		}
+	}
+}
+
+func TestDecodeRejectsInvalidFiles(t *testing.T) {
+	comp := New()
+	err := comp.Compile(parse(`let a = fun() { 1 }; a()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	err = comp.Bytecode().Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	corrupt := func(change func(b []byte) []byte) []byte {
+		return change(append([]byte{}, valid...))
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, "not a compiled kol file"},
+		{"magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), "not a compiled kol file"},
+		{"version", corrupt(func(b []byte) []byte { b[5] = 99; return b }), "unsupported bytecode version 99, expected 3"},
+		{"opcodes", corrupt(func(b []byte) []byte { b[6] ^= 0xff; return b }), "bytecode was compiled with an incompatible opcode set, recompile it"},
+		{"checksum", corrupt(func(b []byte) []byte { b[15] ^= 0xff; return b }), "bytecode file is corrupted: checksum mismatch"},
+		{"truncated", valid[:len(valid)-8], "bytecode file is truncated"},
+		{"length", corrupt(func(b []byte) []byte { copy(b[10:], []byte{0xff, 0xff, 0xff, 0xff}); return b }), "bytecode file is truncated"},
+	}
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("[%s] expected error, got none", tt.name)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("[%s] wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestEncodeRejectsUnsupportedConstants(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{&object.Boolean{Value: true}}}
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || err.Error() != "can't serialize constant of type BOOLEAN" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -14,20 +16,46 @@ type Symbol struct {
 	Scope   SymbolScope
 	Index   int
 	Mutable bool
+	// set for globals declared in the body of a loop
+	Iteration bool
 }
 type SymbolTable struct {
 	Outer *SymbolTable
 
 	store          map[string]Symbol
 	numDefinitions int
+	// number of globals defined by all segments of a program, shared between them
+	numGlobals *int
 
 	FreeSymbols []Symbol
+
+	// the names declared by the blocks being compiled, innermost last, with the symbols they shadow
+	blocks []map[string]shadowed
+	// the variables of the blocks that ended, they keep their slots
+	scopedOut []Symbol
+}
+type shadowed struct {
+	symbol Symbol
+	ok     bool
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
 	free := []Symbol{}
-	return &SymbolTable{store: s, FreeSymbols: free}
+	return &SymbolTable{store: s, FreeSymbols: free, numGlobals: new(int)}
+}
+
+// NewSegment creates the global symbol table of an imported module.
+// It shares the builtins and the global indexes of s but none of its names.
+func (s *SymbolTable) NewSegment() *SymbolTable {
+	segment := NewSymbolTable()
+	segment.numGlobals = s.numGlobals
+	for name, symbol := range s.store {
+		if symbol.Scope == BuiltinScope {
+			segment.store[name] = symbol
+		}
+	}
+	return segment
 }
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
@@ -39,13 +67,39 @@ func (s *SymbolTable) Define(name string, mutable bool) Symbol {
 	symbol := Symbol{Name: name, Index: s.numDefinitions, Mutable: mutable}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
+		symbol.Index = *s.numGlobals
+		*s.numGlobals++
 	} else {
 		symbol.Scope = LocalScope
 	}
+	if len(s.blocks) != 0 {
+		block := s.blocks[len(s.blocks)-1]
+		if _, ok := block[name]; !ok {
+			previous, ok := s.store[name]
+			block[name] = shadowed{symbol: previous, ok: ok}
+		}
+	}
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
+
+// EnterBlock starts a block, the variables it defines are in scope until LeaveBlock
+func (s *SymbolTable) EnterBlock() {
+	s.blocks = append(s.blocks, make(map[string]shadowed))
+}
+func (s *SymbolTable) LeaveBlock() {
+	block := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	for name, previous := range block {
+		s.scopedOut = append(s.scopedOut, s.store[name])
+		if previous.ok {
+			s.store[name] = previous.symbol
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -54,7 +108,7 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return obj, ok
 		}
 
-		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		if obj.Scope == GlobalScope && !obj.Iteration || obj.Scope == BuiltinScope {
 			return obj, ok
 		}
 
@@ -63,9 +117,38 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	}
 	return obj, ok
 }
+
+// Definitions returns the variables defined in the table itself that are in scope ordered by their index
+func (s *SymbolTable) Definitions() []Symbol {
+	symbols := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return sortByIndex(symbols)
+}
+
+// Slots returns all variables defined in the table itself ordered by their index, including the ones of ended blocks
+func (s *SymbolTable) Slots() []Symbol {
+	return sortByIndex(append(s.Definitions(), s.scopedOut...))
+}
+func sortByIndex(symbols []Symbol) []Symbol {
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
+// HasValue reports whether the table defines name itself in the innermost block, programs can shadow
+// builtins like in the evaluator
 func (s *SymbolTable) HasValue(name string) bool {
-	_, ok := s.store[name]
-	return ok
+	if len(s.blocks) != 0 {
+		_, ok := s.blocks[len(s.blocks)-1][name]
+		return ok
+	}
+	symbol, ok := s.store[name]
+	return ok && symbol.Scope != BuiltinScope
 }
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
@@ -1,6 +1,9 @@
 package compiler
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestDefine(t *testing.T) {
 	expected := map[string]Symbol{
@@ -261,3 +264,91 @@ func TestResolveUnresolvableFree(t *testing.T) {
 		}
 	}
 }
+func TestDefineInSegment(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a", false)
+
+	segment := global.NewSegment()
+	b := segment.Define("b", false)
+	expected := Symbol{Name: "b", Scope: GlobalScope, Index: 1}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+	if _, ok := segment.Resolve("a"); ok {
+		t.Errorf("name a of the importing module resolvable in segment")
+	}
+	builtin, ok := segment.Resolve("len")
+	if !ok || builtin.Scope != BuiltinScope {
+		t.Errorf("builtin len not resolvable in segment. got=%+v", builtin)
+	}
+
+	c := global.Define("c", false)
+	expected = Symbol{Name: "c", Scope: GlobalScope, Index: 2}
+	if c != expected {
+		t.Errorf("expected c=%+v, got=%+v", expected, c)
+	}
+}
+func TestDefinitions(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a", false)
+	global.Define("b", true)
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c", false)
+	local.Resolve("a")
+
+	expectedGlobal := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: GlobalScope, Index: 1, Mutable: true},
+	}
+	expectedLocal := []Symbol{
+		{Name: "c", Scope: LocalScope, Index: 0},
+	}
+	for _, tt := range []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{{global, expectedGlobal}, {local, expectedLocal}} {
+		definitions := tt.table.Definitions()
+		if len(definitions) != len(tt.expected) {
+			t.Fatalf("wrong number of definitions. want=%d, got=%+v", len(tt.expected), definitions)
+		}
+		for i, symbol := range tt.expected {
+			if definitions[i] != symbol {
+				t.Errorf("expected %+v, got=%+v", symbol, definitions[i])
+			}
+		}
+	}
+}
+func TestBlocks(t *testing.T) {
+	table := NewEnclosedSymbolTable(NewSymbolTable())
+	table.Define("a", false)
+	table.EnterBlock()
+	if table.HasValue("a") {
+		t.Errorf("expected a block to be able to shadow a")
+	}
+	table.Define("a", true)
+	table.Define("b", false)
+	if !table.HasValue("b") {
+		t.Errorf("expected b to be defined in the block")
+	}
+	if symbol, _ := table.Resolve("a"); symbol != (Symbol{Name: "a", Scope: LocalScope, Index: 1, Mutable: true}) {
+		t.Errorf("expected a to resolve to the variable of the block, got=%+v", symbol)
+	}
+	table.LeaveBlock()
+	if symbol, _ := table.Resolve("a"); symbol != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("expected a to resolve to the variable before the block, got=%+v", symbol)
+	}
+	if _, ok := table.Resolve("b"); ok {
+		t.Errorf("expected b to be out of scope after the block")
+	}
+	table.Define("b", false)
+	var names []string
+	for _, symbol := range table.Slots() {
+		names = append(names, symbol.Name)
+	}
+	if strings.Join(names, " ") != "a a b b" {
+		t.Errorf("expected the slots of the block to be kept, got=%v", names)
+	}
+}
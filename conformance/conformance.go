@@ -0,0 +1,112 @@
+// Package conformance runs programs on every engine and reports where the engines disagree. Programs
+// in testdata have their expected output next to them, the Generator creates random ones.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kol/diagnostic"
+	"kol/engine"
+	"kol/object"
+	"os"
+	"strings"
+)
+
+// Outcome is what a program did on one engine
+type Outcome struct {
+	Engine string
+	// what the program printed to stdout and stderr
+	Output string
+	// the codes and messages of the errors the program stopped with, empty when it ended normally. Positions
+	// and stack traces aren't part of it, engines report them with different precision.
+	Error string
+}
+
+func (o Outcome) String() string {
+	if o.Error == "" {
+		return fmt.Sprintf("%s printed %q", o.Engine, o.Output)
+	}
+	return fmt.Sprintf("%s printed %q and failed with %q", o.Engine, o.Output, o.Error)
+}
+
+// Run runs a program on every engine. It reads no input.
+func Run(ctx context.Context, fileName string, input string) []Outcome {
+	outcomes := make([]Outcome, len(engine.Names))
+	for i, name := range engine.Names {
+		var output strings.Builder
+		std := &object.IO{In: strings.NewReader(""), Out: &output, Err: &output}
+		e, _ := engine.New(name, engine.Options{IO: std})
+		_, err := e.Run(ctx, fileName, input)
+		outcomes[i] = Outcome{Engine: name, Output: output.String()}
+		if err != nil {
+			outcomes[i].Error = message(err)
+		}
+	}
+	return outcomes
+}
+
+// message joins the codes and messages of the diagnostics behind an error
+func message(err error) string {
+	diagnostics := diagnostic.FromError(err, diagnostic.RuntimeError)
+	messages := make([]string, len(diagnostics))
+	for i, d := range diagnostics {
+		messages[i] = fmt.Sprintf("error[%s]: %s", d.Code, d.Message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Compare reports the engines that disagree with the first one
+func Compare(outcomes []Outcome) error {
+	var diverging []string
+	for _, outcome := range outcomes[1:] {
+		if outcome.Output != outcomes[0].Output || outcome.Error != outcomes[0].Error {
+			diverging = append(diverging, outcome.String())
+		}
+	}
+	if len(diverging) == 0 {
+		return nil
+	}
+	return fmt.Errorf("engines diverge: %s, but %s", outcomes[0], strings.Join(diverging, ", "))
+}
+
+// CheckFile runs the program in a .kol file on every engine and compares the outcomes to each other and
+// to the expected ones: the output in the .out file and the errors in the .err file next to it.
+// A missing file expects no output or no error.
+func CheckFile(ctx context.Context, path string) error {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	expectedOutput, err := readExpected(strings.TrimSuffix(path, ".kol") + ".out")
+	if err != nil {
+		return err
+	}
+	expectedError, err := readExpected(strings.TrimSuffix(path, ".kol") + ".err")
+	if err != nil {
+		return err
+	}
+	expectedError = strings.TrimSuffix(expectedError, "\n")
+
+	outcomes := Run(ctx, path, string(input))
+	if err := Compare(outcomes); err != nil {
+		return err
+	}
+	var unexpected []string
+	for _, outcome := range outcomes {
+		if outcome.Output != expectedOutput || outcome.Error != expectedError {
+			unexpected = append(unexpected, outcome.String())
+		}
+	}
+	if len(unexpected) == 0 {
+		return nil
+	}
+	return fmt.Errorf("expected the output %q and the error %q, but %s", expectedOutput, expectedError, strings.Join(unexpected, ", "))
+}
+func readExpected(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return string(content), err
+}
@@ -0,0 +1,89 @@
+package conformance
+
+import (
+	"context"
+	"flag"
+	"kol/lexer"
+	"kol/parser"
+	"kol/typecheck"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "write what the engines agree on to the expected files of the programs")
+
+func TestPrograms(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.kol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			if *update {
+				writeExpected(t, path)
+			}
+			if err := CheckFile(context.Background(), path); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// writeExpected replaces the expected files of a program with the outcome of the engines
+func writeExpected(t *testing.T, path string) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := Run(context.Background(), path, string(input))
+	if err := Compare(outcomes); err != nil {
+		t.Fatal(err)
+	}
+	base := strings.TrimSuffix(path, ".kol")
+	for extension, content := range map[string]string{".out": outcomes[0].Output, ".err": outcomes[0].Error} {
+		os.Remove(base + extension)
+		if content == "" {
+			continue
+		}
+		if extension == ".err" {
+			content += "\n"
+		}
+		if err := os.WriteFile(base+extension, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// compareGenerated runs the program the generator creates from seed on every engine
+func compareGenerated(t *testing.T, seed int64) {
+	source := Source(NewGenerator(seed).Program())
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("seed %d generated a program with syntax errors %v:\n%s", seed, p.Errors(), source)
+	}
+	if errors := typecheck.Check(program); len(errors) != 0 {
+		t.Fatalf("seed %d generated a program with type errors %v:\n%s", seed, errors, source)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := Compare(Run(ctx, "generated.kol", source)); err != nil {
+		t.Fatalf("seed %d: %s in:\n%s", seed, err, source)
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	for seed := int64(0); seed < 500; seed++ {
+		compareGenerated(t, seed)
+	}
+}
+
+func FuzzEngines(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(compareGenerated)
+}
@@ -0,0 +1,508 @@
+package conformance
+
+import (
+	"fmt"
+	"kol/ast"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// maxDepth bounds the nesting of expressions and blocks
+const maxDepth = 4
+
+// types are the types of the values generated programs compute with, arrays hold integers
+var types = []string{"int", "float", "bool", "str", "array"}
+
+// Generator builds random programs from the ast types to run on every engine. Its programs type check
+// and end: functions only call the functions declared before them and contain no loops, loops count
+// up to a small bound.
+type Generator struct {
+	rand *rand.Rand
+	// the variables visible in the current block, innermost scope last
+	scopes    [][]variable
+	functions []function
+	// names handed out so far, every name is new so that nothing is shadowed
+	names int
+	depth int
+	// the number of loops around the current statement, break and continue need one
+	loops int
+	// the return type of the function being generated, empty outside of functions
+	returnType string
+}
+
+type variable struct {
+	name string
+	typ  string
+	// whether the generator may reassign it, loop counters are only counted up by their loop
+	mutable bool
+}
+type function struct {
+	name       string
+	parameters []string
+	returnType string
+}
+
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Program generates a program that prints what it computes
+func (g *Generator) Program() *ast.Program {
+	g.scopes = [][]variable{nil}
+	program := &ast.Program{}
+	for i := 3 + g.rand.Intn(10); i > 0; i-- {
+		if g.rand.Intn(4) == 0 {
+			program.Statements = append(program.Statements, g.declareFunction())
+			continue
+		}
+		program.Statements = append(program.Statements, g.statement()...)
+	}
+	program.Statements = append(program.Statements, g.println())
+	return program
+}
+
+// name returns a new name, identifiers can't contain digits so the count is spelled with letters
+func (g *Generator) name(prefix string) string {
+	g.names++
+	name := []byte(prefix + "_")
+	for n := g.names; n > 0; n /= 26 {
+		name = append(name, byte('a'+n%26))
+	}
+	return string(name)
+}
+func (g *Generator) define(name string, typ string, mutable bool) {
+	g.scopes[len(g.scopes)-1] = append(g.scopes[len(g.scopes)-1], variable{name, typ, mutable})
+}
+
+// variables returns the visible variables of a type, only mutable ones with mutable set
+func (g *Generator) variables(typ string, mutable bool) []variable {
+	var found []variable
+	for _, scope := range g.scopes {
+		for _, v := range scope {
+			if v.typ == typ && (v.mutable || !mutable) {
+				found = append(found, v)
+			}
+		}
+	}
+	return found
+}
+
+// declareFunction declares a function with a few statements before its result
+func (g *Generator) declareFunction() ast.Statement {
+	fn := function{name: g.name("f"), returnType: []string{"int", "bool", "str"}[g.rand.Intn(3)]}
+	literal := &ast.FunctionLiteral{ReturnType: identifier(fn.returnType), Name: fn.name}
+	g.scopes = append(g.scopes, nil)
+	for i := g.rand.Intn(3); i > 0; i-- {
+		typ := []string{"int", "str", "bool", "array"}[g.rand.Intn(4)]
+		name := g.name("p")
+		fn.parameters = append(fn.parameters, typ)
+		literal.Parameters = append(literal.Parameters, &ast.FunctionParameter{Ident: *identifier(name), Type: *identifier(typ)})
+		g.define(name, typ, false)
+	}
+	g.returnType = fn.returnType
+	literal.Body = &ast.BlockStatement{}
+	for i := g.rand.Intn(3); i > 0; i-- {
+		literal.Body.Statements = append(literal.Body.Statements, g.statement()...)
+	}
+	literal.Body.Statements = append(literal.Body.Statements, &ast.ExpressionStatement{Expression: g.expression(fn.returnType)})
+	g.returnType = ""
+	g.scopes = g.scopes[:len(g.scopes)-1]
+
+	g.functions = append(g.functions, fn)
+	return &ast.LetStatement{Name: identifier(fn.name), Value: literal}
+}
+
+// statement generates one statement or a loop with its counter
+func (g *Generator) statement() []ast.Statement {
+	g.depth++
+	defer func() { g.depth-- }()
+	for {
+		switch g.rand.Intn(10) {
+		case 0, 1, 2:
+			typ := types[g.rand.Intn(len(types))]
+			name := g.name("v")
+			mutable := g.rand.Intn(2) == 0
+			statement := &ast.LetStatement{Name: identifier(name), Value: g.expression(typ), Mutable: mutable}
+			g.define(name, typ, mutable)
+			return []ast.Statement{statement}
+		case 3, 4:
+			typ := types[g.rand.Intn(len(types))]
+			if targets := g.variables(typ, true); len(targets) > 0 {
+				target := targets[g.rand.Intn(len(targets))]
+				return []ast.Statement{&ast.ReassignStatement{Name: identifier(target.name), Operator: "=", Value: g.expression(typ)}}
+			}
+		case 5, 6:
+			return []ast.Statement{g.println()}
+		case 7:
+			if g.depth < maxDepth {
+				return []ast.Statement{&ast.ExpressionStatement{Expression: &ast.IfExpression{
+					Condition:   g.expression("bool"),
+					Consequence: g.block(),
+					Alternative: g.optionalBlock(),
+				}}}
+			}
+		case 8:
+			if g.depth < maxDepth && g.returnType == "" {
+				return g.loop()
+			}
+		case 9:
+			// leaving a loop or a function early, behind a condition so that the code after it runs too
+			var exit ast.Statement
+			switch {
+			case g.loops > 0 && g.rand.Intn(2) == 0:
+				exit = &ast.BreakStatement{}
+			case g.loops > 0:
+				exit = &ast.ContinueStatement{}
+			case g.returnType != "":
+				exit = &ast.ReturnStatement{ReturnValue: g.expression(g.returnType)}
+			default:
+				continue
+			}
+			return []ast.Statement{&ast.ExpressionStatement{Expression: &ast.IfExpression{
+				Condition:   g.expression("bool"),
+				Consequence: &ast.BlockStatement{Statements: []ast.Statement{exit}},
+			}}}
+		}
+	}
+}
+
+// loop counts a new counter up to a small bound, the counter is incremented first so that continue can't skip it
+func (g *Generator) loop() []ast.Statement {
+	counter := g.name("i")
+	g.define(counter, "int", false)
+	declaration := &ast.LetStatement{Name: identifier(counter), Value: integer(0), Mutable: true}
+	increment := &ast.ReassignStatement{Name: identifier(counter), Operator: "=", Value: infix(identifier(counter), "+", integer(1))}
+
+	g.loops++
+	g.scopes = append(g.scopes, nil)
+	body := &ast.BlockStatement{Statements: []ast.Statement{increment}}
+	for i := 1 + g.rand.Intn(3); i > 0; i-- {
+		body.Statements = append(body.Statements, g.statement()...)
+	}
+	if g.rand.Intn(2) == 0 {
+		body.Statements = append(body.Statements, g.alternatingDeclaration(counter)...)
+	}
+	var closures string
+	if g.rand.Intn(2) == 0 {
+		closures = g.name("c")
+		body.Statements = append(body.Statements, g.collectClosure(closures, counter)...)
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.loops--
+	loop := &ast.ForExpression{Condition: infix(identifier(counter), "<", integer(int64(1+g.rand.Intn(4)))), Consequence: body}
+	statements := []ast.Statement{declaration, &ast.ExpressionStatement{Expression: loop}}
+	if closures == "" {
+		return statements
+	}
+	collection := &ast.LetStatement{Name: identifier(closures), Value: &ast.ArrayLiteral{}, Mutable: true}
+	return append(append([]ast.Statement{collection}, statements...), g.callClosures(closures)...)
+}
+
+// alternatingDeclaration declares a variable whose type changes between iterations, the value an
+// iteration left behind doesn't constrain the declaration of the next one
+func (g *Generator) alternatingDeclaration(counter string) []ast.Statement {
+	first := g.rand.Intn(len(types))
+	second := (first + 1 + g.rand.Intn(len(types)-1)) % len(types)
+	name := g.name("w")
+	value := &ast.IfExpression{
+		Condition:   infix(infix(identifier(counter), "%", integer(2)), "==", integer(0)),
+		Consequence: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: g.expression(types[first])}}},
+		Alternative: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: g.expression(types[second])}}},
+	}
+	return []ast.Statement{
+		&ast.LetStatement{Name: identifier(name), Value: value},
+		&ast.ExpressionStatement{Expression: call("println", &ast.StringLiteral{Value: "%s"}, call("str", identifier(name)))},
+	}
+}
+
+// collectClosure pushes a closure over a variable of the current iteration to an array, which is
+// called after the loop. The variable differs between iterations, every closure has to keep its own.
+func (g *Generator) collectClosure(closures string, counter string) []ast.Statement {
+	captured := g.name("v")
+	declaration := &ast.LetStatement{Name: identifier(captured), Value: infix(identifier(counter), "*", g.expression("int")), Mutable: true}
+	g.define(captured, "int", true)
+	literal := &ast.FunctionLiteral{ReturnType: identifier("str"), Body: &ast.BlockStatement{}}
+	if g.rand.Intn(2) == 0 {
+		// closures share the variables they capture with the iteration
+		assignable := g.variables(types[g.rand.Intn(len(types))], true)
+		if len(assignable) == 0 || g.rand.Intn(2) == 0 {
+			assignable = []variable{{captured, "int", true}}
+		}
+		target := assignable[g.rand.Intn(len(assignable))]
+		literal.Body.Statements = append(literal.Body.Statements, &ast.ReassignStatement{Name: identifier(target.name), Operator: "=", Value: g.expression(target.typ)})
+	}
+	result := call("str", identifier(captured), g.expression(types[g.rand.Intn(len(types))]))
+	literal.Body.Statements = append(literal.Body.Statements, &ast.ExpressionStatement{Expression: result})
+	push := &ast.ReassignStatement{Name: identifier(closures), Operator: "=", Value: call("push", identifier(closures), literal)}
+	return []ast.Statement{declaration, push}
+}
+
+// callClosures prints the results of the closures a loop collected
+func (g *Generator) callClosures(closures string) []ast.Statement {
+	index := g.name("i")
+	closure := &ast.CallExpression{Function: &ast.IndexExpression{Left: identifier(closures), Index: identifier(index)}}
+	body := &ast.BlockStatement{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: call("println", &ast.StringLiteral{Value: "%s"}, closure)},
+		&ast.ReassignStatement{Name: identifier(index), Operator: "=", Value: infix(identifier(index), "+", integer(1))},
+	}}
+	return []ast.Statement{
+		&ast.LetStatement{Name: identifier(index), Value: integer(0), Mutable: true},
+		&ast.ExpressionStatement{Expression: &ast.ForExpression{Condition: infix(identifier(index), "<", call("len", identifier(closures))), Consequence: body}},
+	}
+}
+func (g *Generator) block() *ast.BlockStatement {
+	g.scopes = append(g.scopes, nil)
+	block := &ast.BlockStatement{}
+	for i := 1 + g.rand.Intn(3); i > 0; i-- {
+		block.Statements = append(block.Statements, g.statement()...)
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	return block
+}
+func (g *Generator) optionalBlock() *ast.BlockStatement {
+	if g.rand.Intn(2) == 0 {
+		return nil
+	}
+	return g.block()
+}
+
+// println prints one or two values
+func (g *Generator) println() ast.Statement {
+	args := []ast.Expression{&ast.StringLiteral{Value: "%s"}, g.expression(types[g.rand.Intn(len(types))])}
+	if g.rand.Intn(2) == 0 {
+		args[0] = &ast.StringLiteral{Value: "%s and %s"}
+		args = append(args, g.expression(types[g.rand.Intn(len(types))]))
+	}
+	return &ast.ExpressionStatement{Expression: call("println", args...)}
+}
+
+// expression generates an expression of a type
+func (g *Generator) expression(typ string) ast.Expression {
+	g.depth++
+	defer func() { g.depth-- }()
+	if g.depth >= maxDepth || g.rand.Intn(4) == 0 {
+		return g.leaf(typ)
+	}
+	if g.rand.Intn(8) == 0 {
+		if fn, ok := g.pickFunction(typ); ok {
+			args := make([]ast.Expression, len(fn.parameters))
+			for i, param := range fn.parameters {
+				args[i] = g.expression(param)
+			}
+			return call(fn.name, args...)
+		}
+	}
+	if g.rand.Intn(8) == 0 && typ != "array" {
+		return &ast.IfExpression{
+			Condition:   g.expression("bool"),
+			Consequence: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: g.expression(typ)}}},
+			Alternative: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: g.expression(typ)}}},
+		}
+	}
+	switch typ {
+	case "int":
+		switch g.rand.Intn(6) {
+		case 0:
+			return infix(g.expression("int"), []string{"+", "-", "*"}[g.rand.Intn(3)], g.expression("int"))
+		case 1:
+			// mostly divisors that aren't zero, so that programs get past it
+			return infix(g.expression("int"), "%", integer(int64(g.rand.Intn(6))))
+		case 2:
+			return &ast.PrefixExpression{Operator: "-", Right: g.expression("int")}
+		case 3:
+			return call("len", g.expression([]string{"str", "array"}[g.rand.Intn(2)]))
+		case 4:
+			return &ast.IndexExpression{Left: g.expression("array"), Index: integer(int64(g.rand.Intn(4)))}
+		default:
+			return call("int", call("str", g.expression("int")))
+		}
+	case "float":
+		switch g.rand.Intn(3) {
+		case 0:
+			return infix(g.expression("int"), "/", g.expression("int"))
+		case 1:
+			return infix(g.expression("float"), []string{"+", "-", "*"}[g.rand.Intn(3)], g.expression([]string{"int", "float"}[g.rand.Intn(2)]))
+		default:
+			return &ast.PrefixExpression{Operator: "-", Right: g.expression("float")}
+		}
+	case "bool":
+		switch g.rand.Intn(5) {
+		case 0:
+			return infix(g.expression("int"), []string{"<", ">", "<=", ">=", "==", "!="}[g.rand.Intn(6)], g.expression("int"))
+		case 1:
+			return infix(g.expression("str"), []string{"==", "!="}[g.rand.Intn(2)], g.expression("str"))
+		case 2:
+			return infix(g.expression("bool"), []string{"&&", "||", "==", "!="}[g.rand.Intn(4)], g.expression("bool"))
+		case 3:
+			return infix(g.expression("float"), []string{"<", ">="}[g.rand.Intn(2)], g.expression("int"))
+		default:
+			return &ast.PrefixExpression{Operator: "!", Right: g.expression("bool")}
+		}
+	case "str":
+		switch g.rand.Intn(3) {
+		case 0:
+			return infix(g.expression("str"), "+", g.expression("str"))
+		case 1:
+			return call("str", g.expression(types[g.rand.Intn(len(types))]))
+		default:
+			return g.leaf("str")
+		}
+	default:
+		switch g.rand.Intn(3) {
+		case 0:
+			return call("push", g.expression("array"), g.expression("int"))
+		case 1:
+			return call("remove", g.expression("array"), integer(int64(g.rand.Intn(3))))
+		default:
+			elements := make([]ast.Expression, g.rand.Intn(4))
+			for i := range elements {
+				elements[i] = g.expression("int")
+			}
+			return &ast.ArrayLiteral{Elements: elements}
+		}
+	}
+}
+
+// pickFunction picks a declared function returning typ
+func (g *Generator) pickFunction(typ string) (function, bool) {
+	var found []function
+	for _, fn := range g.functions {
+		if fn.returnType == typ {
+			found = append(found, fn)
+		}
+	}
+	if len(found) == 0 {
+		return function{}, false
+	}
+	return found[g.rand.Intn(len(found))], true
+}
+
+// leaf returns a variable or a literal
+func (g *Generator) leaf(typ string) ast.Expression {
+	if variables := g.variables(typ, false); len(variables) > 0 && g.rand.Intn(2) == 0 {
+		return identifier(variables[g.rand.Intn(len(variables))].name)
+	}
+	switch typ {
+	case "int":
+		return integer(int64(g.rand.Intn(20)))
+	case "float":
+		return &ast.FloatLiteral{Value: float64(g.rand.Intn(40)) / 4}
+	case "bool":
+		return &ast.BooleanLiteral{Value: g.rand.Intn(2) == 0}
+	case "str":
+		return &ast.StringLiteral{Value: []string{"", "a", "kol", "x y", "7"}[g.rand.Intn(5)]}
+	default:
+		return &ast.ArrayLiteral{Elements: []ast.Expression{integer(int64(g.rand.Intn(10)))}}
+	}
+}
+
+func identifier(name string) *ast.Identifier {
+	return &ast.Identifier{Value: name}
+}
+func integer(value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Value: value}
+}
+func infix(left ast.Expression, operator string, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{Left: left, Operator: operator, Right: right}
+}
+func call(name string, args ...ast.Expression) *ast.CallExpression {
+	return &ast.CallExpression{Function: identifier(name), Arguments: args}
+}
+
+// Source prints a program built by the Generator as source code. The String methods of the ast
+// are meant for debugging and leave out the braces of blocks.
+func Source(program *ast.Program) string {
+	var out strings.Builder
+	for _, statement := range program.Statements {
+		writeStatement(&out, statement, 0)
+	}
+	return out.String()
+}
+func writeStatement(out *strings.Builder, statement ast.Statement, indent int) {
+	out.WriteString(strings.Repeat("    ", indent))
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		out.WriteString("let ")
+		if statement.Mutable {
+			out.WriteString("mut ")
+		}
+		out.WriteString(statement.Name.Value + " = " + expression(statement.Value, indent))
+	case *ast.ReassignStatement:
+		out.WriteString(statement.Name.Value + " " + statement.Operator + " " + expression(statement.Value, indent))
+	case *ast.ReturnStatement:
+		out.WriteString("return " + expression(statement.ReturnValue, indent))
+	case *ast.BreakStatement:
+		out.WriteString("break")
+	case *ast.ContinueStatement:
+		out.WriteString("continue")
+	case *ast.ExpressionStatement:
+		if exp, ok := statement.Expression.(*ast.IfExpression); ok {
+			out.WriteString(ifExpression(exp, indent))
+		} else {
+			out.WriteString(expression(statement.Expression, indent))
+		}
+	default:
+		panic(fmt.Sprintf("can't print %T", statement))
+	}
+	out.WriteString(";\n")
+}
+func block(block *ast.BlockStatement, indent int) string {
+	var out strings.Builder
+	out.WriteString("{\n")
+	for _, statement := range block.Statements {
+		writeStatement(&out, statement, indent+1)
+	}
+	out.WriteString(strings.Repeat("    ", indent) + "}")
+	return out.String()
+}
+func expression(exp ast.Expression, indent int) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Value
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(exp.Value, 10)
+	case *ast.FloatLiteral:
+		return strconv.FormatFloat(exp.Value, 'f', 2, 64)
+	case *ast.BooleanLiteral:
+		return strconv.FormatBool(exp.Value)
+	case *ast.StringLiteral:
+		return `"` + exp.Value + `"`
+	case *ast.ArrayLiteral:
+		elements := make([]string, len(exp.Elements))
+		for i, element := range exp.Elements {
+			elements[i] = expression(element, indent)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *ast.PrefixExpression:
+		return "(" + exp.Operator + expression(exp.Right, indent) + ")"
+	case *ast.InfixExpression:
+		return "(" + expression(exp.Left, indent) + " " + exp.Operator + " " + expression(exp.Right, indent) + ")"
+	case *ast.IndexExpression:
+		return expression(exp.Left, indent) + "[" + expression(exp.Index, indent) + "]"
+	case *ast.CallExpression:
+		args := make([]string, len(exp.Arguments))
+		for i, arg := range exp.Arguments {
+			args[i] = expression(arg, indent)
+		}
+		return expression(exp.Function, indent) + "(" + strings.Join(args, ", ") + ")"
+	case *ast.IfExpression:
+		return "(" + ifExpression(exp, indent) + ")"
+	case *ast.ForExpression:
+		return "for " + expression(exp.Condition, indent) + " " + block(exp.Consequence, indent)
+	case *ast.FunctionLiteral:
+		params := make([]string, len(exp.Parameters))
+		for i, param := range exp.Parameters {
+			params[i] = param.Ident.Value + " " + param.Type.Value
+		}
+		return "fun(" + strings.Join(params, ", ") + ") " + exp.ReturnType.Value + " " + block(exp.Body, indent)
+	}
+	panic(fmt.Sprintf("can't print %T", exp))
+}
+func ifExpression(exp *ast.IfExpression, indent int) string {
+	out := "if " + expression(exp.Condition, indent) + " " + block(exp.Consequence, indent)
+	if exp.Alternative != nil {
+		out += " else " + block(exp.Alternative, indent)
+	}
+	return out
+}
@@ -0,0 +1,515 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kol/code"
+	"kol/compiler"
+	"kol/debugger"
+	"kol/diagnostic"
+	"kol/lexer"
+	"kol/object"
+	"kol/parser"
+	"kol/protocol"
+	"kol/typecheck"
+	"kol/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Server is a debug adapter: it runs a program on the VM for a client like an editor and
+// pauses it at the breakpoints and steps the client asks for.
+// Messages are read from in and the responses and events written to out.
+type Server struct {
+	in *bufio.Reader
+
+	// guards out and seq, the program sends events from its own goroutine
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	// guards the state shared with the goroutine running the program
+	mu      sync.Mutex
+	stepper *debugger.Stepper
+	// the VM while the program is paused, nil while it runs
+	paused *vm.VM
+	// why the program pauses next, reported to the client
+	reason string
+	// the expandable values shown while the program is paused, a reference is an index + 1
+	references []func() []Variable
+	stopping   bool
+
+	// resumes the paused program, false stops it
+	resume chan bool
+	// closed once the program ended
+	done chan struct{}
+
+	machine *vm.VM
+	globals []compiler.Symbol
+	// the lines instructions were compiled from by file, breakpoints elsewhere never pause
+	lines      map[string]map[int]bool
+	noDebug    bool
+	configured bool
+	started    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		stepper: debugger.NewStepper(),
+		reason:  "entry",
+		resume:  make(chan bool),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run handles requests until the client disconnects or closes the connection
+func (s *Server) Run() error {
+	defer s.stop()
+	for {
+		content, err := protocol.ReadMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if req.Command == "disconnect" {
+			s.stop()
+			s.respond(req, nil, nil)
+			return nil
+		}
+		body, err := s.handle(req)
+		s.respond(req, body, err)
+		if err == nil {
+			s.afterResponse(req)
+		}
+	}
+}
+
+func (s *Server) handle(req request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{SupportsConfigurationDoneRequest: true}, nil
+	case "launch":
+		var args LaunchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"breakpoints": s.setBreakpoints(args)}, nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		frames, err := s.stackTrace()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args ScopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		scopes, err := s.scopes(args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scopes": scopes}, nil
+	case "variables":
+		var args VariablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		variables, err := s.variables(args.VariablesReference)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"variables": variables}, nil
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.whilePaused()
+	case "next", "stepIn", "stepOut":
+		return nil, s.whilePaused()
+	}
+	return nil, fmt.Errorf("unsupported command %s", req.Command)
+}
+
+// afterResponse does the part of a request that has to follow its response, like the events it causes
+func (s *Server) afterResponse(req request) {
+	switch req.Command {
+	case "initialize":
+		s.sendEvent("initialized", nil)
+	case "continue":
+		s.continueProgram(s.stepper.Continue, "breakpoint")
+	case "next":
+		s.continueProgram(s.stepper.StepOver, "step")
+	case "stepIn":
+		s.continueProgram(s.stepper.StepIn, "step")
+	case "stepOut":
+		s.continueProgram(s.stepper.StepOut, "step")
+	}
+	if s.configured && s.machine != nil && !s.started {
+		s.start()
+	}
+}
+
+func (s *Server) respond(req request, body interface{}, err error) {
+	res := response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		res.Message = err.Error()
+	}
+	s.send(&res, &res.Seq)
+}
+func (s *Server) sendEvent(name string, body interface{}) {
+	e := event{Type: "event", Event: name, Body: body}
+	s.send(&e, &e.Seq)
+}
+func (s *Server) send(message interface{}, seq *int) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	*seq = s.seq
+	protocol.WriteMessage(s.out, message)
+}
+
+// launch compiles the program, it starts once the client sent its configuration
+func (s *Server) launch(args LaunchArguments) error {
+	if s.machine != nil {
+		return fmt.Errorf("a program is already launched")
+	}
+	fileName, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	input := string(content)
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) == 0 {
+		diagnostics = typecheck.Check(program)
+	}
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	comp.SetFileName(fileName)
+	if len(diagnostics) == 0 {
+		if err := comp.Compile(program); err != nil {
+			diagnostics = diagnostic.FromError(err, diagnostic.CompileError)
+		}
+	}
+	if len(diagnostics) != 0 {
+		s.reportDiagnostics(diagnostics, input, fileName)
+		return fmt.Errorf("%s can't be compiled", args.Program)
+	}
+
+	bytecode := comp.Bytecode()
+	s.machine = vm.New(bytecode)
+	s.globals = symbolTable.Definitions()
+	s.noDebug = args.NoDebug
+	s.lines = codeLines(bytecode)
+	if !args.StopOnEntry {
+		s.stepper.Continue()
+		s.reason = "breakpoint"
+	}
+	return nil
+}
+
+// codeLines collects the lines of every file instructions were compiled from
+func codeLines(bytecode *compiler.Bytecode) map[string]map[int]bool {
+	lines := map[string]map[int]bool{}
+	add := func(sm code.SourceMap) {
+		if lines[sm.File] == nil {
+			lines[sm.File] = map[int]bool{}
+		}
+		for _, entry := range sm.Entries {
+			lines[sm.File][entry.Position.Line] = true
+		}
+	}
+	add(bytecode.SourceMap)
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			add(fn.SourceMap)
+		}
+	}
+	return lines
+}
+
+// start runs the program in its own goroutine, its output is sent to the client as events
+func (s *Server) start() {
+	s.started = true
+	// stdin carries the protocol, the program reads no input
+	s.machine.SetIO(&object.IO{
+		In:  strings.NewReader(""),
+		Out: &outputWriter{server: s, category: "stdout"},
+		Err: &outputWriter{server: s, category: "stderr"},
+	})
+	if !s.noDebug {
+		s.machine.SetHook(s.hook)
+	}
+	go func() {
+		exitCode := 0
+		err := s.machine.Run()
+		if err != nil && err != vm.ErrStopped {
+			s.sendEvent("output", OutputEvent{Category: "stderr", Output: err.Error() + "\n"})
+			exitCode = 1
+		}
+		s.sendEvent("exited", ExitedEvent{ExitCode: exitCode})
+		s.sendEvent("terminated", nil)
+		close(s.done)
+	}()
+}
+
+// hook runs before every instruction of the program and blocks while the program is paused
+func (s *Server) hook(machine *vm.VM) error {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return vm.ErrStopped
+	}
+	_, pause := s.stepper.Pause(machine)
+	if !pause {
+		s.mu.Unlock()
+		return nil
+	}
+	s.paused = machine
+	s.references = nil
+	reason := s.reason
+	s.mu.Unlock()
+
+	s.sendEvent("stopped", StoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+	if !<-s.resume {
+		return vm.ErrStopped
+	}
+	return nil
+}
+
+// whilePaused fails for the requests that need a paused program
+func (s *Server) whilePaused() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == nil {
+		return fmt.Errorf("the program isn't paused")
+	}
+	return nil
+}
+
+// continueProgram resumes the paused program after preparing the stepper for where it pauses next
+func (s *Server) continueProgram(step func(), reason string) {
+	s.mu.Lock()
+	step()
+	s.reason = reason
+	s.paused = nil
+	s.mu.Unlock()
+	s.resume <- true
+}
+
+// stop ends the program if it is running and waits for it
+func (s *Server) stop() {
+	if !s.started {
+		return
+	}
+	s.mu.Lock()
+	s.stopping = true
+	paused := s.paused != nil
+	s.paused = nil
+	s.mu.Unlock()
+	if paused {
+		s.resume <- false
+	}
+	<-s.done
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) []Breakpoint {
+	file := args.Source.Path
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stepper.ClearBreakpoints(file)
+	breakpoints := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		breakpoint := Breakpoint{Verified: true, Line: bp.Line}
+		// lines of files that weren't compiled yet can't be checked
+		if lines, ok := s.lines[file]; ok && !lines[bp.Line] {
+			breakpoint.Verified = false
+			breakpoint.Message = "No code on this line"
+		}
+		s.stepper.SetBreakpoint(debugger.Location{File: file, Line: bp.Line})
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	return breakpoints
+}
+
+func (s *Server) stackTrace() ([]StackFrame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == nil {
+		return nil, fmt.Errorf("the program isn't paused")
+	}
+	frames := []StackFrame{}
+	for i, entry := range s.paused.CallStack() {
+		frame := StackFrame{ID: i, Name: entry.Function}
+		if entry.File != "" {
+			frame.Source = &Source{Name: filepath.Base(entry.File), Path: entry.File}
+		}
+		if entry.Position != nil {
+			frame.Line, frame.Column = entry.Position.Line, entry.Position.Column
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// scopes returns the variables a frame of the call stack can see, its locals, the variables
+// its closure captured and the globals
+func (s *Server) scopes(frame int) ([]Scope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == nil {
+		return nil, fmt.Errorf("the program isn't paused")
+	}
+	if frame < 0 || frame >= s.paused.Depth() {
+		return nil, fmt.Errorf("unknown frame %d", frame)
+	}
+	machine := s.paused
+	globals := func() []vm.Variable {
+		variables := []vm.Variable{}
+		for _, symbol := range s.globals {
+			variables = append(variables, vm.Variable{Name: symbol.Name, Value: machine.Global(symbol.Index)})
+		}
+		return variables
+	}
+	return []Scope{
+		{Name: "Locals", VariablesReference: s.reference(func() []vm.Variable { return machine.Locals(frame) })},
+		{Name: "Closure", VariablesReference: s.reference(func() []vm.Variable { return machine.FreeVariables(frame) })},
+		{Name: "Globals", VariablesReference: s.reference(globals), Expensive: true},
+	}, nil
+}
+func (s *Server) variables(reference int) ([]Variable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == nil {
+		return nil, fmt.Errorf("the program isn't paused")
+	}
+	if reference < 1 || reference > len(s.references) {
+		return nil, fmt.Errorf("unknown variables reference %d", reference)
+	}
+	return s.references[reference-1](), nil
+}
+
+// reference registers variables that are only collected once the client expands them
+func (s *Server) reference(variables func() []vm.Variable) int {
+	s.references = append(s.references, func() []Variable {
+		converted := []Variable{}
+		for _, v := range variables() {
+			converted = append(converted, s.variable(v.Name, v.Value))
+		}
+		return converted
+	})
+	return len(s.references)
+}
+
+// variable converts a value for the client, arrays, hashes and structs can be expanded into their elements
+func (s *Server) variable(name string, obj object.Object) Variable {
+	if obj == nil {
+		return Variable{Name: name, Value: "<unset>"}
+	}
+	v := Variable{Name: name, Value: obj.Inspect(), Type: string(obj.Type())}
+	switch obj := obj.(type) {
+	case *object.Array:
+		if len(obj.Elements) != 0 {
+			v.VariablesReference = s.reference(func() []vm.Variable { return elements(obj) })
+		}
+	case *object.Hash:
+		if len(obj.Pairs) != 0 {
+			v.VariablesReference = s.reference(func() []vm.Variable { return pairs(obj) })
+		}
+	case *object.Struct:
+		if len(obj.Fields) != 0 {
+			v.VariablesReference = s.reference(func() []vm.Variable { return fields(obj) })
+		}
+	}
+	return v
+}
+func elements(array *object.Array) []vm.Variable {
+	variables := []vm.Variable{}
+	for i, el := range array.Elements {
+		variables = append(variables, vm.Variable{Name: fmt.Sprintf("[%d]", i), Value: el})
+	}
+	return variables
+}
+
+// pairs returns the entries of a hash ordered by their keys
+func pairs(hash *object.Hash) []vm.Variable {
+	variables := []vm.Variable{}
+	for _, pair := range hash.Pairs {
+		variables = append(variables, vm.Variable{Name: pair.Key.Inspect(), Value: pair.Value})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+	return variables
+}
+func fields(s *object.Struct) []vm.Variable {
+	variables := []vm.Variable{}
+	for _, field := range s.Definition.Fields {
+		variables = append(variables, vm.Variable{Name: field.Name, Value: s.Fields[field.Name]})
+	}
+	return variables
+}
+func (s *Server) reportDiagnostics(diagnostics []*diagnostic.Diagnostic, input string, fileName string) {
+	var out strings.Builder
+	for _, d := range diagnostics {
+		if d.Span.File == "" {
+			d.Span.File = fileName
+		}
+		source := input
+		if d.Span.File != fileName {
+			content, _ := os.ReadFile(d.Span.File)
+			source = string(content)
+		}
+		out.WriteString(d.Render(source) + "\n")
+	}
+	s.sendEvent("output", OutputEvent{Category: "stderr", Output: out.String()})
+}
+
+// outputWriter sends what the program prints to the client
+type outputWriter struct {
+	server   *Server
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.server.sendEvent("output", OutputEvent{Category: w.category, Output: string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,287 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"kol/protocol"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client is a headless editor talking to a server over pipes
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	seq      int
+	messages chan message
+	// messages received while waiting for another one
+	pending []message
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	go func() {
+		NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	c := &client{t: t, w: clientOut, messages: make(chan message, 100)}
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			content, err := protocol.ReadMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg message
+			json.Unmarshal(content, &msg)
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+func (c *client) request(command string, args interface{}) {
+	c.seq++
+	protocol.WriteMessage(c.w, map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+}
+
+// next waits for the first message matching the type and its command or event name
+func (c *client) next(typ string, name string) message {
+	c.t.Helper()
+	for i, msg := range c.pending {
+		if msg.Type == typ && (msg.Command == name || msg.Event == name) {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return msg
+		}
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("connection closed while waiting for %s %s", typ, name)
+			}
+			if msg.Type == typ && (msg.Command == name || msg.Event == name) {
+				return msg
+			}
+			c.pending = append(c.pending, msg)
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s %s", typ, name)
+		}
+	}
+}
+
+// call sends a request and decodes the body of its successful response into body
+func (c *client) call(command string, args interface{}, body interface{}) {
+	c.t.Helper()
+	c.request(command, args)
+	res := c.next("response", command)
+	if !res.Success {
+		c.t.Fatalf("%s failed: %s", command, res.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(res.Body, body); err != nil {
+			c.t.Fatalf("invalid body of %s: %s", command, err)
+		}
+	}
+}
+func (c *client) stopped(reason string) {
+	c.t.Helper()
+	var e StoppedEvent
+	json.Unmarshal(c.next("event", "stopped").Body, &e)
+	if e.Reason != reason {
+		c.t.Errorf("expected to stop for %s, got %s", reason, e.Reason)
+	}
+}
+func (c *client) stackTrace() []StackFrame {
+	c.t.Helper()
+	var body struct {
+		StackFrames []StackFrame `json:"stackFrames"`
+	}
+	c.call("stackTrace", StackTraceArguments{ThreadID: threadID}, &body)
+	return body.StackFrames
+}
+func (c *client) scopes(frame int) []Scope {
+	c.t.Helper()
+	var body struct {
+		Scopes []Scope `json:"scopes"`
+	}
+	c.call("scopes", ScopesArguments{FrameID: frame}, &body)
+	return body.Scopes
+}
+func (c *client) variables(reference int) map[string]Variable {
+	c.t.Helper()
+	var body struct {
+		Variables []Variable `json:"variables"`
+	}
+	c.call("variables", VariablesArguments{VariablesReference: reference}, &body)
+	variables := map[string]Variable{}
+	for _, v := range body.Variables {
+		variables[v.Name] = v
+	}
+	return variables
+}
+
+const program = `let base = 10
+fun add(a int, b int) int {
+    let sum = a + b + base
+    return sum
+}
+let list = [1, [2, 3]]
+let h = {"b": 2, "a": 1}
+println("%s", add(1, 2))
+`
+
+func writeProgram(t *testing.T, content string) string {
+	fileName := filepath.Join(t.TempDir(), "main.kol")
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func expectValues(t *testing.T, variables map[string]Variable, expected map[string]string) {
+	t.Helper()
+	for name, value := range expected {
+		if variables[name].Value != value {
+			t.Errorf("expected %s = %s, got %+v", name, value, variables[name])
+		}
+	}
+}
+
+func TestDebugSession(t *testing.T) {
+	fileName := writeProgram(t, program)
+	c := newClient(t)
+	c.call("initialize", map[string]interface{}{"adapterID": "kol"}, nil)
+	c.next("event", "initialized")
+	c.call("launch", LaunchArguments{Program: fileName}, nil)
+
+	var breakpoints struct {
+		Breakpoints []Breakpoint `json:"breakpoints"`
+	}
+	c.call("setBreakpoints", SetBreakpointsArguments{
+		Source:      Source{Path: fileName},
+		Breakpoints: []SourceBreakpoint{{Line: 3}, {Line: 5}},
+	}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 2 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[1].Verified {
+		t.Errorf("expected only the breakpoint on line 3 to be verified, got %+v", breakpoints.Breakpoints)
+	}
+	c.call("configurationDone", nil, nil)
+	c.stopped("breakpoint")
+
+	var threads struct {
+		Threads []Thread `json:"threads"`
+	}
+	c.call("threads", nil, &threads)
+	if len(threads.Threads) != 1 || threads.Threads[0].ID != threadID {
+		t.Errorf("expected a single thread, got %+v", threads.Threads)
+	}
+
+	frames := c.stackTrace()
+	if len(frames) != 2 || frames[0].Name != "add" || frames[0].Line != 3 || frames[1].Name != "<main>" || frames[1].Line != 8 {
+		t.Fatalf("wrong stack trace %+v", frames)
+	}
+	if frames[0].Source == nil || frames[0].Source.Path != fileName {
+		t.Errorf("wrong source %+v", frames[0].Source)
+	}
+
+	scopes := c.scopes(0)
+	if len(scopes) != 3 || scopes[0].Name != "Locals" || scopes[1].Name != "Closure" || scopes[2].Name != "Globals" {
+		t.Fatalf("wrong scopes %+v", scopes)
+	}
+	expectValues(t, c.variables(scopes[0].VariablesReference), map[string]string{"a": "1", "b": "2", "sum": "<unset>"})
+
+	globals := c.variables(c.scopes(1)[2].VariablesReference)
+	expectValues(t, globals, map[string]string{"base": "10", "list": "[1, [2, 3]]"})
+	list := c.variables(globals["list"].VariablesReference)
+	expectValues(t, list, map[string]string{"[0]": "1", "[1]": "[2, 3]"})
+	if list["[0]"].VariablesReference != 0 {
+		t.Errorf("integers can't be expanded, got %+v", list["[0]"])
+	}
+	expectValues(t, c.variables(list["[1]"].VariablesReference), map[string]string{"[0]": "2", "[1]": "3"})
+	expectValues(t, c.variables(globals["h"].VariablesReference), map[string]string{"a": "1", "b": "2"})
+
+	c.call("next", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step")
+	if frames := c.stackTrace(); frames[0].Line != 4 {
+		t.Errorf("expected to step to line 4, got %+v", frames[0])
+	}
+	expectValues(t, c.variables(c.scopes(0)[0].VariablesReference), map[string]string{"sum": "13"})
+
+	c.call("stepOut", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step")
+	if frames := c.stackTrace(); len(frames) != 1 || frames[0].Line != 8 {
+		t.Errorf("expected to step out to line 8, got %+v", frames)
+	}
+	expectValues(t, c.variables(c.scopes(0)[2].VariablesReference), map[string]string{"h": "{a: 1, b: 2}"})
+
+	c.call("continue", map[string]int{"threadId": threadID}, nil)
+	var output OutputEvent
+	json.Unmarshal(c.next("event", "output").Body, &output)
+	if output.Category != "stdout" || output.Output != "13\n" {
+		t.Errorf("expected the program to print 13, got %+v", output)
+	}
+	var exited ExitedEvent
+	json.Unmarshal(c.next("event", "exited").Body, &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("expected exit code 0, got %d", exited.ExitCode)
+	}
+	c.next("event", "terminated")
+	c.call("disconnect", nil, nil)
+}
+
+func TestStopOnEntryAndDisconnect(t *testing.T) {
+	fileName := writeProgram(t, program)
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	c.call("launch", LaunchArguments{Program: fileName, StopOnEntry: true}, nil)
+	c.call("configurationDone", nil, nil)
+	c.stopped("entry")
+	if frames := c.stackTrace(); frames[0].Line != 1 {
+		t.Errorf("expected to stop on line 1, got %+v", frames[0])
+	}
+	c.call("stepIn", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step")
+	c.call("disconnect", nil, nil)
+	c.next("event", "terminated")
+}
+
+func TestLaunchErrors(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	c.request("launch", LaunchArguments{Program: writeProgram(t, "let x = 1 +")})
+	if res := c.next("response", "launch"); res.Success {
+		t.Errorf("expected launching a program with syntax errors to fail")
+	}
+	var output OutputEvent
+	json.Unmarshal(c.next("event", "output").Body, &output)
+	if output.Category != "stderr" || output.Output == "" {
+		t.Errorf("expected the syntax error as output, got %+v", output)
+	}
+
+	c.request("stackTrace", StackTraceArguments{ThreadID: threadID})
+	if res := c.next("response", "stackTrace"); res.Success {
+		t.Errorf("expected stackTrace to fail without a paused program")
+	}
+	c.request("evaluate", nil)
+	if res := c.next("response", "evaluate"); res.Success || res.Message != "unsupported command evaluate" {
+		t.Errorf("expected evaluate to be unsupported, got %+v", res)
+	}
+}
@@ -0,0 +1,325 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"kol/compiler"
+	"kol/object"
+	"kol/vm"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(debug) "
+
+type mode int
+
+const (
+	// pause at the next line that runs
+	stepInto mode = iota
+	// pause at the next line of the same call or one of its callers
+	stepOver
+	// pause once the current call returned
+	stepOut
+	// pause at breakpoints only
+	running
+)
+
+// Location is a line of a source file
+type Location struct {
+	File string
+	Line int
+}
+
+// Stepper decides where a program pauses, at breakpoints or where a step ends.
+// Only entering a line can pause, however many instructions the line has.
+type Stepper struct {
+	breakpoints map[Location]bool
+	mode        mode
+	// line and call depth the program was paused at last, steps are relative to them
+	from  Location
+	depth int
+	// line and call depth of the last instruction, a line is entered when one of them changes
+	last      Location
+	lastDepth int
+}
+
+// NewStepper returns a stepper that pauses before the first line
+func NewStepper() *Stepper {
+	return &Stepper{breakpoints: make(map[Location]bool), mode: stepInto}
+}
+
+// Pause is called before every instruction and reports whether the program has to pause at the line it is on
+func (s *Stepper) Pause(machine *vm.VM) (Location, bool) {
+	file, pos, ok := machine.Position()
+	if !ok {
+		return Location{}, false
+	}
+	current := Location{File: file, Line: pos.Line}
+	depth := machine.Depth()
+	if current == s.last && depth == s.lastDepth {
+		return current, false
+	}
+	// returning to the rest of a line doesn't hit its breakpoint again
+	returned := depth < s.lastDepth
+	s.last, s.lastDepth = current, depth
+
+	pause := s.breakpoints[current] && !returned
+	switch s.mode {
+	case stepInto:
+		pause = pause || current != s.from || depth != s.depth
+	case stepOver:
+		pause = pause || depth < s.depth || depth == s.depth && current != s.from
+	case stepOut:
+		pause = pause || depth < s.depth
+	}
+	if pause {
+		s.from, s.depth = current, depth
+	}
+	return current, pause
+}
+
+// Current returns the line the program is on
+func (s *Stepper) Current() Location {
+	return s.last
+}
+
+func (s *Stepper) Continue() { s.mode = running }
+func (s *Stepper) StepIn()   { s.mode = stepInto }
+func (s *Stepper) StepOver() { s.mode = stepOver }
+func (s *Stepper) StepOut()  { s.mode = stepOut }
+
+func (s *Stepper) SetBreakpoint(loc Location) {
+	s.breakpoints[loc] = true
+}
+
+// ClearBreakpoint removes a breakpoint and reports whether there was one
+func (s *Stepper) ClearBreakpoint(loc Location) bool {
+	ok := s.breakpoints[loc]
+	delete(s.breakpoints, loc)
+	return ok
+}
+
+// ClearBreakpoints removes all breakpoints of a file
+func (s *Stepper) ClearBreakpoints(file string) {
+	for loc := range s.breakpoints {
+		if loc.File == file {
+			delete(s.breakpoints, loc)
+		}
+	}
+}
+func (s *Stepper) HasBreakpoint(loc Location) bool {
+	return s.breakpoints[loc]
+}
+
+// Debugger pauses a program running on the VM at breakpoints or after steps and lets the user
+// inspect it from a console. It is attached to a VM with SetHook(d.Hook).
+type Debugger struct {
+	in  *bufio.Scanner
+	out io.Writer
+
+	fileName string
+	// the lines of the debugged files by name, imported files are read when they are listed
+	sources map[string][]string
+	// the global variables of the main program
+	globals []compiler.Symbol
+
+	stepper *Stepper
+}
+
+// New creates a debugger for the program in fileName with the given source, which pauses before its first line
+func New(in io.Reader, out io.Writer, fileName string, source string, globals []compiler.Symbol) *Debugger {
+	return &Debugger{
+		in:       bufio.NewScanner(in),
+		out:      out,
+		fileName: fileName,
+		sources:  map[string][]string{fileName: strings.Split(source, "\n")},
+		globals:  globals,
+		stepper:  NewStepper(),
+	}
+}
+
+// Hook is called by the VM before every instruction and opens the console where the program pauses
+func (d *Debugger) Hook(machine *vm.VM) error {
+	loc, pause := d.stepper.Pause(machine)
+	if !pause {
+		return nil
+	}
+	d.printLine(loc)
+	return d.console(machine)
+}
+
+// console reads commands until one of them resumes the program
+func (d *Debugger) console(machine *vm.VM) error {
+	for {
+		fmt.Fprint(d.out, PROMPT)
+		if !d.in.Scan() {
+			return vm.ErrStopped
+		}
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := fields[0], fields[1:]
+		switch command {
+		case "c", "continue":
+			d.stepper.Continue()
+			return nil
+		case "s", "step":
+			d.stepper.StepIn()
+			return nil
+		case "n", "next":
+			d.stepper.StepOver()
+			return nil
+		case "o", "out":
+			d.stepper.StepOut()
+			return nil
+		case "q", "quit":
+			return vm.ErrStopped
+		case "b", "break":
+			d.setBreakpoint(args, true)
+		case "d", "delete":
+			d.setBreakpoint(args, false)
+		case "bt", "stack":
+			d.printStack(machine)
+		case "locals":
+			d.printVariables(machine.Locals(0))
+		case "free":
+			d.printVariables(machine.FreeVariables(0))
+		case "globals":
+			d.printVariables(d.globalVariables(machine))
+		case "p", "print":
+			d.printVariable(machine, args)
+		case "l", "list":
+			d.printSource(d.stepper.Current())
+		case "h", "help":
+			io.WriteString(d.out, help)
+		default:
+			fmt.Fprintf(d.out, "Unknown command %s, type help for a list of commands\n", command)
+		}
+	}
+}
+
+const help = `c, continue     run until the next breakpoint
+s, step         run until the next line, entering calls
+n, next         run until the next line of the current call
+o, out          run until the current call returns
+b, break LINE   pause at a line, use FILE:LINE for other files
+d, delete LINE  remove a breakpoint
+bt, stack       show the active calls
+locals          show the local variables of the current call
+free            show the variables the current closure captured
+globals         show the global variables
+p, print NAME   show a variable
+l, list         show the source around the current line
+q, quit         stop the program
+`
+
+func (d *Debugger) setBreakpoint(args []string, set bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(d.out, "Expected a breakpoint as LINE or FILE:LINE")
+		return
+	}
+	loc := Location{File: d.fileName}
+	line := args[0]
+	if i := strings.LastIndex(line, ":"); i >= 0 {
+		loc.File, line = line[:i], line[i+1:]
+	}
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 {
+		fmt.Fprintf(d.out, "Invalid line %s\n", line)
+		return
+	}
+	loc.Line = n
+	if set {
+		d.stepper.SetBreakpoint(loc)
+		fmt.Fprintf(d.out, "Breakpoint set at %s:%d\n", loc.File, loc.Line)
+	} else if d.stepper.ClearBreakpoint(loc) {
+		fmt.Fprintf(d.out, "Breakpoint at %s:%d deleted\n", loc.File, loc.Line)
+	} else {
+		fmt.Fprintf(d.out, "No breakpoint at %s:%d\n", loc.File, loc.Line)
+	}
+}
+
+func (d *Debugger) printStack(machine *vm.VM) {
+	for i, entry := range machine.CallStack() {
+		fmt.Fprintf(d.out, "#%d %s", i, entry.Function)
+		if entry.Position != nil {
+			fmt.Fprintf(d.out, " (%s:%d:%d)", entry.File, entry.Position.Line, entry.Position.Column)
+		}
+		fmt.Fprintln(d.out)
+	}
+}
+func (d *Debugger) globalVariables(machine *vm.VM) []vm.Variable {
+	globals := []vm.Variable{}
+	for _, symbol := range d.globals {
+		globals = append(globals, vm.Variable{Name: symbol.Name, Value: machine.Global(symbol.Index)})
+	}
+	return globals
+}
+func (d *Debugger) printVariables(variables []vm.Variable) {
+	if len(variables) == 0 {
+		fmt.Fprintln(d.out, "No variables")
+	}
+	for _, v := range variables {
+		fmt.Fprintf(d.out, "%s = %s\n", v.Name, inspect(v.Value))
+	}
+}
+
+// printVariable shows the variable a name refers to in the current call, like the compiler resolves it
+func (d *Debugger) printVariable(machine *vm.VM, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(d.out, "Expected the name of a variable")
+		return
+	}
+	scopes := [][]vm.Variable{machine.Locals(0), machine.FreeVariables(0), d.globalVariables(machine)}
+	for _, variables := range scopes {
+		for _, v := range variables {
+			if v.Name == args[0] {
+				fmt.Fprintf(d.out, "%s = %s\n", v.Name, inspect(v.Value))
+				return
+			}
+		}
+	}
+	fmt.Fprintf(d.out, "Variable %s is not defined\n", args[0])
+}
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<unset>"
+	}
+	return obj.Inspect()
+}
+
+func (d *Debugger) printLine(loc Location) {
+	fmt.Fprintf(d.out, "Paused at %s:%d\n", loc.File, loc.Line)
+	lines := d.source(loc.File)
+	if loc.Line <= len(lines) {
+		fmt.Fprintf(d.out, "%4d | %s\n", loc.Line, lines[loc.Line-1])
+	}
+}
+
+// printSource lists the lines around a location, marking the location and breakpoints
+func (d *Debugger) printSource(loc Location) {
+	lines := d.source(loc.File)
+	for n := max(loc.Line-3, 1); n <= min(loc.Line+3, len(lines)); n++ {
+		marker := " "
+		if d.stepper.HasBreakpoint(Location{File: loc.File, Line: n}) {
+			marker = "*"
+		}
+		if n == loc.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(d.out, "%s %4d | %s\n", marker, n, lines[n-1])
+	}
+}
+func (d *Debugger) source(file string) []string {
+	lines, ok := d.sources[file]
+	if !ok {
+		content, _ := os.ReadFile(file)
+		lines = strings.Split(string(content), "\n")
+		d.sources[file] = lines
+	}
+	return lines
+}
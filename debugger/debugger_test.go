@@ -0,0 +1,117 @@
+package debugger
+
+import (
+	"bytes"
+	"kol/compiler"
+	"kol/lexer"
+	"kol/object"
+	"kol/parser"
+	"kol/vm"
+	"strings"
+	"testing"
+)
+
+const program = `let base = 10
+fun add(a int, b int) int {
+    let sum = a + b + base
+    return sum
+}
+let make = fun() fn {
+    let mut count = 0
+    fun() int { count += 1; count }
+}
+let counter = make()
+counter()
+add(1, 2)
+`
+
+// debug runs the program in a debugger fed with the given commands and returns what it printed
+func debug(t *testing.T, commands ...string) (string, error) {
+	t.Helper()
+	p := parser.New(lexer.New(program))
+	parsed := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	comp.SetFileName("main.kol")
+	if err := comp.Compile(parsed); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	d := New(in, &out, "main.kol", program, symbolTable.Definitions())
+	machine := vm.New(comp.Bytecode())
+	machine.SetHook(d.Hook)
+	err := machine.Run()
+	return out.String(), err
+}
+
+func TestDebugger(t *testing.T) {
+	tests := []struct {
+		commands []string
+		expected []string
+		stopped  bool
+	}{
+		{
+			[]string{"continue"},
+			[]string{"Paused at main.kol:1\n   1 | let base = 10\n"},
+			false,
+		},
+		{
+			[]string{"break 3", "c", "locals", "p base", "bt", "q"},
+			[]string{
+				"Breakpoint set at main.kol:3",
+				"Paused at main.kol:3\n   3 |     let sum = a + b + base\n",
+				"a = 1\nb = 2\nsum = <unset>\n",
+				"base = 10\n",
+				"#0 add (main.kol:3:15)\n#1 <main> (main.kol:12:4)\n",
+			},
+			true,
+		},
+		{
+			[]string{"b 3", "c", "n", "p sum", "o", "q"},
+			[]string{"Paused at main.kol:4", "sum = 13\n", "Paused at main.kol:12"},
+			true,
+		},
+		{
+			[]string{"n", "n", "n", "s", "s", "s", "free", "q"},
+			[]string{"Paused at main.kol:2", "Paused at main.kol:6", "Paused at main.kol:10", "Paused at main.kol:7", "Paused at main.kol:8", "No variables\n"},
+			true,
+		},
+		{
+			[]string{"b 8", "b 12", "c", "d 8", "c", "globals", "c"},
+			[]string{"Breakpoint at main.kol:8 deleted", "Paused at main.kol:12", "base = 10\nadd = Closure"},
+			false,
+		},
+		{
+			[]string{"b 8", "c", "c", "free", "c"},
+			[]string{"count = 0\n"},
+			false,
+		},
+		{
+			[]string{"b x", "p nothing", "jump", "q"},
+			[]string{"Invalid line x", "Variable nothing is not defined", "Unknown command jump"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		out, err := debug(t, tt.commands...)
+		if tt.stopped && err != vm.ErrStopped {
+			t.Errorf("%v: expected the program to be stopped, got %v", tt.commands, err)
+		}
+		if !tt.stopped && err != nil {
+			t.Errorf("%v: unexpected error %s", tt.commands, err)
+		}
+		for _, expected := range tt.expected {
+			if !strings.Contains(out, expected) {
+				t.Errorf("%v: expected output to contain %q, got:\n%s", tt.commands, expected, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kol/token"
+	"sort"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "error"
+	}
+}
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Code identifies the kind of a diagnostic, the hundreds tell the layer that produced it
+type Code string
+
+const (
+	IllegalCharacter    Code = "E0001"
+	UnterminatedComment Code = "E0002"
+	UnexpectedToken     Code = "E0100"
+	MissingExpression   Code = "E0101"
+	InvalidSyntax       Code = "E0102"
+	TypeError           Code = "E0200"
+	CompileError        Code = "E0300"
+	RuntimeError        Code = "E0400"
+	ImportError         Code = "E0500"
+)
+
+// Span is the part of a file a diagnostic points to. The end column is exclusive,
+// a span without a start line has no known position.
+type Span struct {
+	File  string         `json:"file,omitempty"`
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+// At returns a span pointing to a single position
+func At(pos token.Position) Span {
+	return Span{Start: pos, End: pos}
+}
+
+// TokenSpan returns the span covering a token
+func TokenSpan(tok token.Token) Span {
+	end := tok.Position
+	end.Column += len(tok.Literal)
+	if tok.Type == token.STRING {
+		// the literal doesn't include the quotes
+		end.Column += 2
+	}
+	return Span{Start: tok.Position, End: end}
+}
+func (s Span) IsValid() bool {
+	return s.Start.Line > 0
+}
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     Code     `json:"code"`
+	Message  string   `json:"message"`
+	Span     Span     `json:"span"`
+	Hints    []string `json:"hints,omitempty"`
+	Notes    []string `json:"notes,omitempty"`
+}
+
+func New(code Code, span Span, format string, a ...interface{}) *Diagnostic {
+	return &Diagnostic{Severity: Error, Code: code, Message: fmt.Sprintf(format, a...), Span: span}
+}
+func (d *Diagnostic) WithHint(hint string) *Diagnostic {
+	d.Hints = append(d.Hints, hint)
+	return d
+}
+
+func (d *Diagnostic) Error() string {
+	if !d.Span.IsValid() {
+		return "Error: " + d.Message
+	}
+	return fmt.Sprintf("Error at %s: %s", d.Location(), d.Message)
+}
+
+// Location formats the start of the span as file:line:column
+func (d *Diagnostic) Location() string {
+	if d.Span.File == "" {
+		return fmt.Sprintf("%d:%d", d.Span.Start.Line, d.Span.Start.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", d.Span.File, d.Span.Start.Line, d.Span.Start.Column)
+}
+
+// FromError returns the diagnostics behind an error. Errors can carry a single diagnostic or
+// several of them, other errors become a diagnostic without a position with the given code.
+func FromError(err error, code Code) []*Diagnostic {
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return []*Diagnostic{d}
+	}
+	var several interface{ Diagnostics() []*Diagnostic }
+	if errors.As(err, &several) {
+		return several.Diagnostics()
+	}
+	var single interface{ Diagnostic() *Diagnostic }
+	if errors.As(err, &single) {
+		return []*Diagnostic{single.Diagnostic()}
+	}
+	return []*Diagnostic{New(code, Span{}, "%s", err)}
+}
+
+// Sort orders diagnostics by their position, keeping the order of diagnostics at the same position
+func Sort(diagnostics []*Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Span, diagnostics[j].Span
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Start.Line != b.Start.Line {
+			return a.Start.Line < b.Start.Line
+		}
+		return a.Start.Column < b.Start.Column
+	})
+}
+
+// WriteJSON writes the diagnostics as a JSON array
+func WriteJSON(w io.Writer, diagnostics []*Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []*Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(diagnostics)
+}
@@ -0,0 +1,108 @@
+package diagnostic
+
+import (
+	"bytes"
+	"kol/token"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tlet y = x + \"a\";\n"
+	tests := []struct {
+		diagnostic *Diagnostic
+		expected   string
+	}{
+		{
+			New(TypeError, Span{File: "main.kol", Start: token.Position{Line: 2, Column: 12}, End: token.Position{Line: 2, Column: 13}}, "type mismatch: %s + %s", "int", "str"),
+			"error[E0200]: type mismatch: int + str\n" +
+				" --> main.kol:2:12\n" +
+				"  |\n" +
+				"2 | \tlet y = x + \"a\";\n" +
+				"  | \t          ^\n",
+		},
+		{
+			New(UnexpectedToken, TokenSpan(token.Token{Type: token.IDENT, Literal: "let", Position: token.Position{Line: 1, Column: 1}}), "unexpected let").WithHint("remove it"),
+			"error[E0100]: unexpected let\n" +
+				" --> 1:1\n" +
+				"  |\n" +
+				"1 | let x = 1;\n" +
+				"  | ^^^\n" +
+				"  = hint: remove it\n",
+		},
+		{
+			&Diagnostic{Severity: Warning, Code: RuntimeError, Message: "no position", Notes: []string{"at <main>"}},
+			"warning[E0400]: no position\n" +
+				" = note: at <main>\n",
+		},
+		{
+			New(TypeError, TokenSpan(token.Token{Type: token.STRING, Literal: "a", Position: token.Position{Line: 2, Column: 14}}), "string"),
+			"error[E0200]: string\n" +
+				" --> 2:14\n" +
+				"  |\n" +
+				"2 | \tlet y = x + \"a\";\n" +
+				"  | \t            ^^^\n",
+		},
+	}
+	for i, tt := range tests {
+		rendered := tt.diagnostic.Render(source)
+		if rendered != tt.expected {
+			t.Errorf("test %d: wrong rendering.\nexpected=\n%s\ngot=\n%s", i, tt.expected, rendered)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	d := New(CompileError, At(token.Position{Line: 3, Column: 4}), "break outside of a loop")
+	if d.Error() != "Error at 3:4: break outside of a loop" {
+		t.Errorf("wrong error. got=%q", d.Error())
+	}
+	d.Span.File = "main.kol"
+	if d.Error() != "Error at main.kol:3:4: break outside of a loop" {
+		t.Errorf("wrong error. got=%q", d.Error())
+	}
+	d = New(RuntimeError, Span{}, "stack overflow")
+	if d.Error() != "Error: stack overflow" {
+		t.Errorf("wrong error. got=%q", d.Error())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(IllegalCharacter, At(token.Position{Line: 1, Column: 2}), "illegal character %q", "&").WithHint("did you mean &&?")
+	d.Span.File = "main.kol"
+	err := WriteJSON(&buf, []*Diagnostic{d})
+	if err != nil {
+		t.Fatalf("WriteJSON failed: %s", err)
+	}
+	expected := `[
+  {
+    "severity": "error",
+    "code": "E0001",
+    "message": "illegal character \"&\"",
+    "span": {
+      "file": "main.kol",
+      "start": {
+        "line": 1,
+        "column": 2
+      },
+      "end": {
+        "line": 1,
+        "column": 2
+      }
+    },
+    "hints": [
+      "did you mean &&?"
+    ]
+  }
+]
+`
+	if buf.String() != expected {
+		t.Errorf("wrong json.\nexpected=\n%s\ngot=\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	WriteJSON(&buf, nil)
+	if buf.String() != "[]\n" {
+		t.Errorf("wrong json for no diagnostics. got=%q", buf.String())
+	}
+}
@@ -0,0 +1,65 @@
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Render formats a diagnostic in the style of rustc, underlining the span in the source it points to:
+//
+//	error[E0100]: expected next token to be IDENT, got = instead
+//	 --> main.kol:1:5
+//	  |
+//	1 | let = 5;
+//	  |     ^
+//	  = hint: ...
+func (d *Diagnostic) Render(source string) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	gutter := ""
+	if d.Span.IsValid() {
+		gutter = strings.Repeat(" ", len(strconv.Itoa(d.Span.Start.Line)))
+		fmt.Fprintf(&out, "%s--> %s\n", gutter, d.Location())
+
+		lines := strings.Split(source, "\n")
+		if source != "" && d.Span.Start.Line <= len(lines) {
+			line := strings.TrimRight(lines[d.Span.Start.Line-1], "\r")
+			fmt.Fprintf(&out, "%s |\n", gutter)
+			fmt.Fprintf(&out, "%d | %s\n", d.Span.Start.Line, line)
+			fmt.Fprintf(&out, "%s | %s\n", gutter, underline(line, d.Span))
+		}
+	}
+	for _, hint := range d.Hints {
+		fmt.Fprintf(&out, "%s = hint: %s\n", gutter, hint)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(&out, "%s = note: %s\n", gutter, note)
+	}
+	return out.String()
+}
+
+// underline returns the carets marking the span below its source line
+func underline(line string, span Span) string {
+	var out bytes.Buffer
+	start := span.Start.Column - 1
+	for i := 0; i < start && i < len(line); i++ {
+		// tabs are kept so the carets line up with the source
+		if line[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	for i := len(line); i < start; i++ {
+		out.WriteByte(' ')
+	}
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	}
+	out.WriteString(strings.Repeat("^", width))
+	return out.String()
+}
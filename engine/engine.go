@@ -0,0 +1,113 @@
+// Package engine runs Kol programs on the tree walking evaluator or on the compiler and the VM
+// behind one interface, so tools can switch between them.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/lexer"
+	"kol/object"
+	"kol/parser"
+	"kol/typecheck"
+	"strings"
+)
+
+// Engine runs programs, their globals stay alive for the code run afterwards
+type Engine interface {
+	// Run parses, type checks and runs a program. fileName is shown in errors and imports are resolved
+	// relative to it. Syntax, type and compile errors are returned as an *Error.
+	Run(ctx context.Context, fileName string, input string) (object.Object, error)
+	// Eval runs input without type checking it, like a line typed into a REPL
+	Eval(ctx context.Context, input string) (object.Object, error)
+	// Global returns the value of a global variable
+	Global(name string) (object.Object, bool)
+	// Globals returns the values of all global variables by their names
+	Globals() map[string]object.Object
+	// Call calls a global function with the limits of Run
+	Call(ctx context.Context, name string, args ...object.Object) (object.Object, error)
+}
+
+// Options configure an engine, the zero value runs programs with the default builtins on the
+// standard streams without limits
+type Options struct {
+	// the builtins programs can call, nil for the default ones
+	Builtins []object.BuiltinDefinition
+	// the signatures of builtins the type checker doesn't know
+	Signatures map[string]*typecheck.Function
+	Limits     object.Limits
+	IO         *object.IO
+}
+
+// Names are the names New accepts
+var Names = []string{"vm", "eval"}
+
+// New creates an engine by its name, vm for the compiler and the VM or eval for the evaluator
+func New(name string, options Options) (Engine, error) {
+	switch name {
+	case "vm":
+		return NewVM(options), nil
+	case "eval":
+		return NewEvaluator(options), nil
+	}
+	return nil, fmt.Errorf("unknown engine %q, expected %s", name, strings.Join(Names, " or "))
+}
+
+// parse parses a program and with check set also type checks it
+func parse(fileName string, input string, check bool, options Options) (*ast.Program, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, newError(fileName, p.Diagnostics())
+	}
+	if !check {
+		return program, nil
+	}
+	checker := typecheck.New()
+	for name, fn := range options.Signatures {
+		checker.DefineBuiltin(name, fn)
+	}
+	checker.Check(program)
+	if len(checker.Errors()) != 0 {
+		return nil, newError(fileName, checker.Errors())
+	}
+	return program, nil
+}
+
+// function returns the global function Call calls
+func function(e Engine, name string) (object.Object, error) {
+	fn, ok := e.Global(name)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't defined", name)
+	}
+	switch fn.(type) {
+	case *object.Closure, *object.Function, *object.Builtin:
+		return fn, nil
+	}
+	return nil, fmt.Errorf("%s is %s, not a function", name, fn.Type())
+}
+
+// Error is returned when a program has syntax, type or compile errors and didn't run
+type Error struct {
+	diagnostics []*diagnostic.Diagnostic
+}
+
+func newError(fileName string, diagnostics []*diagnostic.Diagnostic) *Error {
+	for _, d := range diagnostics {
+		if d.Span.File == "" {
+			d.Span.File = fileName
+		}
+	}
+	return &Error{diagnostics: diagnostics}
+}
+func (e *Error) Diagnostics() []*diagnostic.Diagnostic {
+	return e.diagnostics
+}
+func (e *Error) Error() string {
+	messages := make([]string, len(e.diagnostics))
+	for i, d := range e.diagnostics {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
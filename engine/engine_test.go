@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"kol/diagnostic"
+	"kol/object"
+	"strings"
+	"testing"
+)
+
+// forEachEngine runs a test on every engine
+func forEachEngine(t *testing.T, options Options, test func(t *testing.T, e Engine)) {
+	for _, name := range Names {
+		t.Run(name, func(t *testing.T) {
+			e, err := New(name, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test(t, e)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{`let greet = fun(name str) str { "hello " + name }; greet("kol")`, "hello kol"},
+		{"let fib = fun(n int) int { if n < 2 { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", "610"},
+		{`struct point { x int, y int }; let p = point{x: 1, y: 2}; p.x + p.y`, "3"},
+		{`let mut xs = []; let mut i = 0; for i < 3 { xs = push(xs, i); i += 1 }; xs`, "[0, 1, 2]"},
+	}
+	forEachEngine(t, Options{}, func(t *testing.T, e Engine) {
+		for _, tt := range tests {
+			result, err := e.Run(context.Background(), "main.kol", tt.input)
+			if err != nil {
+				t.Fatalf("%q: %s", tt.input, err)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+			}
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     diagnostic.Code
+		expected string
+	}{
+		{"let x = ;", diagnostic.MissingExpression, "Error at main.kol:1:9: no prefix parse function for ; found"},
+		{`println(1)`, diagnostic.TypeError, "Error at main.kol:1:9: Parameter 1 not valid: Expected str but got int"},
+	}
+	forEachEngine(t, Options{}, func(t *testing.T, e Engine) {
+		for _, tt := range tests {
+			_, err := e.Run(context.Background(), "main.kol", tt.input)
+			var engineErr *Error
+			if !errors.As(err, &engineErr) || err.Error() != tt.expected || engineErr.Diagnostics()[0].Code != tt.code {
+				t.Errorf("%q: expected %s %q, got %v", tt.input, tt.code, tt.expected, err)
+			}
+		}
+		_, err := e.Run(context.Background(), "main.kol", `int("x")`)
+		diagnostics := diagnostic.FromError(err, diagnostic.RuntimeError)
+		if len(diagnostics) != 1 || diagnostics[0].Message != "Could not parse 'x' to a int" {
+			t.Errorf("expected a runtime error, got %v", err)
+		}
+	})
+}
+
+func TestGlobals(t *testing.T) {
+	forEachEngine(t, Options{}, func(t *testing.T, e Engine) {
+		ctx := context.Background()
+		if _, err := e.Run(ctx, "main.kol", "let mut count = 0; let inc = fun(by int) int { count += by; count }"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Eval(ctx, "inc(2)"); err != nil {
+			t.Fatal(err)
+		}
+		result, err := e.Call(ctx, "inc", &object.Integer{Value: 3})
+		if err != nil || result.Inspect() != "5" {
+			t.Fatalf("expected inc to return 5, got %v, %v", result, err)
+		}
+		if count, ok := e.Global("count"); !ok || count.Inspect() != "5" {
+			t.Errorf("expected count to be 5, got %v", count)
+		}
+		globals := e.Globals()
+		if len(globals) != 2 || globals["count"].Inspect() != "5" || globals["inc"] == nil {
+			t.Errorf("expected count and inc, got %v", globals)
+		}
+		if _, ok := e.Global("len"); ok {
+			t.Errorf("expected builtins not to be globals")
+		}
+		if _, err := e.Call(ctx, "count"); err == nil || err.Error() != "count is INTEGER, not a function" {
+			t.Errorf("expected count not to be callable, got %v", err)
+		}
+	})
+}
+
+func TestOptions(t *testing.T) {
+	var output strings.Builder
+	options := Options{
+		Builtins: []object.BuiltinDefinition{{Name: "println", Builtin: object.GetBuiltinByName("println")}},
+		Limits:   object.Limits{MaxInstructions: 1000},
+		IO:       &object.IO{Out: &output},
+	}
+	forEachEngine(t, options, func(t *testing.T, e Engine) {
+		output.Reset()
+		if _, err := e.Run(context.Background(), "main.kol", `println("%s", 42)`); err != nil {
+			t.Fatal(err)
+		}
+		if output.String() != "42\n" {
+			t.Errorf("expected the program to print to the IO of the options, got %q", output.String())
+		}
+		if _, err := e.Eval(context.Background(), `len("a")`); err == nil {
+			t.Errorf("expected only the builtins of the options")
+		}
+		_, err := e.Eval(context.Background(), "for true { }")
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("expected the instruction limit to be exceeded, got %v", err)
+		}
+	})
+	if _, err := New("jit", Options{}); err == nil || err.Error() != `unknown engine "jit", expected vm or eval` {
+		t.Errorf("expected an unknown engine error, got %v", err)
+	}
+}
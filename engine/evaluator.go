@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"kol/ast"
+	"kol/evaluator"
+	"kol/object"
+)
+
+// evaluatorEngine evaluates every program in the same global environment
+type evaluatorEngine struct {
+	options Options
+	env     *object.Environment
+}
+
+// NewEvaluator creates an engine that walks the syntax tree of programs
+func NewEvaluator(options Options) Engine {
+	env := object.NewEnvironment()
+	if options.Builtins != nil {
+		env.SetBuiltins(options.Builtins)
+	}
+	if options.IO != nil {
+		env.SetIO(options.IO)
+	}
+	return &evaluatorEngine{options: options, env: env}
+}
+func (e *evaluatorEngine) Run(ctx context.Context, fileName string, input string) (object.Object, error) {
+	program, err := parse(fileName, input, true, e.options)
+	if err != nil {
+		return nil, err
+	}
+	e.env.SetFileName(fileName)
+	return e.eval(ctx, program)
+}
+func (e *evaluatorEngine) Eval(ctx context.Context, input string) (object.Object, error) {
+	program, err := parse("", input, false, e.options)
+	if err != nil {
+		return nil, err
+	}
+	return e.eval(ctx, program)
+}
+func (e *evaluatorEngine) eval(ctx context.Context, program *ast.Program) (object.Object, error) {
+	result, err := evaluator.EvalContext(ctx, program, e.env, e.options.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj.Diagnostic()
+	}
+	return result, nil
+}
+func (e *evaluatorEngine) Global(name string) (object.Object, bool) {
+	variable, ok := e.env.Get(name)
+	return variable.Value, ok
+}
+func (e *evaluatorEngine) Globals() map[string]object.Object {
+	globals := make(map[string]object.Object)
+	for _, name := range e.env.Names() {
+		globals[name], _ = e.Global(name)
+	}
+	return globals
+}
+func (e *evaluatorEngine) Call(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	fn, err := function(e, name)
+	if err != nil {
+		return nil, err
+	}
+	result, err := evaluator.CallContext(ctx, e.env, name, fn, args, e.options.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj.Diagnostic()
+	}
+	return result, nil
+}
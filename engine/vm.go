@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"kol/ast"
+	"kol/compiler"
+	"kol/diagnostic"
+	"kol/object"
+	"kol/vm"
+)
+
+// vmEngine compiles every program to bytecode and runs it on a new VM sharing the globals
+type vmEngine struct {
+	options   Options
+	builtins  []object.BuiltinDefinition
+	symbols   *compiler.SymbolTable
+	constants []object.Object
+	globals   []object.Object
+	// the VM of the last program, calls run on it
+	machine *vm.VM
+}
+
+// NewVM creates an engine that compiles programs and runs them on the VM
+func NewVM(options Options) Engine {
+	builtins := options.Builtins
+	if builtins == nil {
+		builtins = object.Builtins
+	}
+	symbols := compiler.NewSymbolTable()
+	for i, v := range builtins {
+		symbols.DefineBuiltin(i, v.Name)
+	}
+	return &vmEngine{
+		options:   options,
+		builtins:  builtins,
+		symbols:   symbols,
+		constants: []object.Object{},
+		globals:   make([]object.Object, vm.GlobalsSize),
+	}
+}
+func (e *vmEngine) Run(ctx context.Context, fileName string, input string) (object.Object, error) {
+	program, err := parse(fileName, input, true, e.options)
+	if err != nil {
+		return nil, err
+	}
+	return e.run(ctx, fileName, program)
+}
+func (e *vmEngine) Eval(ctx context.Context, input string) (object.Object, error) {
+	program, err := parse("", input, false, e.options)
+	if err != nil {
+		return nil, err
+	}
+	return e.run(ctx, "", program)
+}
+func (e *vmEngine) run(ctx context.Context, fileName string, program *ast.Program) (object.Object, error) {
+	comp := compiler.NewWithState(e.symbols, e.constants)
+	comp.SetFileName(fileName)
+	if err := comp.Compile(program); err != nil {
+		return nil, newError(fileName, diagnostic.FromError(err, diagnostic.CompileError))
+	}
+	bytecode := comp.Bytecode()
+	e.constants = bytecode.Constants
+
+	e.machine = vm.NewWithGlobalsStore(bytecode, e.globals)
+	e.machine.SetBuiltins(e.builtins)
+	e.machine.SetLimits(e.options.Limits)
+	if e.options.IO != nil {
+		e.machine.SetIO(e.options.IO)
+	}
+	if err := e.machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	return e.machine.LastPoppedStackElem(), nil
+}
+func (e *vmEngine) Global(name string) (object.Object, bool) {
+	symbol, ok := e.symbols.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || e.globals[symbol.Index] == nil {
+		return nil, false
+	}
+	return e.globals[symbol.Index], true
+}
+func (e *vmEngine) Globals() map[string]object.Object {
+	globals := make(map[string]object.Object)
+	for _, symbol := range e.symbols.Definitions() {
+		if value := e.globals[symbol.Index]; value != nil {
+			globals[symbol.Name] = value
+		}
+	}
+	return globals
+}
+func (e *vmEngine) Call(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	fn, err := function(e, name)
+	if err != nil {
+		return nil, err
+	}
+	return e.machine.Call(ctx, fn, args...)
+}
@@ -5,10 +5,16 @@ import (
 )
 
 var builtins = map[string]*object.Builtin{
-	"println": object.GetBuiltinByName("println"),
-	"len":     object.GetBuiltinByName("len"),
-	"str":     object.GetBuiltinByName("str"),
-	"int":     object.GetBuiltinByName("int"),
-	"push":    object.GetBuiltinByName("push"),
-	"remove":  object.GetBuiltinByName("remove"),
+	"println":   object.GetBuiltinByName("println"),
+	"len":       object.GetBuiltinByName("len"),
+	"str":       object.GetBuiltinByName("str"),
+	"int":       object.GetBuiltinByName("int"),
+	"float":     object.GetBuiltinByName("float"),
+	"push":      object.GetBuiltinByName("push"),
+	"remove":    object.GetBuiltinByName("remove"),
+	"eprintln":  object.GetBuiltinByName("eprintln"),
+	"readln":    object.GetBuiltinByName("readln"),
+	"assert":    object.GetBuiltinByName("assert"),
+	"assert_eq": object.GetBuiltinByName("assert_eq"),
+	"fail":      object.GetBuiltinByName("fail"),
 }
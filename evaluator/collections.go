@@ -3,32 +3,33 @@ package evaluator
 import (
 	"kol/ast"
 	"kol/object"
+	"kol/token"
 )
 
-func evalIndexExpression(left, index object.Object) object.Object {
+func evalIndexExpression(left, index object.Object, pos token.Position) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
+		return evalArrayIndexExpression(left, index, pos)
 	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
+		return evalHashIndexExpression(left, index, pos)
 	default:
-		return newUnpositionedError("index operator not supported: %s", left.Type())
+		return newError("index operator not supported: %s", pos, left.Type())
 	}
 }
-func evalArrayIndexExpression(array, index object.Object) object.Object {
+func evalArrayIndexExpression(array, index object.Object, pos token.Position) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 	if idx < 0 || idx > max {
-		return newUnpositionedError("Index %d out of bounds for array of size %d", idx, max+1)
+		return newError("Index %d out of bounds for array of size %d", pos, idx, max+1)
 	}
 	return arrayObject.Elements[idx]
 }
-func evalHashIndexExpression(hash, index object.Object) object.Object {
+func evalHashIndexExpression(hash, index object.Object, pos token.Position) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newUnpositionedError("unusable as hash key: %s", index.Type())
+		return newError("unusable as hash key: %s", pos, index.Type())
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
@@ -48,7 +49,7 @@ func evalHashLiteral(
 		}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newUnpositionedError("unusable as hash key: %s", key.Type())
+			return newError("unusable as hash key: %s", node.GetPosition(), key.Type())
 		}
 		value := Eval(valueNode, env)
 		if isError(value) {
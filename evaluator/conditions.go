@@ -28,6 +28,7 @@ func evalForExpression(ie *ast.ForExpression, env *object.Environment) object.Ob
 
 	var obj object.Object
 	for result {
+		// every iteration runs the body in a scope of its own
 		obj = Eval(ie.Consequence, env)
 
 		if isError(obj) {
@@ -37,6 +38,9 @@ func evalForExpression(ie *ast.ForExpression, env *object.Environment) object.Ob
 		if brObj, ok := obj.(*object.BreakValue); ok {
 			return brObj.Value
 		}
+		if obj != nil && obj.Type() == object.RETURN_VALUE_OBJ {
+			return obj
+		}
 
 		result, err = isTrue(ie.Condition, env)
 		if err != nil {
@@ -50,6 +54,24 @@ func evalForExpression(ie *ast.ForExpression, env *object.Environment) object.Ob
 	}
 	return obj
 }
+func evalLogicalExpression(ie *ast.InfixExpression, env *object.Environment) object.Object {
+	left, err := isTrue(ie.Left, env)
+	if err != nil {
+		return err
+	}
+	// short-circuit: the right side is only evaluated if it decides the result
+	if ie.Operator == "&&" && !left {
+		return FALSE
+	}
+	if ie.Operator == "||" && left {
+		return TRUE
+	}
+	right, err := isTrue(ie.Right, env)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(right)
+}
 func isTrue(ex ast.Expression, env *object.Environment) (bool, object.Object) {
 	condition := Eval(ex, env)
 	if isError(condition) {
@@ -9,11 +9,27 @@ import (
 
 var (
 	VOID  = &object.Void{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.True
+	FALSE = object.False
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	budget := env.Budget()
+	if budget == nil {
+		return eval(node, env)
+	}
+	if err := budget.Step(); err != nil {
+		return newError("%s", node.GetPosition(), err)
+	}
+	result := eval(node, env)
+	if allocating(node) && !isError(result) {
+		if err := budget.Allocate(object.Size(result)); err != nil {
+			return newError("%s", node.GetPosition(), err)
+		}
+	}
+	return result
+}
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
@@ -34,6 +50,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalPrefixExpression(node.Operator, right, node.GetPosition())
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -44,7 +63,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalInfixExpression(node.Operator, left, right, node.GetPosition())
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		// blocks have their own scope, their variables can be declared again outside of them
+		return evalBlockStatement(node, object.NewEnclosedEnvironment(env))
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.ForExpression:
@@ -59,11 +79,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.BreakStatement:
+		if node.BreakValue == nil {
+			return &object.BreakValue{Value: VOID}
+		}
 		val := Eval(node.BreakValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.BreakValue{Value: val}
+	case *ast.ContinueStatement:
+		return &object.ContinueValue{}
 	case *ast.LetStatement:
 		if env.HasValue(node.Name.Value) {
 			return newError("Variable %s can't be redefined", node.GetPosition(), node.Name.Value)
@@ -105,7 +130,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args, node.GetPosition())
+		call := object.NewCall(env.Call(), calleeName(node.Function), env.FileName(), node.GetPosition())
+		if budget := env.Budget(); budget != nil {
+			return applyFunctionWithBudget(budget, function, args, call, env.IO())
+		}
+		return applyFunction(function, args, call, env.IO())
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -121,9 +150,23 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return evalIndexExpression(left, index, node.GetPosition())
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.StructStatement:
+		return evalStructStatement(node, env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
+	case *ast.FieldAccessExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalFieldAccessExpression(left, node.Field)
 	}
 
 	return nil
@@ -137,6 +180,10 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.BreakValue:
+			return newError("break outside of a loop", statement.GetPosition())
+		case *object.ContinueValue:
+			return newError("continue outside of a loop", statement.GetPosition())
 		}
 	}
 	return result
@@ -148,7 +195,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 		if result != nil {
 			rt := result.Type()
 
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_VALUE_OBJECT {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_VALUE_OBJECT || rt == object.CONTINUE_VALUE_OBJ {
 				return result
 			}
 		}
@@ -177,7 +224,11 @@ func evalIdentifier(
 	if val, ok := env.Get(node.Value); ok {
 		return val.Value
 	}
-	if builtin, ok := builtins[node.Value]; ok {
+	if defs := env.Builtins(); defs != nil {
+		if builtin := object.LookupBuiltin(defs, node.Value); builtin != nil {
+			return builtin
+		}
+	} else if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
 	return newError("identifier not found: "+node.Value, node.GetPosition())
@@ -201,6 +252,3 @@ func newError(format string, pos token.Position, a ...interface{}) *object.Error
 	msg := fmt.Sprintf(format, a...)
 	return &object.Error{Message: msg, Position: &pos}
 }
-func newUnpositionedError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...), Position: nil}
-}
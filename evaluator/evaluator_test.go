@@ -1,10 +1,16 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"kol/lexer"
 	"kol/object"
 	"kol/parser"
+	"kol/token"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestStringLiteral(t *testing.T) {
@@ -105,12 +111,84 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" + "b" != "ab"`, false},
+		{`"a" != "b"`, true},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"false && true || true", true},
+		{"false && 1", false},
+		{"true || 1", true},
+		{"let mut n = 0; fun inc() bool { n += 1; return true } false && inc(); true || inc(); n", 0},
+		{"true && 1", "INTEGER is not of type BOOLEAN and can't be used as a condition"},
+		{`"a" || true`, "STRING is not of type BOOLEAN and can't be used as a condition"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let mut i = 0; for i < 3 { i += 1 }; i", 3},
+		{"let mut i = 0; for true { i += 1; if i == 5 { break i * 2 } }", 10},
+		{"let mut i = 0; for i < 3 { i += 1 } else { 42 }", 42},
+		{"let mut i = 0; for true { i += 1; if i == 5 { break; } }; i", 5},
+		{"let mut i = 0; let mut sum = 0; for i < 10 { i += 1; if i % 2 == 0 { continue; } sum += i }; sum", 25},
+		{"let mut i = 0; let mut n = 0; let mut j = 0; for i < 3 { i += 1; j = 0; for true { j += 1; if j == 4 { break; } n += 1 } }; n", 9},
+		{"let f = fun() int { let mut i = 0; for true { i += 1; if i == 7 { return i } } }; f()", 7},
+		{"fun f() int { let mut i = 0; for true { i += 1; if i == 3 { break } } i } f()", 3},
+		{"let mut i = 0; for i < 3 { let j = i; i = j + 1 }; i", 3},
+		{"break 1;", "break outside of a loop"},
+		{"let mut i = 0; for i < 1 { i += 1; fun() { continue; }() }", "continue outside of a loop"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -250,6 +328,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`int("42")`, 42},
+		{`len(str(float("2.5")))`, 3},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert_eq("kol", "kool")`, "values aren't equal\n  expected: kool\n    actual: kol\n              ^"},
+		{`fail("not yet")`, "not yet"},
+		{`let len = fun(x int) int { x * 2 }; len(3)`, 6},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -270,6 +354,43 @@ func TestBuiltinFunctions(t *testing.T) {
 		}
 	}
 }
+func TestEnvironmentBuiltins(t *testing.T) {
+	double := &object.Builtin{
+		Fn: func(std *object.IO, args ...object.Object) object.Object {
+			return &object.Integer{Value: 2 * args[0].(*object.Integer).Value}
+		},
+		Signature: &object.Signature{Parameters: []string{"int"}, Return: "int"},
+	}
+	env := object.NewEnvironment()
+	env.SetBuiltins([]object.BuiltinDefinition{{Name: "double", Builtin: double}})
+	program := parser.New(lexer.New(`let f = fun(x int) int { double(x) }; f(21)`)).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 42)
+
+	program = parser.New(lexer.New(`double("a")`)).ParseProgram()
+	errObj, ok := Eval(program, env).(*object.Error)
+	if !ok || errObj.Message != "argument 1 must be int, got STRING" {
+		t.Errorf("expected the signature to be checked, got %v", errObj)
+	}
+	program = parser.New(lexer.New(`len("a")`)).ParseProgram()
+	errObj, ok = Eval(program, env).(*object.Error)
+	if !ok || errObj.Message != "identifier not found: len" {
+		t.Errorf("expected only the builtins of the environment, got %v", errObj)
+	}
+	testIntegerObject(t, testEval(`len("a")`), 1)
+}
+func TestIO(t *testing.T) {
+	var stdout, stderr strings.Builder
+	env := object.NewEnvironment()
+	env.SetIO(&object.IO{In: strings.NewReader("kol\n"), Out: &stdout, Err: &stderr})
+	input := `let greet = fun(name str) { println("hello %s", name) }; greet(readln()); eprintln("done"); readln()`
+	errObj, ok := Eval(parser.New(lexer.New(input)).ParseProgram(), env).(*object.Error)
+	if !ok || errObj.Message != "no more input to read" {
+		t.Errorf("expected the end of the input to fail, got %v", errObj)
+	}
+	if stdout.String() != "hello kol\n" || stderr.String() != "done\n" {
+		t.Errorf("wrong output %q and %q", stdout.String(), stderr.String())
+	}
+}
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -315,6 +436,9 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
 		{"let mut a = 5; let b = a + 4; a = b + a; a;", 14},
+		{"let a = true; let b = if (a) { let x = 1; x } else { let x = 2; x }; let x = b + 1; x", 2},
+		{"let f = fun(a bool) int { let x = 5; if (a) { let x = 3; x } else { x } }; f(true) * 10 + f(false)", 35},
+		{"let mut a = 1; if (true) { let b = 2; a = a + b }; a", 3},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
@@ -349,6 +473,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"7 % 0",
+			"Can't take the remainder of a division by zero",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -387,6 +515,10 @@ return 1;
 			"x = 4;",
 			"Variable x isn't defined",
 		},
+		{
+			"let f = fun() int { 5 + true }; f()",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
 	}
 	for i, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -402,6 +534,27 @@ return 1;
 		}
 	}
 }
+func TestCollectionErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Position
+	}{
+		{"let a = [1, 2]\na[5]", token.Position{Line: 2, Column: 2}},
+		{"let h = {\"a\": 2}\n h[[1]]", token.Position{Line: 2, Column: 3}},
+		{"5[0]", token.Position{Line: 1, Column: 2}},
+		{"let h = {[1]: 2}", token.Position{Line: 1, Column: 9}},
+	}
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned", tt.input)
+			continue
+		}
+		if errObj.Position == nil || *errObj.Position != tt.expected {
+			t.Errorf("%q: expected the error %q at %v, got %v", tt.input, errObj.Message, tt.expected, errObj.Position)
+		}
+	}
+}
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -458,7 +611,196 @@ func TestFunctionApplication(t *testing.T) {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
 	}
 }
+func TestClosuresShareVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			input: `
+let counter = fun() int {
+	let mut count = 0
+	let inc = fun() int { count += 1; count }
+	inc()
+	inc()
+	count
+}
+counter()
+`,
+			expected: 2,
+		},
+		{
+			input: `
+let pair = fun() array {
+	let mut value = 0
+	let set = fun(v int) { value = v }
+	let get = fun() int { value };
+	[set, get]
+}
+let p = pair()
+p[0](5)
+p[1]()
+`,
+			expected: 5,
+		},
+		{
+			input: `
+let outer = fun() int {
+	let mut n = 1
+	let middle = fun() fn {
+		fun() int { n += 10; n }
+	}
+	let inner = middle()
+	inner()
+	n += 100
+	inner()
+}
+outer()
+`,
+			expected: 121,
+		},
+		{
+			input: `
+let make = fun() fn {
+	let mut total = 0
+	let add = fun(x int) int { total += x; total }
+	add
+}
+let a = make()
+let b = make()
+a(1)
+a(2)
+b(10)
+a(3)
+`,
+			expected: 6,
+		},
+		{
+			input: `
+let run = fun() int {
+	let fib = fun(n int) int { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }
+	fib(10)
+}
+run()
+`,
+			expected: 55,
+		},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x int, y int }; let p = Point{x: 1, y: 2}; p.x + p.y", 3},
+		{"struct Point { x int, y int }; Point{y: 2, x: 1}.y", 2},
+		{"struct Point { x int }; struct Line { from Point }; Line{from: Point{x: 4}}.from.x", 4},
+		{"struct Point { x int }; fun getX(p Point) int { p.x } getX(Point{x: 7})", 7},
+		{"struct Point { x int }; let mut p = Point{x: 1}; p = Point{x: 2}; p.x", 2},
+		{"struct Point { x int, y int }; Point{x: 1, y: true}", "Field y not valid: Expected INTEGER but got BOOLEAN"},
+		{"struct Point { x int, y int }; Point{x: 1}", "Missing field y for struct Point"},
+		{"struct Point { x int }; Point{x: 1, z: 2}", "Struct Point has no field z"},
+		{"struct Point { x int }; Point{x: 1, x: 2}", "Field x is set more than once"},
+		{"struct Point { x int }; Point{x: 1}.y", "Struct Point has no field y"},
+		{"let a = 1; a.x", "field access not supported: INTEGER"},
+		{"struct Point { x int }; fun getX(p Point) int { p.x } getX(1)", "Parameter 1 not valid: Expected Point but got INTEGER"},
+		{"struct A { x int }; struct B { x int }; let mut a = A{x: 1}; a = B{x: 1};", "Can't change type of variable from A to B"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+var testModules = map[string]string{
+	"lib/math.kol": `
+let offset = 1
+export let base = 10
+export fun inc(x int) int { x + offset }
+export struct Point { x int }
+export fun origin() Point { Point{x: 0} }
+export fun x(p Point) int { p.x }
+`,
+	"lib/shapes.kol": `
+import "math"
+export fun area(w int, h int) int { math.inc(w * h) }
+`,
+	"cycle_a.kol":   `import "cycle_b"`,
+	"cycle_b.kol":   `import "cycle_a"`,
+	"failing.kol":   `let x = 1 + true`,
+	"returning.kol": `return 1`,
+	"counter.kol":   `export let mut count = 0; count = count + 1`,
+	"lib/tally.kol": `import "../counter"; export let count = counter.count`,
+}
 
+func TestModules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib/math"; math.inc(math.base)`, 11},
+		{`import "lib/math.kol"; math.origin().x`, 0},
+		{`import "lib/shapes"; shapes.area(2, 3)`, 7},
+		{`import "lib/math"; let base = 3; base + math.base`, 13},
+		{`import "lib/tally"; import "counter"; counter.count + tally.count`, 2},
+		{`import "lib/math"; math.Point{x: 3}.x`, 3},
+		{`import "lib/math"; fun f(p math.Point) math.Point { p }; math.x(f(math.Point{x: 4}))`, 4},
+		{`import "lib/math"; struct Line { from math.Point }; Line{from: math.origin()}.from.x`, 0},
+		{`import "lib/math"; struct Point { x int }; math.x(Point{x: 1})`, "Parameter 1 not valid: Expected math.Point but got Point"},
+		{`import "lib/math"; struct Point { x int }; fun f() Point { math.origin() }; f()`, "Returned type math.Point doesn't match expected type Point"},
+		{`import "lib/math"; struct Point { x int }; struct Line { from math.Point }; Line{from: Point{x: 1}}`, "Field from not valid: Expected math.Point but got Point"},
+		{`import "lib/math"; math.inc{x: 1}`, "inc is not a struct"},
+		{`import "lib/math"; math.offset`, "Module math has no export offset"},
+		{`import "lib/math"; import "lib/math"`, "Variable math can't be redefined"},
+		{`import "missing"`, "can't import missing.kol: file does not exist"},
+		{`import "cycle_a"`, "import cycle detected: cycle_a.kol -> cycle_b.kol -> cycle_a.kol"},
+		{`import "failing"`, "type mismatch: INTEGER + BOOLEAN"},
+		{`import "returning"`, "return outside of a function"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnvironment()
+		env.SetFileName("main.kol")
+		env.Modules().Loader.ReadFile = func(name string) ([]byte, error) {
+			content, ok := testModules[name]
+			if !ok {
+				return nil, fmt.Errorf("file does not exist")
+			}
+			return []byte(content), nil
+		}
+		evaluated := Eval(program, env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -512,3 +854,107 @@ func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
 	}
 	return true
 }
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected object.Limit
+	}{
+		{"let mut i = 0; for true { i += 1 }", object.Limits{MaxInstructions: 1000}, object.InstructionLimit},
+		{"let f = fun(x int) int { f(x + 1) }; f(0)", object.Limits{MaxCallDepth: 100}, object.CallDepthLimit},
+		{"let mut a = []; for true { a = push(a, 1) }", object.Limits{MaxAllocation: 10000}, object.AllocationLimit},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		_, err := EvalContext(context.Background(), program, object.NewEnvironment(), tt.limits)
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != tt.expected {
+			t.Errorf("expected limit %d to be exceeded by %q. got=%v", tt.expected, tt.input, err)
+		}
+	}
+
+	// the environment keeps working without limits afterwards
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New("let f = fun(x int) int { if (x == 0) { 0 } else { f(x - 1) } }; f(10)")).ParseProgram()
+	result, err := EvalContext(context.Background(), program, env, object.Limits{MaxCallDepth: 11})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, result, 0)
+	testIntegerObject(t, Eval(parser.New(lexer.New("f(100)")).ParseProgram(), env), 0)
+}
+
+func TestEvalContext(t *testing.T) {
+	program := parser.New(lexer.New("for true { }")).ParseProgram()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the loop. got=%v", err)
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	input := `let mut count = 0;
+let add = fun(a int, b int) int { count = count + 1; a + b };
+let deep = fun(n int) int { deep(n + 1) + 1 };
+let spin = fun() { for true { } };`
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	global := func(name string) object.Object {
+		variable, _ := env.Get(name)
+		return variable.Value
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := CallContext(ctx, env, "add", global("add"), []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}}, object.Limits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testIntegerObject(t, result, 3)
+	}
+	testIntegerObject(t, global("count"), 2)
+
+	result, _ := CallContext(ctx, env, "deep", global("deep"), []object.Object{&object.Integer{Value: 0}}, object.Limits{})
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Message != "stack overflow in deep" || !strings.HasPrefix(errObj.Trace[len(errObj.Trace)-1], "at deep ") {
+		t.Errorf("expected a stack overflow starting in deep, got %v", result)
+	}
+	result, _ = CallContext(ctx, env, "add", global("add"), []object.Object{&object.Integer{Value: 1}}, object.Limits{})
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "Wrong number of arguments: want=2, got=1" {
+		t.Errorf("expected the arguments to be counted, got %v", result)
+	}
+	_, err := CallContext(ctx, env, "spin", global("spin"), nil, object.Limits{MaxInstructions: 100})
+	var limitErr *object.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Errorf("expected the instruction limit to stop the call, got %v", err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		function string
+	}{
+		{"let f = fun(x int) int { f(x + 1) }; f(0)", "f"},
+		{"let even = fun(x int) bool { odd(x + 1) }; let odd = fun(x int) bool { even(x + 1) }; even(0)", "odd"},
+	}
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("expected a stack overflow for %q", tt.input)
+		}
+		if errObj.Message != "stack overflow in "+tt.function {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+		expectedOmitted := fmt.Sprintf("... %d more calls", MaxCallDepth+1-traceHead-traceTail)
+		if len(errObj.Trace) != traceHead+traceTail+1 || errObj.Trace[traceHead] != expectedOmitted {
+			t.Fatalf("expected a truncated trace. got=%q", errObj.Trace)
+		}
+		if !strings.HasPrefix(errObj.Trace[0], "at "+tt.function+" ") || !strings.HasPrefix(errObj.Trace[len(errObj.Trace)-1], "at <main> ") {
+			t.Errorf("wrong trace %q", errObj.Trace)
+		}
+	}
+}
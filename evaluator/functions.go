@@ -1,21 +1,33 @@
 package evaluator
 
 import (
+	"fmt"
+	"kol/ast"
 	"kol/object"
 	"kol/token"
 )
 
+// MaxCallDepth is the number of nested calls after which the evaluator reports a stack overflow,
+// deeper recursion would overflow the Go stack
+const MaxCallDepth = 1024
+
+// an overflow shows the innermost traceHead and the outermost traceTail calls
+const (
+	traceHead = 10
+	traceTail = 5
+)
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
 ) (*object.Environment, *object.Error) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIdx, param := range fn.Parameters {
-		typ, _ := object.TypeFromString(param.Type.Value)
+		typ, _ := object.TypeFromString(object.QualifyType(fn.Env.Module(), param.Type.Value))
 		if typ != args[paramIdx].Type() {
 			return nil, newError("Parameter %d not valid: Expected %s but got %s", param.Type.GetPosition(), paramIdx+1, typ, args[paramIdx].Type())
 		}
-		env.Set(param.Ident.Value, args[paramIdx])
+		env.SetValue(param.Ident.Value, object.Variable{Value: args[paramIdx], Mutable: false})
 	}
 	return env, nil
 }
@@ -28,25 +40,44 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	}
 	return obj
 }
-func applyFunction(fn object.Object, args []object.Object, pos token.Position) object.Object {
+func applyFunction(fn object.Object, args []object.Object, call *object.Call, std *object.IO) object.Object {
+	pos := call.Position
 	switch fn := fn.(type) {
 	case *object.Function:
 		if len(fn.Parameters) != len(args) {
 			return newError("Wrong number of arguments: want=%d, got=%d", pos, len(fn.Parameters), len(args))
 		}
+		if call.Depth > MaxCallDepth {
+			return stackOverflow(call)
+		}
 		extendedEnv, err := extendFunctionEnv(fn, args)
 		if err != nil {
 			return err
 		}
-		evaluated := Eval(fn.Body, extendedEnv)
+		extendedEnv.SetCall(call)
+		evaluated := evalBlockStatement(fn.Body, extendedEnv)
+		switch evaluated.(type) {
+		case *object.BreakValue:
+			return newError("break outside of a loop", fn.Body.GetPosition())
+		case *object.ContinueValue:
+			return newError("continue outside of a loop", fn.Body.GetPosition())
+		}
 		returnValue := unwrapReturnValue(evaluated)
-		typ, _ := object.TypeFromString(fn.ReturnType.Value)
+		if isError(returnValue) {
+			return returnValue
+		}
+		typ, _ := object.TypeFromString(object.QualifyType(fn.Env.Module(), fn.ReturnType.Value))
 		if returnValue.Type() != typ {
-			return newError("Returned type %s doesn't match expected type %s", fn.Body.GetPosition(), returnValue.Type(), fn.ReturnType.Value)
+			return newError("Returned type %s doesn't match expected type %s", fn.Body.GetPosition(), returnValue.Type(), typ)
 		}
 		return returnValue
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		result := fn.Call(std, args...)
+		if errObj, ok := result.(*object.Error); ok && errObj.Position == nil {
+			// builtins don't know where they were called, like on the VM their errors point at the call
+			errObj.Position = &pos
+		}
+		if result != nil {
 			return result
 		}
 		return VOID
@@ -54,3 +85,46 @@ func applyFunction(fn object.Object, args []object.Object, pos token.Position) o
 		return newError("not a function: %s", pos, fn.Type())
 	}
 }
+
+// calleeName names a called function by the variable it is called through
+func calleeName(function ast.Expression) string {
+	if ident, ok := function.(*ast.Identifier); ok {
+		return ident.Value
+	}
+	return "<anonymous>"
+}
+
+// stackOverflow reports a call nested too deep in the function making it, with the calls that led to it
+func stackOverflow(call *object.Call) *object.Error {
+	err := newError("stack overflow in %s", call.Position, callerName(call))
+	if call.File != "" {
+		err.File = call.File
+	}
+	for c := call; c != nil; c = c.Caller {
+		if c.Caller == nil && c.Position.Line == 0 {
+			// a call from Go, which isn't made in any function
+			break
+		}
+		if c.Depth == traceTail && call.Depth > traceHead+traceTail {
+			err.Trace = append(err.Trace, fmt.Sprintf("... %d more calls", call.Depth-traceHead-traceTail))
+		}
+		if call.Depth-c.Depth < traceHead || c.Depth <= traceTail {
+			err.Trace = append(err.Trace, fmt.Sprintf("at %s (%s)", callerName(c), location(c.File, c.Position)))
+		}
+	}
+	return err
+}
+
+// callerName names the function a call is made in
+func callerName(call *object.Call) string {
+	if call.Caller == nil {
+		return "<main>"
+	}
+	return call.Caller.Function
+}
+func location(file string, pos token.Position) string {
+	if file == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, pos.Line, pos.Column)
+}
@@ -56,11 +56,14 @@ func evalNumberInfixExpression(
 			return &object.Float{Value: leftVal * rightVal}
 		}
 	case "%":
-		if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-			return &object.Integer{Value: int64(leftVal) % int64(rightVal)}
-		} else {
+		if left.Type() != object.INTEGER_OBJ || right.Type() != object.INTEGER_OBJ {
 			return newError("Can't take the remainder of non-integers", pos)
 		}
+		divisor := right.(*object.Integer).Value
+		if divisor == 0 {
+			return newError("Can't take the remainder of a division by zero", pos)
+		}
+		return &object.Integer{Value: left.(*object.Integer).Value % divisor}
 	case "/":
 		return &object.Float{Value: leftVal / rightVal}
 	case "<":
@@ -92,6 +95,8 @@ func evalStringInfixExpression(
 		return &object.String{Value: leftVal + rightVal}
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
 		return newError("unknown operator: %s %s %s", pos,
 			left.Type(), operator, right.Type())
@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"context"
+	"kol/ast"
+	"kol/object"
+	"kol/token"
+)
+
+// EvalContext evaluates node like Eval until it ends, exceeds one of the limits or ctx is done.
+// Exceeding a limit fails with an *object.LimitError, a done context with ctx.Err().
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) (object.Object, error) {
+	return withBudget(ctx, env, limits, func() object.Object { return Eval(node, env) })
+}
+
+// CallContext calls a function of an evaluated program from Go with the limits of EvalContext.
+// env is the global environment of the program, the call uses its budget and I/O. name is what
+// the function is called in stack traces. Errors raised by the function are returned as an
+// *object.Error result like Eval does. It must not be called while an evaluation runs.
+func CallContext(ctx context.Context, env *object.Environment, name string, fn object.Object, args []object.Object, limits object.Limits) (object.Object, error) {
+	call := object.NewCall(nil, name, "", token.Position{})
+	return withBudget(ctx, env, limits, func() object.Object {
+		return applyFunctionWithBudget(env.Budget(), fn, args, call, env.IO())
+	})
+}
+
+// withBudget runs f with a budget for the limits shared by env and the environments created from it
+func withBudget(ctx context.Context, env *object.Environment, limits object.Limits, f func() object.Object) (object.Object, error) {
+	budget := env.Budget()
+	if budget == nil {
+		budget = &object.Budget{}
+		env.SetBudget(budget)
+	}
+	// environments created by earlier evaluations share the budget, so it is reset instead of replaced
+	*budget = *object.NewBudget(ctx, limits)
+	defer func() { *budget = *object.NewBudget(context.Background(), object.Limits{}) }()
+
+	result := f()
+	if err := budget.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// allocating reports whether evaluating a node creates a new object
+func allocating(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.PrefixExpression, *ast.InfixExpression,
+		*ast.ArrayLiteral, *ast.HashLiteral, *ast.StructLiteral, *ast.FunctionLiteral:
+		return true
+	}
+	return false
+}
+
+// applyFunctionWithBudget applies a function and counts the call and the result of builtins against the budget
+func applyFunctionWithBudget(budget *object.Budget, fn object.Object, args []object.Object, call *object.Call, std *object.IO) object.Object {
+	if _, ok := fn.(*object.Builtin); ok {
+		result := applyFunction(fn, args, call, std)
+		if err := budget.Allocate(object.Size(result)); err != nil {
+			return newError("%s", call.Position, err)
+		}
+		return result
+	}
+	if err := budget.Enter(); err != nil {
+		return newError("%s", call.Position, err)
+	}
+	defer budget.Leave()
+	return applyFunction(fn, args, call, std)
+}
@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/module"
+	"kol/object"
+)
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if env.HasValue(node.Name.Value) {
+		return newError("Variable %s can't be redefined", node.GetPosition(), node.Name.Value)
+	}
+	modules := env.Modules()
+	fileName := module.Resolve(env.FileName(), node.Path)
+	mod, ok := modules.Evaluated[fileName]
+	if !ok {
+		program, err := modules.Loader.Load(env.FileName(), fileName)
+		if parseErr, ok := err.(*module.ParseError); ok {
+			// reported at the first syntax error so it shows the source of the module
+			d := parseErr.Diagnostics()[0]
+			return &object.Error{Message: d.Message, Position: &d.Span.Start, File: d.Span.File, Code: d.Code}
+		}
+		if err != nil {
+			importErr := newError("%s", node.GetPosition(), err)
+			importErr.Code = diagnostic.ImportError
+			return importErr
+		}
+		moduleEnv := env.NewModuleEnvironment(node.Name.Value, fileName)
+		result := evalModule(program, moduleEnv)
+		modules.Loader.Done()
+		if err, ok := result.(*object.Error); ok {
+			if err.File == "" {
+				err.File = fileName
+			}
+			return err
+		}
+		mod = &object.Module{Name: node.Name.Value, Exports: make(map[string]object.Object)}
+		for _, name := range module.Exports(program) {
+			variable, _ := moduleEnv.Get(name)
+			mod.Exports[name] = variable.Value
+		}
+		modules.Evaluated[fileName] = mod
+	}
+	env.SetValue(node.Name.Value, object.Variable{Value: mod, Mutable: false})
+	return nil
+}
+func evalModule(program *ast.Program, env *object.Environment) object.Object {
+	for _, statement := range program.Statements {
+		switch result := Eval(statement, env).(type) {
+		case *object.Error:
+			return result
+		case *object.ReturnValue:
+			return newError("return outside of a function", statement.GetPosition())
+		case *object.BreakValue:
+			return newError("break outside of a loop", statement.GetPosition())
+		case *object.ContinueValue:
+			return newError("continue outside of a loop", statement.GetPosition())
+		}
+	}
+	return nil
+}
+func evalModuleAccess(mod *object.Module, field *ast.Identifier) object.Object {
+	value, ok := mod.Exports[field.Value]
+	if !ok {
+		return newError("Module %s has no export %s", field.GetPosition(), mod.Name, field.Value)
+	}
+	return value
+}
@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"kol/ast"
+	"kol/object"
+)
+
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	if env.HasValue(node.Name.Value) {
+		return newError("Variable %s can't be redefined", node.GetPosition(), node.Name.Value)
+	}
+	definition := &object.StructDefinition{Name: node.Name.Value, Module: env.Module()}
+	for _, field := range node.Fields {
+		definition.Fields = append(definition.Fields, object.StructField{Name: field.Ident.Value, Type: object.QualifyType(env.Module(), field.Type.Value)})
+	}
+	env.SetValue(node.Name.Value, object.Variable{Value: definition, Mutable: false})
+	return nil
+}
+func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	var obj object.Object
+	if node.Module != nil {
+		obj = evalIdentifier(node.Module, env)
+		if mod, ok := obj.(*object.Module); ok {
+			obj = evalModuleAccess(mod, node.Name)
+		} else if !isError(obj) {
+			obj = newError("%s is not a module", node.Module.GetPosition(), node.Module.Value)
+		}
+	} else {
+		obj = evalIdentifier(node.Name, env)
+	}
+	if isError(obj) {
+		return obj
+	}
+	definition, ok := obj.(*object.StructDefinition)
+	if !ok {
+		return newError("%s is not a struct", node.GetPosition(), node.Name.Value)
+	}
+	values := make(map[string]object.Object)
+	for _, field := range node.Fields {
+		if _, ok := values[field.Name.Value]; ok {
+			return newError("Field %s is set more than once", field.Name.GetPosition(), field.Name.Value)
+		}
+		value := Eval(field.Value, env)
+		if isError(value) {
+			return value
+		}
+		values[field.Name.Value] = value
+	}
+	result, err := definition.Instantiate(values)
+	if err != nil {
+		return newError("%s", node.GetPosition(), err)
+	}
+	return result
+}
+func evalFieldAccessExpression(left object.Object, field *ast.Identifier) object.Object {
+	if mod, ok := left.(*object.Module); ok {
+		return evalModuleAccess(mod, field)
+	}
+	structObject, ok := left.(*object.Struct)
+	if !ok {
+		return newError("field access not supported: %s", field.GetPosition(), left.Type())
+	}
+	value, ok := structObject.Fields[field.Value]
+	if !ok {
+		return newError("Struct %s has no field %s", field.GetPosition(), structObject.Definition.Name, field.Value)
+	}
+	return value
+}
@@ -0,0 +1,233 @@
+package format
+
+import (
+	"kol/ast"
+	"kol/parser"
+	"kol/token"
+	"sort"
+)
+
+func (p *printer) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.at(exp.GetPosition())
+		p.write(exp.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral:
+		p.at(exp.GetPosition())
+		p.write(exp.TokenLiteral())
+	case *ast.StringLiteral:
+		p.at(exp.GetPosition())
+		p.write("\"" + exp.Value + "\"")
+	case *ast.PrefixExpression:
+		p.at(exp.GetPosition())
+		p.write(exp.Operator)
+		p.operand(exp.Right, precedence(exp.Right) < parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := parser.Precedence(exp.Token.Type)
+		p.operand(exp.Left, precedence(exp.Left) < prec)
+		p.at(exp.GetPosition())
+		p.space()
+		p.write(exp.Operator + " ")
+		// all operators are left associative
+		p.operand(exp.Right, precedence(exp.Right) <= prec)
+	case *ast.IfExpression:
+		p.at(exp.GetPosition())
+		p.write("if ")
+		p.condition(exp.Condition)
+		p.write(" ")
+		p.block(exp.Consequence)
+		p.alternative(exp.Alternative)
+	case *ast.ForExpression:
+		p.at(exp.GetPosition())
+		p.write("for ")
+		p.condition(exp.Condition)
+		p.write(" ")
+		p.block(exp.Consequence)
+		p.alternative(exp.Alternative)
+	case *ast.FunctionLiteral:
+		p.at(exp.GetPosition())
+		p.write("fun")
+		p.function(exp)
+	case *ast.CallExpression:
+		p.operand(exp.Function, precedence(exp.Function) < parser.CALL)
+		p.list("(", ")", len(exp.Arguments), lastStart(exp.Arguments), false, false, func(p *printer, i int) {
+			p.expression(exp.Arguments[i])
+		})
+	case *ast.IndexExpression:
+		p.operand(exp.Left, precedence(exp.Left) < parser.CALL)
+		p.write("[")
+		p.expression(exp.Index)
+		p.write("]")
+	case *ast.FieldAccessExpression:
+		p.operand(exp.Left, precedence(exp.Left) < parser.CALL)
+		p.write(".")
+		p.at(exp.Field.GetPosition())
+		p.write(exp.Field.Value)
+	case *ast.ArrayLiteral:
+		p.at(exp.GetPosition())
+		p.list("[", "]", len(exp.Elements), lastStart(exp.Elements), false, false, func(p *printer, i int) {
+			p.expression(exp.Elements[i])
+		})
+	case *ast.HashLiteral:
+		p.at(exp.GetPosition())
+		keys := hashKeys(exp)
+		p.list("{", "}", len(keys), lastStart(keys), false, true, func(p *printer, i int) {
+			p.expression(keys[i])
+			p.write(": ")
+			p.expression(exp.Pairs[keys[i]])
+		})
+	case *ast.StructLiteral:
+		p.at(exp.GetPosition())
+		if exp.Module != nil {
+			p.write(exp.Module.Value + ".")
+		}
+		p.write(exp.Name.Value)
+		var last token.Position
+		if len(exp.Fields) > 0 {
+			last = exp.Fields[len(exp.Fields)-1].Name.GetPosition()
+		}
+		p.list("{", "}", len(exp.Fields), last, false, true, func(p *printer, i int) {
+			field := exp.Fields[i]
+			p.at(field.Name.GetPosition())
+			p.write(field.Name.Value + ": ")
+			p.expression(field.Value)
+		})
+	}
+}
+
+// operand prints a part of a larger expression, in parentheses if it binds weaker than its surroundings
+func (p *printer) operand(exp ast.Expression, parenthesize bool) {
+	if parenthesize {
+		p.write("(")
+		p.expression(exp)
+		p.write(")")
+		return
+	}
+	p.expression(exp)
+}
+
+// condition prints the condition of an if or a for. It needs parentheses if it starts with one,
+// as the parser would take them for the whole condition, or if it ends with a struct name
+// the body would be parsed as a literal of.
+func (p *printer) condition(exp ast.Expression) {
+	last := exp
+	for {
+		if infix, ok := last.(*ast.InfixExpression); ok && precedence(infix.Right) > parser.Precedence(infix.Token.Type) {
+			last = infix.Right
+		} else if prefix, ok := last.(*ast.PrefixExpression); ok && precedence(prefix.Right) >= parser.PREFIX {
+			last = prefix.Right
+		} else {
+			break
+		}
+	}
+	ident, ok := last.(*ast.Identifier)
+	p.operand(exp, firstChar(exp) == '(' || ok && p.structs[ident.Value])
+}
+func (p *printer) alternative(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	p.flushComments(block.Token.Position)
+	p.space()
+	p.write("else ")
+	p.block(block)
+}
+
+// function prints the parameters, return type and body of a function
+func (p *printer) function(fn *ast.FunctionLiteral) {
+	var last token.Position
+	if len(fn.Parameters) > 0 {
+		last = fn.Parameters[len(fn.Parameters)-1].Ident.GetPosition()
+	}
+	p.list("(", ")", len(fn.Parameters), last, false, false, func(p *printer, i int) {
+		param := fn.Parameters[i]
+		p.at(param.Ident.GetPosition())
+		p.write(param.Ident.Value + " " + param.Type.Value)
+	})
+	// a function without a return type gets the ) token as its type
+	if fn.ReturnType.Token.Literal == fn.ReturnType.Value {
+		p.write(" " + fn.ReturnType.Value)
+	}
+	p.write(" ")
+	p.block(fn.Body)
+}
+
+// precedence returns how strongly an expression binds to its operands
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.FieldAccessExpression:
+		return parser.INDEX
+	}
+	return parser.INDEX + 1
+}
+
+// firstChar returns the first character an expression is printed with
+func firstChar(exp ast.Expression) byte {
+	var left ast.Expression
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		if precedence(exp.Left) < parser.Precedence(exp.Token.Type) {
+			return '('
+		}
+		return firstChar(exp.Left)
+	case *ast.CallExpression:
+		left = exp.Function
+	case *ast.IndexExpression:
+		left = exp.Left
+	case *ast.FieldAccessExpression:
+		left = exp.Left
+	case *ast.PrefixExpression:
+		return exp.Operator[0]
+	case *ast.ArrayLiteral:
+		return '['
+	case *ast.HashLiteral:
+		return '{'
+	case *ast.StringLiteral:
+		return '"'
+	default:
+		return exp.TokenLiteral()[0]
+	}
+	if precedence(left) < parser.CALL {
+		return '('
+	}
+	return firstChar(left)
+}
+
+// hashKeys returns the keys of a hash literal in the order they were written in
+func hashKeys(hash *ast.HashLiteral) []ast.Expression {
+	keys := []ast.Expression{}
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return before(exprStart(keys[i]), exprStart(keys[j]))
+	})
+	return keys
+}
+func lastStart(exps []ast.Expression) token.Position {
+	if len(exps) == 0 {
+		return token.Position{}
+	}
+	return exprStart(exps[len(exps)-1])
+}
+
+// exprStart returns the position of the first token of an expression
+func exprStart(exp ast.Expression) token.Position {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return exprStart(exp.Left)
+	case *ast.CallExpression:
+		return exprStart(exp.Function)
+	case *ast.IndexExpression:
+		return exprStart(exp.Left)
+	case *ast.FieldAccessExpression:
+		return exprStart(exp.Left)
+	}
+	return exp.GetPosition()
+}
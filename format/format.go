@@ -0,0 +1,192 @@
+package format
+
+import (
+	"bytes"
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/lexer"
+	"kol/parser"
+	"kol/token"
+	"strings"
+)
+
+const indentation = "    "
+
+// maxWidth is the column after which calls and literals are split into one element per line
+const maxWidth = 80
+
+// Source reprints a program in the canonical style, keeping all of its comments.
+// Programs with syntax errors aren't formatted, their diagnostics are returned instead.
+func Source(input string) (string, []*diagnostic.Diagnostic) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", p.Diagnostics()
+	}
+
+	pr := &printer{lines: strings.Split(input, "\n"), comments: l.Comments(), structs: make(map[string]bool)}
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+		if s, ok := stmt.(*ast.StructStatement); ok {
+			pr.structs[s.Name.Value] = true
+		}
+	}
+	pr.statements(program.Statements)
+	pr.flushComments(token.Position{Line: len(pr.lines) + 1})
+	if pr.out.Len() == 0 {
+		return "", nil
+	}
+	return strings.TrimRight(pr.out.String(), " ") + "\n", nil
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+	// width of the current output line
+	column int
+	// line breaks to write before the next text, 2 leaves a blank line
+	newlines int
+
+	// the source split into lines, blank lines between statements are kept
+	lines []string
+	// comments that weren't printed yet
+	comments []token.Comment
+	// source line of the last printed token
+	line int
+	// structs declared at the top level, a condition ending with one needs parentheses
+	structs map[string]bool
+	// set while measuring the width of code, lists are never split then
+	measuring bool
+}
+
+func (p *printer) write(s string) {
+	if p.newlines > 0 && p.out.Len() > 0 {
+		p.out.Truncate(len(bytes.TrimRight(p.out.Bytes(), " ")))
+		p.out.WriteString(strings.Repeat("\n", p.newlines))
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.column = len(indentation) * p.indent
+	}
+	p.newlines = 0
+	p.out.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.column = len(s) - i - 1
+	} else {
+		p.column += len(s)
+	}
+}
+
+// space separates two tokens on the same line, nothing is needed at the start of a line
+func (p *printer) space() {
+	if p.newlines == 0 && !p.afterSpace() {
+		p.write(" ")
+	}
+}
+func (p *printer) afterSpace() bool {
+	return p.out.Len() > 0 && p.out.Bytes()[p.out.Len()-1] == ' '
+}
+func (p *printer) newline() {
+	p.newlines = max(p.newlines, 1)
+}
+
+// lineBreak starts a new line for code or a comment from the given source line,
+// a blank line above it in the source is kept unless it opens a block
+func (p *printer) lineBreak(line int) {
+	p.newline()
+	if p.out.Len() == 0 || line < 2 || line-2 >= len(p.lines) {
+		return
+	}
+	switch p.out.Bytes()[p.out.Len()-1] {
+	case '{', '(', '[':
+		return
+	}
+	if strings.TrimSpace(p.lines[line-2]) == "" {
+		p.newlines = 2
+	}
+}
+
+// at is called before printing the token at pos and prints the comments in front of it
+func (p *printer) at(pos token.Position) {
+	p.flushComments(pos)
+	p.line = pos.Line
+}
+func (p *printer) flushComments(pos token.Position) {
+	for p.hasCommentBefore(pos) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		if c.Position.Line == p.line && p.out.Len() > 0 {
+			// the comment trails the code on its line
+			newlines := p.newlines
+			p.newlines = 0
+			p.space()
+			p.write(c.Text + " ")
+			p.newlines = newlines
+		} else {
+			p.lineBreak(c.Position.Line)
+			p.write(c.Text)
+			p.newline()
+		}
+		if strings.HasPrefix(c.Text, "//") {
+			p.newline()
+		}
+		p.line = c.End.Line
+	}
+}
+func (p *printer) hasCommentBefore(pos token.Position) bool {
+	return len(p.comments) > 0 && before(p.comments[0].Position, pos)
+}
+func before(a token.Position, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// fits reports whether the code printed by print fits on the current line
+func (p *printer) fits(print func(p *printer)) bool {
+	measure := &printer{indent: p.indent, column: p.column, structs: p.structs, measuring: true}
+	print(measure)
+	line, _, _ := strings.Cut(measure.out.String(), "\n")
+	return p.column+len(line) <= maxWidth
+}
+
+// list prints the elements between open and close on one line if they fit, otherwise every element
+// goes on its own line. Comments in front of any but the first element also split the list.
+func (p *printer) list(open string, close string, n int, last token.Position, padded bool, trailingComma bool, element func(p *printer, i int)) {
+	if n == 0 {
+		p.write(open + close)
+		return
+	}
+	flat := func(p *printer) {
+		p.write(open)
+		if padded {
+			p.write(" ")
+		}
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			element(p, i)
+		}
+		if padded {
+			p.write(" ")
+		}
+		p.write(close)
+	}
+	if p.measuring || !p.hasCommentBefore(last) && p.fits(flat) {
+		flat(p)
+		return
+	}
+
+	p.write(open)
+	p.indent++
+	for i := 0; i < n; i++ {
+		p.newline()
+		element(p, i)
+		if i < n-1 || trailingComma {
+			p.write(",")
+		}
+	}
+	p.indent--
+	p.newline()
+	p.write(close)
+}
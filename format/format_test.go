@@ -0,0 +1,92 @@
+package format
+
+import (
+	"kol/lexer"
+	"kol/parser"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"let mut x = 1\nx+=2", "let mut x = 1;\nx += 2;\n"},
+		{"let a = (1+2)*3; let b = a-(2-1); let c = a-2-1", "let a = (1 + 2) * 3;\nlet b = a - (2 - 1);\nlet c = a - 2 - 1;\n"},
+		{"-(a+b); !(a==b); (-a).b; f(1).x", "-(a + b);\n!(a == b);\n(-a).b;\nf(1).x;\n"},
+		{"if (a > b) { a } else { b }", "if a > b {\n    a;\n} else {\n    b;\n}\n"},
+		{"if ((a)+1 > b) { a }", "if a + 1 > b {\n    a;\n}\n"},
+		{"if ((a + 1) * 2 > b) { a }", "if ((a + 1) * 2 > b) {\n    a;\n}\n"},
+		{"struct P { x int }\nif (a == P) { a }", "struct P { x int }\nif (a == P) {\n    a;\n}\n"},
+		{"for (true) {} [1]", "for true {}[1];\n"},
+		{"for (true) {}; [1]", "for true {};\n[1];\n"},
+		{"for (true) {}; -1; for (true) {}; 2", "for true {};\n-1;\nfor true {}\n2;\n"},
+		{"fun add(a int,b int) int {a+b}\nlet f = fun() {}", "fun add(a int, b int) int {\n    a + b;\n}\nlet f = fun() {};\n"},
+		{"struct Point {x int,y int}\nlet p = Point{x:1,y:2}", "struct Point { x int, y int }\nlet p = Point{x: 1, y: 2};\n"},
+		{`let h = {"b": 2, "a": 1}`, "let h = {\"b\": 2, \"a\": 1};\n"},
+		{`import "lib/math"
+export fun f() {}
+export let x = 1`, "import \"lib/math\";\nexport fun f() {}\nexport let x = 1;\n"},
+		{"for true { if x { break } else { continue } }", "for true {\n    if x {\n        break;\n    } else {\n        continue;\n    }\n}\n"},
+		{"let f = fun() { return; }", "let f = fun() {\n    return;\n};\n"},
+		{
+			`println("a very long format string that goes on and on", add(1, 2), add(3, 4), add(5, 6))`,
+			"println(\n    \"a very long format string that goes on and on\",\n    add(1, 2),\n    add(3, 4),\n    add(5, 6)\n);\n",
+		},
+		{
+			`let h = {"first key": "first value", "second key": "second value", "third key": 3}`,
+			"let h = {\n    \"first key\": \"first value\",\n    \"second key\": \"second value\",\n    \"third key\": 3,\n};\n",
+		},
+		// comments
+		{"// header\n\n\nlet x = 1 // trailing\nlet y = 2", "// header\n\nlet x = 1; // trailing\nlet y = 2;\n"},
+		{"let x = 1 /* a */ + /* b */ 2", "let x = 1 /* a */ + /* b */ 2;\n"},
+		{"fun f() {\n  // only a comment\n}", "fun f() {\n    // only a comment\n}\n"},
+		{"fun f() { // opening\n  x\n  // closing\n}", "fun f() { // opening\n    x;\n    // closing\n}\n"},
+		{"if a {\n  1\n} // after if\nelse { 2 }", "if a {\n    1;\n} // after if\nelse {\n    2;\n}\n"},
+		{"f(1, // one\n  2)", "f(\n    1, // one\n    2\n);\n"},
+		{"let h = {\n  // first\n  \"a\": 1,\n  \"b\": 2 }", "let h = {\n    // first\n    \"a\": 1,\n    \"b\": 2,\n};\n"},
+		{"/* block\n   comment */\nlet x = 1\n\n\n// end", "/* block\n   comment */\nlet x = 1;\n\n// end\n"},
+		{"// only comments", "// only comments\n"},
+		{"let x = 1 /* end */", "let x = 1; /* end */\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		formatted, diagnostics := Source(tt.input)
+		if len(diagnostics) != 0 {
+			t.Errorf("unexpected diagnostics for %q: %s", tt.input, diagnostics[0])
+			continue
+		}
+		if formatted != tt.expected {
+			t.Errorf("wrong formatting for %q.\nexpected=\n%s\ngot=\n%s", tt.input, tt.expected, formatted)
+			continue
+		}
+		again, _ := Source(formatted)
+		if again != formatted {
+			t.Errorf("formatting isn't idempotent for %q.\nfirst=\n%s\nsecond=\n%s", tt.input, formatted, again)
+		}
+		if !strings.Contains(tt.input, "{\"") && !strings.Contains(tt.input, "{\n") {
+			// hash literals print their pairs in random order
+			if parse(t, tt.input) != parse(t, formatted) {
+				t.Errorf("formatting changed the program %q.\nexpected=%s\ngot=%s", tt.input, parse(t, tt.input), parse(t, formatted))
+			}
+		}
+	}
+}
+
+func TestSourceWithErrors(t *testing.T) {
+	_, diagnostics := Source("let = 1")
+	if len(diagnostics) != 1 || diagnostics[0].Error() != "Error at 1:5: expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong diagnostics. got=%v", diagnostics)
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+	return program.String()
+}
@@ -0,0 +1,156 @@
+package format
+
+import (
+	"kol/ast"
+	"kol/token"
+)
+
+func (p *printer) statements(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+		pos := start(stmt)
+		p.flushComments(pos)
+		p.lineBreak(pos.Line)
+		p.statement(stmt, next)
+	}
+}
+func (p *printer) statement(stmt ast.Statement, next ast.Statement) {
+	p.at(stmt.GetPosition())
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.letStatement(stmt)
+	case *ast.ReassignStatement:
+		p.reassignStatement(stmt)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue)
+		}
+		p.write(";")
+	case *ast.BreakStatement:
+		p.write("break")
+		if stmt.BreakValue != nil {
+			p.write(" ")
+			p.expression(stmt.BreakValue)
+		}
+		p.write(";")
+	case *ast.ContinueStatement:
+		p.write("continue;")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+		if !endsWithBlock(stmt.Expression) || continuesExpression(next) {
+			p.write(";")
+		}
+	case *ast.StructStatement:
+		p.structStatement(stmt)
+	case *ast.ImportStatement:
+		p.write("import \"" + stmt.Path + "\";")
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.statement(stmt.Statement, next)
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+func (p *printer) letStatement(stmt *ast.LetStatement) {
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && isFunctionDeclaration(stmt) {
+		p.write("fun ")
+		p.at(stmt.Name.GetPosition())
+		p.write(stmt.Name.Value)
+		p.function(fn)
+		return
+	}
+	p.write("let ")
+	if stmt.Mutable {
+		p.write("mut ")
+	}
+	p.at(stmt.Name.GetPosition())
+	p.write(stmt.Name.Value + " = ")
+	p.expression(stmt.Value)
+	p.write(";")
+}
+
+// isFunctionDeclaration reports whether a let statement was written as fun name() {},
+// the parser gives the let statement the position of the fun keyword then
+func isFunctionDeclaration(stmt *ast.LetStatement) bool {
+	fn, ok := stmt.Value.(*ast.FunctionLiteral)
+	return ok && stmt.Token.Position == fn.Token.Position
+}
+func (p *printer) reassignStatement(stmt *ast.ReassignStatement) {
+	p.write(stmt.Name.Value + " " + stmt.Operator + " ")
+	if infix, ok := stmt.Value.(*ast.InfixExpression); ok && stmt.Operator != "=" {
+		// the operation of a compound assignment only adds the right side
+		p.expression(infix.Right)
+	} else {
+		p.expression(stmt.Value)
+	}
+	p.write(";")
+}
+func (p *printer) structStatement(stmt *ast.StructStatement) {
+	p.write("struct ")
+	p.at(stmt.Name.GetPosition())
+	p.write(stmt.Name.Value + " ")
+	var last token.Position
+	if len(stmt.Fields) > 0 {
+		last = stmt.Fields[len(stmt.Fields)-1].GetPosition()
+	}
+	p.list("{", "}", len(stmt.Fields), last, true, true, func(p *printer, i int) {
+		field := stmt.Fields[i]
+		p.at(field.GetPosition())
+		p.write(field.Ident.Value + " " + field.Type.Value)
+	})
+}
+func (p *printer) block(block *ast.BlockStatement) {
+	p.at(block.Token.Position)
+	if len(block.Statements) == 0 && !p.hasCommentBefore(block.Rbrace.Position) {
+		p.write("{}")
+		p.line = block.Rbrace.Position.Line
+		return
+	}
+	p.write("{")
+	p.indent++
+	p.statements(block.Statements)
+	p.flushComments(block.Rbrace.Position)
+	p.indent--
+	p.newline()
+	p.at(block.Rbrace.Position)
+	p.write("}")
+}
+
+// endsWithBlock reports whether an expression statement ends with a closing brace and needs no semicolon
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.ForExpression:
+		return true
+	}
+	return false
+}
+
+// continuesExpression reports whether a statement would be parsed as part of
+// the expression in front of it if there was no semicolon between them
+func continuesExpression(stmt ast.Statement) bool {
+	exp, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	switch firstChar(exp.Expression) {
+	case '(', '[', '-':
+		return true
+	}
+	return false
+}
+
+// start returns the position of the first token of a statement
+func start(stmt ast.Statement) token.Position {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return stmt.Token.Position
+	case *ast.ReassignStatement:
+		return stmt.Name.GetPosition()
+	}
+	return stmt.GetPosition()
+}
@@ -0,0 +1,512 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"kol/object"
+	"kol/vm"
+	"reflect"
+	"strconv"
+)
+
+// ConversionError is returned when a value has no counterpart in the other language
+type ConversionError struct {
+	// where the value is inside the converted one, like [1].name, empty for the value itself
+	Path string
+	From string
+	To   string
+	// why the conversion failed, if the types alone don't tell
+	Reason string
+}
+
+func (e *ConversionError) Error() string {
+	msg := fmt.Sprintf("can't convert %s to %s", e.From, e.To)
+	if e.Path != "" {
+		msg += " at " + e.Path
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToKol converts a Go value to a Kol value. Numbers, bools, strings, slices, arrays, maps with string keys
+// and structs are converted recursively, nil and nil pointers become void. Structs become Kol structs
+// named like their type, with their exported fields named by a `kol:"name"` tag or else the field
+// name, a tag of "-" leaves a field out. Funcs become builtins, see Func. Values that contain
+// themselves can't be converted.
+func ToKol(value any) (object.Object, error) {
+	return toKol(reflect.ValueOf(value), "")
+}
+func toKol(v reflect.Value, path string) (object.Object, error) {
+	c := &converter{visiting: make(map[visit]string)}
+	return c.toKol(v, path)
+}
+
+// visit identifies a pointer, map or slice, slices of the same array differ in their length
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// converter converts a Go value to a Kol value, it remembers the references on the path to the
+// value being converted and their paths to detect cycles
+type converter struct {
+	visiting map[visit]string
+}
+
+func (c *converter) toKol(v reflect.Value, path string) (object.Object, error) {
+	if !v.IsValid() {
+		return vm.Void, nil
+	}
+	if v.Type().Implements(objectType) && v.Kind() != reflect.Struct {
+		if v.IsNil() {
+			return vm.Void, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if first, ok := c.visiting[key]; ok {
+			if first == "" {
+				first = "the value itself"
+			}
+			return nil, &ConversionError{Path: path, From: v.Type().String(), To: "a Kol value", Reason: "it refers back to " + first}
+		}
+		c.visiting[key] = path
+		defer delete(c.visiting, key)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return object.True, nil
+		}
+		return object.False, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, &ConversionError{Path: path, From: v.Type().String(), To: object.INTEGER_OBJ, Reason: fmt.Sprintf("%d overflows int64", v.Uint())}
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return &object.Array{Elements: []object.Object{}}, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			element, err := c.toKol(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, &ConversionError{Path: path, From: v.Type().String(), To: object.HASH_OBJ, Reason: "only strings can be keys"}
+		}
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := &object.String{Value: iter.Key().String()}
+			value, err := c.toKol(iter.Value(), path+"["+strconv.Quote(key.Value)+"]")
+			if err != nil {
+				return nil, err
+			}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Struct:
+		return c.structToKol(v, path)
+	case reflect.Func:
+		if v.IsNil() {
+			return vm.Void, nil
+		}
+		builtin, err := Func(v.Interface())
+		if err != nil {
+			return nil, &ConversionError{Path: path, From: v.Type().String(), To: object.BUILTIN_OBJ, Reason: err.Error()}
+		}
+		return builtin, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return vm.Void, nil
+		}
+		return c.toKol(v.Elem(), path)
+	}
+	return nil, &ConversionError{Path: path, From: v.Type().String(), To: "a Kol value"}
+}
+func (c *converter) structToKol(v reflect.Value, path string) (object.Object, error) {
+	t := v.Type()
+	if t.Name() == "" {
+		return nil, &ConversionError{Path: path, From: t.String(), To: "a Kol struct", Reason: "anonymous structs have no name"}
+	}
+	definition := &object.StructDefinition{Name: t.Name()}
+	values := make(map[string]object.Object)
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		value, err := c.toKol(v.Field(i), path+"."+name)
+		if err != nil {
+			return nil, err
+		}
+		definition.Fields = append(definition.Fields, object.StructField{Name: name, Type: typeName(value)})
+		values[name] = value
+	}
+	return &object.Struct{Definition: definition, Fields: values}, nil
+}
+
+// fieldName returns the Kol name of a struct field, false for fields that aren't converted
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	switch tag := field.Tag.Get("kol"); tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// typeName returns the name of a value's type in the source code
+func typeName(obj object.Object) string {
+	switch obj.(type) {
+	case *object.Integer:
+		return "int"
+	case *object.Float:
+		return "float"
+	case *object.Boolean:
+		return "bool"
+	case *object.String:
+		return "str"
+	case *object.Array:
+		return "array"
+	case *object.Hash:
+		return "map"
+	case *object.Builtin, *object.Closure, *object.Function:
+		return "fn"
+	case *object.Void:
+		return "void"
+	}
+	return string(obj.Type())
+}
+
+// FromKol stores a Kol value in the Go value target points to, converting it like ToKol the other way.
+// A target of type any gets int64, float64, bool, string, []any or map[string]any for arrays, maps and
+// structs, nil for void and the Kol value itself for functions.
+func FromKol(obj object.Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("FromKol needs a non-nil pointer, got %T", target)
+	}
+	return fromKol(obj, v.Elem(), "")
+}
+func fromKol(obj object.Object, v reflect.Value, path string) error {
+	if obj == nil {
+		obj = vm.Void
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		natural, err := natural(obj, path)
+		if err != nil {
+			return err
+		}
+		if natural == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(natural))
+		}
+		return nil
+	}
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if _, ok := obj.(*object.Void); ok {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func:
+			v.SetZero()
+			return nil
+		}
+	}
+	mismatch := &ConversionError{Path: path, From: string(obj.Type()), To: t.String()}
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch
+		}
+		if v.OverflowInt(i.Value) {
+			mismatch.Reason = fmt.Sprintf("%d overflows %s", i.Value, t)
+			return mismatch
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			mismatch.Reason = fmt.Sprintf("%d overflows %s", i.Value, t)
+			return mismatch
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.Float32, reflect.Float64:
+		if !object.IsNumber(obj) {
+			return mismatch
+		}
+		v.SetFloat(object.GetNumber(obj))
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return mismatch
+		}
+		v.SetString(s.Value)
+	case reflect.Slice, reflect.Array:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch
+		}
+		if t.Kind() == reflect.Array && t.Len() != len(arr.Elements) {
+			mismatch.Reason = fmt.Sprintf("the array has %d elements", len(arr.Elements))
+			return mismatch
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements)))
+		}
+		for i, element := range arr.Elements {
+			if err := fromKol(element, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key := reflect.New(t.Key()).Elem()
+			if err := fromKol(pair.Key, key, path); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromKol(pair.Value, value, path+"["+pair.Key.Inspect()+"]"); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		fields, ok := structFields(obj)
+		if !ok {
+			return mismatch
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			if value, ok := fields[name]; ok {
+				if err := fromKol(value, v.Field(i), path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Pointer:
+		elem := reflect.New(t.Elem())
+		if err := fromKol(obj, elem.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elem)
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+// structFields returns the fields of a struct or of a map with string keys by their names
+func structFields(obj object.Object) (map[string]object.Object, bool) {
+	switch obj := obj.(type) {
+	case *object.Struct:
+		return obj.Fields, true
+	case *object.Hash:
+		fields := make(map[string]object.Object, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			fields[pair.Key.Inspect()] = pair.Value
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// natural converts a Kol value to the Go value closest to it
+func natural(obj object.Object, path string) (any, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Void:
+		return nil, nil
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := natural(element, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash, *object.Struct:
+		fields, _ := structFields(obj)
+		m := make(map[string]any, len(fields))
+		for name, field := range fields {
+			value, err := natural(field, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = value
+		}
+		return m, nil
+	case *object.Builtin, *object.Closure, *object.Function:
+		return obj, nil
+	}
+	return nil, &ConversionError{Path: path, From: string(obj.Type()), To: "a Go value"}
+}
+
+// Func wraps a Go func as a builtin. Its arguments are converted with FromKol and its result with ToKol,
+// it may return a value, an error or both, a non-nil error fails the call with the error's message.
+// A first parameter of type *object.IO receives the I/O of the run instead of an argument.
+func Func(fn any) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("expected a func, got %T", fn)
+	}
+	returnsValue, returnsError, err := results(t)
+	if err != nil {
+		return nil, err
+	}
+	// the index of the first parameter that takes an argument
+	first := 0
+	if t.NumIn() > 0 && t.In(0) == reflect.TypeOf((*object.IO)(nil)) {
+		first = 1
+	}
+	signature := &object.Signature{Return: "void", Variadic: t.IsVariadic()}
+	for i := first; i < t.NumIn(); i++ {
+		param := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			param = param.Elem()
+		}
+		signature.Parameters = append(signature.Parameters, staticTypeName(param))
+	}
+	if returnsValue {
+		signature.Return = staticTypeName(t.Out(0))
+	}
+
+	call := func(std *object.IO, args ...object.Object) object.Object {
+		in := make([]reflect.Value, first, first+len(args))
+		if first == 1 {
+			in[0] = reflect.ValueOf(std)
+		}
+		for i, arg := range args {
+			param := t.In(min(first+i, t.NumIn()-1))
+			if t.IsVariadic() && first+i >= t.NumIn()-1 {
+				param = param.Elem()
+			}
+			value := reflect.New(param).Elem()
+			if err := fromKol(arg, value, fmt.Sprintf("argument %d", i+1)); err != nil {
+				return &object.Error{Message: err.Error()}
+			}
+			in = append(in, value)
+		}
+		out := v.Call(in)
+		if returnsError && !out[len(out)-1].IsNil() {
+			return &object.Error{Message: out[len(out)-1].Interface().(error).Error()}
+		}
+		if !returnsValue {
+			return nil
+		}
+		result, err := toKol(out[0], "result")
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}
+	return &object.Builtin{Fn: call, Signature: signature}, nil
+}
+
+// results checks that a func returns at most a value and an error
+func results(t reflect.Type) (returnsValue bool, returnsError bool, err error) {
+	switch {
+	case t.NumOut() == 0:
+		return false, false, nil
+	case t.NumOut() == 1 && t.Out(0) == errorType:
+		return false, true, nil
+	case t.NumOut() == 1:
+		return true, false, nil
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+		return true, true, nil
+	}
+	return false, false, errors.New("a func can only return a value, an error or both")
+}
+
+// staticTypeName names the Kol type the values of a Go type convert to, struct types and
+// types converted at runtime are any
+func staticTypeName(t reflect.Type) string {
+	if t.Implements(objectType) {
+		return object.AnyType
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "str"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "map"
+	case reflect.Func:
+		return "fn"
+	}
+	return object.AnyType
+}
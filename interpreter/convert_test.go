@@ -0,0 +1,261 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kol/object"
+	"kol/vm"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X      int    `kol:"x"`
+	Y      int    `kol:"y"`
+	Label  string `kol:"-"`
+	hidden bool
+}
+type shape struct {
+	Name   string
+	Points []point
+	Origin *point
+}
+
+func TestToKol(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{42, "42"},
+		{uint8(7), "7"},
+		{1.5, "1.5"},
+		{"kol", "kol"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]int(nil), "[]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{point{X: 1, Y: 2, Label: "p"}, "point{x: 1, y: 2}"},
+		{&shape{Name: "line", Points: []point{{X: 1}}}, "shape{Name: line, Points: [point{x: 1, y: 0}], Origin: void}"},
+		{nil, "void"},
+		{&object.Integer{Value: 3}, "3"},
+	}
+	for _, tt := range tests {
+		obj, err := ToKol(tt.value)
+		if err != nil {
+			t.Fatalf("%#v: %s", tt.value, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: expected %q, got %q", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+	if obj, _ := ToKol(true); obj != object.True {
+		t.Errorf("expected the shared true, got %v", obj)
+	}
+	obj, _ := ToKol(shape{})
+	definition := obj.(*object.Struct).Definition
+	if fmt.Sprint(definition.Fields) != "[{Name str} {Points array} {Origin void}]" {
+		t.Errorf("wrong struct definition %v", definition.Fields)
+	}
+}
+
+func TestToKolErrors(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{map[int]string{}, "can't convert map[int]string to HASH: only strings can be keys"},
+		{[]any{1, make(chan int)}, "can't convert chan int to a Kol value at [1]"},
+		{map[string]uint64{"big": 1 << 63}, `can't convert uint64 to INTEGER at ["big"]: 9223372036854775808 overflows int64`},
+		{struct{ A int }{1}, "can't convert struct { A int } to a Kol struct: anonymous structs have no name"},
+		{func() (int, int) { return 1, 2 }, "can't convert func() (int, int) to BUILTIN: a func can only return a value, an error or both"},
+	}
+	for _, tt := range tests {
+		_, err := ToKol(tt.value)
+		var convErr *ConversionError
+		if !errors.As(err, &convErr) || err.Error() != tt.expected {
+			t.Errorf("%#v: expected %q, got %v", tt.value, tt.expected, err)
+		}
+	}
+}
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+func TestToKolCycles(t *testing.T) {
+	self := &node{Value: 1}
+	self.Next = self
+	pair := &node{Value: 1, Next: &node{Value: 2}}
+	pair.Next.Next = pair
+	m := map[string]any{}
+	m["self"] = m
+	s := []any{1, nil}
+	s[1] = s
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{self, "can't convert *interpreter.node to a Kol value at .Next: it refers back to the value itself"},
+		{[]*node{pair}, "can't convert *interpreter.node to a Kol value at [0].Next.Next: it refers back to [0]"},
+		{m, `can't convert map[string]interface {} to a Kol value at ["self"]: it refers back to the value itself`},
+		{s, "can't convert []interface {} to a Kol value at [1]: it refers back to the value itself"},
+	}
+	for _, tt := range tests {
+		_, err := ToKol(tt.value)
+		var convErr *ConversionError
+		if !errors.As(err, &convErr) || err.Error() != tt.expected {
+			t.Errorf("expected %q, got %v", tt.expected, err)
+		}
+	}
+	// values referenced twice without a cycle are converted twice
+	shared := &point{X: 1}
+	obj, err := ToKol([]*point{shared, shared})
+	if err != nil || obj.Inspect() != "[point{x: 1, y: 0}, point{x: 1, y: 0}]" {
+		t.Errorf("expected a shared pointer to be converted, got %v, %v", obj, err)
+	}
+}
+
+func run(t *testing.T, interp *Interpreter, input string) object.Object {
+	t.Helper()
+	result, err := interp.Run(context.Background(), "main.kol", input)
+	if err != nil {
+		t.Fatalf("%q: %s", input, err)
+	}
+	return result
+}
+
+func TestFromKol(t *testing.T) {
+	interp := New()
+	var i int
+	var small int8
+	var f float64
+	var s []string
+	var m map[string]int
+	var p *point
+	var a any
+	var obj object.Object
+	var integer *object.Integer
+	tests := []struct {
+		input    string
+		target   any
+		expected any
+	}{
+		{"40 + 2", &i, 42},
+		{"-5", &small, int8(-5)},
+		{"2", &f, 2.0},
+		{`["a", "b"]`, &s, []string{"a", "b"}},
+		{`{"a": 1, "b": 2}`, &m, map[string]int{"a": 1, "b": 2}},
+		{"struct point { x int, y int }; point{x: 1, y: 2}", &p, &point{X: 1, Y: 2}},
+		{`{"x": 3}`, &p, &point{X: 3}},
+		{`[1, "a", true, 1.5, {"k": [2]}]`, &a, []any{int64(1), "a", true, 1.5, map[string]any{"k": []any{int64(2)}}}},
+		{"7", &obj, &object.Integer{Value: 7}},
+		{"8", &integer, &object.Integer{Value: 8}},
+	}
+	for _, tt := range tests {
+		if err := FromKol(run(t, interp, tt.input), tt.target); err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		got := reflect.ValueOf(tt.target).Elem().Interface()
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFromKolErrors(t *testing.T) {
+	interp := New()
+	var small int8
+	var u uint
+	var ints []int
+	var pair [2]int
+	var pts map[string]point
+	tests := []struct {
+		input    string
+		target   any
+		expected string
+	}{
+		{"1", small, "FromKol needs a non-nil pointer, got int8"},
+		{"300", &small, "can't convert INTEGER to int8: 300 overflows int8"},
+		{"-1", &u, "can't convert INTEGER to uint: -1 overflows uint"},
+		{`[1, "a"]`, &ints, "can't convert STRING to int at [1]"},
+		{"[1]", &pair, "can't convert ARRAY to [2]int: the array has 1 elements"},
+		{`{"a": {"x": true}}`, &pts, "can't convert BOOLEAN to int at [a].x"},
+		{"fun() {}", &ints, "can't convert CLOSURE to []int"},
+	}
+	for _, tt := range tests {
+		err := FromKol(run(t, interp, tt.input), tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interp := New()
+	funcs := map[string]any{
+		"repeat": strings.Repeat,
+		"total": func(xs ...float64) float64 {
+			sum := 0.0
+			for _, x := range xs {
+				sum += x
+			}
+			return sum
+		},
+		"norm": func(p point) int { return p.X*p.X + p.Y*p.Y },
+		"half": func(n int) (int, error) {
+			if n%2 != 0 {
+				return 0, fmt.Errorf("%d is odd", n)
+			}
+			return n / 2, nil
+		},
+		"origin": func() *point { return &point{} },
+	}
+	for name, fn := range funcs {
+		if err := interp.RegisterFunc(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{"total(1.5, 2.5)", "4"},
+		{"struct point { x int, y int }; norm(point{x: 3, y: 4})", "25"},
+		{`norm({"x": 1, "y": 1})`, "2"},
+		{"half(8) + 1", "5"},
+		{"origin().x", "0"},
+	}
+	for _, tt := range tests {
+		if result := run(t, interp, tt.input); result.Inspect() != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"half(3)", "3 is odd"},
+		{"norm(1)", "can't convert INTEGER to interpreter.point at argument 1"},
+		{`repeat("a", 1, 2)`, "Error at main.kol:1:7: Wrong number of arguments: want=2, got=3"},
+		{`total(1.5, "a")`, "Error at main.kol:1:12: Parameter 2 not valid: Expected float but got str"},
+	}
+	for _, tt := range errorTests {
+		_, err := interp.Run(context.Background(), "main.kol", tt.input)
+		var runtimeErr *vm.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			if runtimeErr.Message != tt.expected {
+				t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, runtimeErr.Message)
+			}
+		} else if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+	if err := interp.RegisterFunc("f", 1); err == nil || err.Error() != "can't register f: expected a func, got int" {
+		t.Errorf("expected an error for a non-func, got %v", err)
+	}
+}
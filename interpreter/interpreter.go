@@ -0,0 +1,179 @@
+// Package interpreter runs Kol programs inside Go applications. Every Interpreter has its own
+// builtins, applications register Go functions on it that their programs can call.
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"kol/engine"
+	"kol/lexer"
+	"kol/object"
+	"kol/token"
+	"kol/typecheck"
+	"maps"
+	"slices"
+)
+
+// maxBuiltins is the number of builtins OpGetBuiltin can address with its one byte operand
+const maxBuiltins = 256
+
+// Interpreter runs programs with its engine. Register must not be called while a program runs.
+type Interpreter struct {
+	builtins []object.BuiltinDefinition
+	// the signatures of the registered functions for the type checker
+	signatures map[string]*typecheck.Function
+	limits     object.Limits
+	engine     Engine
+	// the streams of the programs, nil for the standard streams of the process
+	io *object.IO
+}
+
+// Engine selects what runs the programs of an interpreter
+type Engine int
+
+const (
+	// VM compiles programs to bytecode first, which runs about ten times faster
+	VM Engine = iota
+	// Evaluator walks the syntax tree of programs
+	Evaluator
+)
+
+// New creates an interpreter with the default builtins
+func New() *Interpreter {
+	return &Interpreter{
+		builtins:   slices.Clone(object.Builtins),
+		signatures: make(map[string]*typecheck.Function),
+	}
+}
+
+// Register makes fn callable as name, replacing a builtin of the same name. The arguments are checked
+// against the signature before the program runs where their types are known and again on every call.
+func (i *Interpreter) Register(name string, signature object.Signature, fn object.BuiltinFunction) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	if err := signature.Validate(); err != nil {
+		return fmt.Errorf("invalid signature of %s: %w", name, err)
+	}
+	signature.Parameters = slices.Clone(signature.Parameters)
+	return i.register(name, &object.Builtin{Fn: fn, Signature: &signature})
+}
+
+// RegisterFunc makes a Go func callable as name, its signature follows from its type, see Func
+func (i *Interpreter) RegisterFunc(name string, fn any) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	builtin, err := Func(fn)
+	if err != nil {
+		return fmt.Errorf("can't register %s: %w", name, err)
+	}
+	return i.register(name, builtin)
+}
+func (i *Interpreter) register(name string, builtin *object.Builtin) error {
+	signature := builtin.Signature
+	index := slices.IndexFunc(i.builtins, func(def object.BuiltinDefinition) bool { return def.Name == name })
+	if index >= 0 {
+		i.builtins[index].Builtin = builtin
+	} else if len(i.builtins) == maxBuiltins {
+		return fmt.Errorf("can't register %s, an interpreter has at most %d builtins", name, maxBuiltins)
+	} else {
+		i.builtins = append(i.builtins, object.BuiltinDefinition{Name: name, Builtin: builtin})
+	}
+
+	parameters := make([]typecheck.Type, len(signature.Parameters))
+	for j, param := range signature.Parameters {
+		parameters[j] = staticType(param)
+	}
+	i.signatures[name] = &typecheck.Function{Parameters: parameters, Return: staticType(signature.Return), Variadic: signature.Variadic}
+	return nil
+}
+
+// SetLimits bounds the work of the programs run afterwards
+func (i *Interpreter) SetLimits(limits object.Limits) {
+	i.limits = limits
+}
+
+// SetEngine selects what runs the programs loaded afterwards, the VM unless set
+func (i *Interpreter) SetEngine(engine Engine) {
+	i.engine = engine
+}
+
+// WithIO returns a copy of the interpreter whose programs read and write io instead of the standard
+// streams, to capture the output of every request for example. The copy registers functions separately.
+func (i *Interpreter) WithIO(io *object.IO) *Interpreter {
+	copied := *i
+	copied.builtins = slices.Clone(i.builtins)
+	copied.signatures = maps.Clone(i.signatures)
+	copied.io = io
+	return &copied
+}
+
+// Run runs a program like Load and returns the value of its last expression statement
+func (i *Interpreter) Run(ctx context.Context, fileName string, input string) (object.Object, error) {
+	script, err := i.Load(ctx, fileName, input)
+	if err != nil {
+		return nil, err
+	}
+	return script.Result, nil
+}
+
+// Load parses, type checks and runs a program, Go code can call its functions afterwards. fileName is
+// shown in errors and imports are resolved relative to it. Syntax, type and compile errors are returned
+// as an *Error, runtime errors as a *vm.RuntimeError or as a *diagnostic.Diagnostic by the Evaluator.
+func (i *Interpreter) Load(ctx context.Context, fileName string, input string) (*Script, error) {
+	options := engine.Options{Builtins: i.builtins, Signatures: i.signatures, Limits: i.limits, IO: i.io}
+	script := &Script{engine: engine.NewVM(options)}
+	if i.engine == Evaluator {
+		script.engine = engine.NewEvaluator(options)
+	}
+	result, err := script.engine.Run(ctx, fileName, input)
+	if err != nil {
+		return nil, err
+	}
+	script.Result = result
+	return script, nil
+}
+
+// Script is a program that has run, its globals stay alive for Go code to read and call
+type Script struct {
+	// the value of the last expression statement of the program
+	Result object.Object
+	engine engine.Engine
+}
+
+// Global returns the value of a global variable of the program
+func (s *Script) Global(name string) (object.Object, bool) {
+	return s.engine.Global(name)
+}
+
+// Call calls a global function of the program with arguments converted by ToKol. It fails like Load
+// when the function raises an error.
+func (s *Script) Call(ctx context.Context, name string, args ...any) (object.Object, error) {
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := ToKol(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i+1, name, err)
+		}
+		objects[i] = obj
+	}
+	return s.engine.Call(ctx, name, objects...)
+}
+
+// Error is returned by Load when a program has syntax, type or compile errors
+type Error = engine.Error
+
+func isIdentifier(name string) bool {
+	l := lexer.New(name)
+	tok := l.NextToken()
+	return tok.Type == token.IDENT && tok.Literal == name && l.NextToken().Type == token.EOF
+}
+
+// staticType returns the type checker's type for a type name of a signature
+func staticType(name string) typecheck.Type {
+	if name == object.AnyType {
+		return typecheck.Unknown
+	}
+	return typecheck.Basic(name)
+}
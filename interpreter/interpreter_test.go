@@ -0,0 +1,243 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kol/object"
+	"kol/vm"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func double(std *object.IO, args ...object.Object) object.Object {
+	return &object.Integer{Value: 2 * args[0].(*object.Integer).Value}
+}
+func sum(std *object.IO, args ...object.Object) object.Object {
+	total := &object.Integer{}
+	for _, arg := range args {
+		total.Value += arg.(*object.Integer).Value
+	}
+	return total
+}
+
+func TestRegister(t *testing.T) {
+	interp := New()
+	if err := interp.Register("double", object.Signature{Parameters: []string{"int"}, Return: "int"}, double); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.Register("sum", object.Signature{Parameters: []string{"int"}, Return: "int", Variadic: true}, sum); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"double(21)", 42},
+		{"sum()", 0},
+		{"sum(1, 2, 3) + len(\"ab\")", 8},
+		{"let f = fun(x int) int { double(x) + 1 }; f(double(2))", 9},
+	}
+	for _, tt := range tests {
+		result, err := interp.Run(context.Background(), "main.kol", tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		integer, ok := result.(*object.Integer)
+		if !ok || integer.Value != tt.expected {
+			t.Errorf("%q: expected %d, got %v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestSeparateBuiltins(t *testing.T) {
+	greeter := func(greeting string) object.BuiltinFunction {
+		return func(std *object.IO, args ...object.Object) object.Object {
+			return &object.String{Value: greeting + " " + args[0].Inspect()}
+		}
+	}
+	signature := object.Signature{Parameters: []string{"str"}, Return: "str"}
+	english, german := New(), New()
+	english.Register("greet", signature, greeter("hello"))
+	german.Register("greet", signature, greeter("hallo"))
+
+	for interp, expected := range map[*Interpreter]string{english: "hello kol", german: "hallo kol"} {
+		result, err := interp.Run(context.Background(), "main.kol", `greet("kol")`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Inspect() != expected {
+			t.Errorf("expected %q, got %q", expected, result.Inspect())
+		}
+	}
+	_, err := New().Run(context.Background(), "main.kol", `greet("kol")`)
+	if err == nil || err.Error() != "Error at main.kol:1:1: identifier not found: greet" {
+		t.Errorf("expected greet to be missing from a new interpreter, got %v", err)
+	}
+}
+
+func TestReplaceBuiltin(t *testing.T) {
+	var printed []string
+	interp := New()
+	interp.Register("println", object.Signature{Parameters: []string{"str"}, Return: "void"}, func(std *object.IO, args ...object.Object) object.Object {
+		printed = append(printed, args[0].Inspect())
+		return nil
+	})
+	_, err := interp.Run(context.Background(), "main.kol", `println("a"); println(str(1))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(printed, ",") != "a,1" {
+		t.Errorf("expected the replaced println to be called, got %q", printed)
+	}
+	if object.GetBuiltinByName("println").Signature != nil {
+		t.Errorf("expected the default println to stay unchanged")
+	}
+}
+
+func TestSignatureErrors(t *testing.T) {
+	interp := New()
+	interp.Register("double", object.Signature{Parameters: []string{"int"}, Return: "int"}, double)
+	interp.Register("broken", object.Signature{Return: "int"}, func(std *object.IO, args ...object.Object) object.Object {
+		return &object.String{Value: "a"}
+	})
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`double("a")`, "Error at main.kol:1:8: Parameter 1 not valid: Expected int but got str"},
+		{`double(1, 2)`, "Error at main.kol:1:7: Wrong number of arguments: want=1, got=2"},
+		{`let a = [1, "a"]; double(a[1])`, "argument 1 must be int, got STRING"},
+		{`broken()`, "builtin returned STRING, want int"},
+	}
+	for _, tt := range tests {
+		_, err := interp.Run(context.Background(), "main.kol", tt.input)
+		if err == nil {
+			t.Fatalf("%q: expected an error", tt.input)
+		}
+		var runtimeErr *vm.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			if runtimeErr.Message != tt.expected {
+				t.Errorf("%q: expected runtime error %q, got %q", tt.input, tt.expected, runtimeErr.Message)
+			}
+		} else if err.Error() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature object.Signature
+		expected  string
+	}{
+		{"let", object.Signature{Return: "void"}, `invalid function name "let"`},
+		{"2x", object.Signature{Return: "void"}, `invalid function name "2x"`},
+		{"f", object.Signature{Parameters: []string{"string"}, Return: "void"}, `invalid signature of f: unknown type "string"`},
+		{"f", object.Signature{}, `invalid signature of f: unknown type ""`},
+		{"f", object.Signature{Return: "any", Variadic: true}, "invalid signature of f: variadic signature without parameters"},
+	}
+	for _, tt := range tests {
+		err := New().Register(tt.name, tt.signature, double)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("expected %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	interp := New()
+	interp.SetLimits(object.Limits{MaxInstructions: 1000})
+	_, err := interp.Run(context.Background(), "main.kol", "for (true) { 1 }")
+	var limitErr *object.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != object.InstructionLimit {
+		t.Errorf("expected the instruction limit to be exceeded, got %v", err)
+	}
+}
+
+func TestScript(t *testing.T) {
+	input := `let mut handled = 0;
+let onEvent = fun(name str, weights array) str {
+    handled += 1;
+    name + ":" + str(len(weights))
+};
+let fail = fun() int { int("x") };
+let answer = 42;
+answer`
+	for _, engine := range []Engine{VM, Evaluator} {
+		interp := New()
+		interp.SetEngine(engine)
+		script, err := interp.Load(context.Background(), "main.kol", input)
+		if err != nil {
+			t.Fatalf("engine %d: %s", engine, err)
+		}
+		if script.Result.Inspect() != "42" {
+			t.Errorf("engine %d: expected the program's result 42, got %s", engine, script.Result.Inspect())
+		}
+		for i := 0; i < 2; i++ {
+			result, err := script.Call(context.Background(), "onEvent", "click", []int{1, 2})
+			if err != nil {
+				t.Fatalf("engine %d: %s", engine, err)
+			}
+			if result.Inspect() != "click:2" {
+				t.Errorf("engine %d: expected click:2, got %s", engine, result.Inspect())
+			}
+		}
+		if handled, _ := script.Global("handled"); handled.Inspect() != "2" {
+			t.Errorf("engine %d: expected the handler to run twice, got %s", engine, handled.Inspect())
+		}
+
+		errorTests := []struct {
+			name     string
+			args     []any
+			expected string
+		}{
+			{"fail", nil, "Could not parse 'x' to a int"},
+			{"missing", nil, "missing isn't defined"},
+			{"answer", nil, "answer is INTEGER, not a function"},
+			{"onEvent", []any{"a", make(chan int)}, "argument 2 of onEvent: can't convert chan int to a Kol value"},
+		}
+		for _, tt := range errorTests {
+			_, err := script.Call(context.Background(), tt.name, tt.args...)
+			if err == nil || !strings.HasSuffix(strings.Split(err.Error(), "\n")[0], tt.expected) {
+				t.Errorf("engine %d: expected %q calling %s, got %v", engine, tt.expected, tt.name, err)
+			}
+		}
+	}
+}
+
+func TestWithIO(t *testing.T) {
+	interp := New()
+	interp.RegisterFunc("shout", func(std *object.IO, s string) {
+		fmt.Fprintln(std.Err, strings.ToUpper(s))
+	})
+	for _, engine := range []Engine{VM, Evaluator} {
+		interp.SetEngine(engine)
+		var wg sync.WaitGroup
+		outputs := make([]strings.Builder, 8)
+		errs := make([]strings.Builder, len(outputs))
+		for i := range outputs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				std := &object.IO{In: strings.NewReader(fmt.Sprintf("%d\n", i)), Out: &outputs[i], Err: &errs[i]}
+				_, err := interp.WithIO(std).Run(context.Background(), "main.kol",
+					`let id = readln(); let mut i = 0; for i < 50 { println("%s", id); i += 1 }; shout("run " + id)`)
+				if err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		for i := range outputs {
+			if expected := strings.Repeat(fmt.Sprintf("%d\n", i), 50); outputs[i].String() != expected {
+				t.Errorf("engine %d: run %d printed %q", engine, i, outputs[i].String())
+			}
+			if expected := fmt.Sprintf("RUN %d\n", i); errs[i].String() != expected {
+				t.Errorf("engine %d: expected %q on stderr of run %d, got %q", engine, expected, i, errs[i].String())
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"kol/diagnostic"
 	"kol/token"
 	"strings"
 )
@@ -13,6 +14,9 @@ type Lexer struct {
 
 	curLine int
 	curChar int
+
+	diagnostics []*diagnostic.Diagnostic
+	comments    []token.Comment
 }
 
 func New(input string) *Lexer {
@@ -49,8 +53,7 @@ func (l *Lexer) peekChar() byte {
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
-	l.skipComment()
+	l.skipComments()
 
 	switch l.ch {
 	case '=':
@@ -135,6 +138,30 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case '%':
 		tok = l.getToken(token.PERCENT, l.ch)
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{
+				Type:     token.AND,
+				Literal:  string(ch) + string(l.ch),
+				Position: token.Position{Line: l.curLine, Column: l.curChar - 1},
+			}
+		} else {
+			tok = l.illegal()
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{
+				Type:     token.OR,
+				Literal:  string(ch) + string(l.ch),
+				Position: token.Position{Line: l.curLine, Column: l.curChar - 1},
+			}
+		} else {
+			tok = l.illegal()
+		}
 	case '<':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -194,7 +221,7 @@ func (l *Lexer) NextToken() token.Token {
 			}
 			return tok
 		} else {
-			tok = l.getToken(token.ILLEGAL, l.ch)
+			tok = l.illegal()
 		}
 	}
 
@@ -202,6 +229,21 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// Diagnostics returns the errors for all illegal characters read so far
+func (l *Lexer) Diagnostics() []*diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+func (l *Lexer) illegal() token.Token {
+	tok := l.getToken(token.ILLEGAL, l.ch)
+	d := diagnostic.New(diagnostic.IllegalCharacter, diagnostic.TokenSpan(tok), "illegal character %q", tok.Literal)
+	if l.ch == '&' || l.ch == '|' {
+		d.WithHint("did you mean " + tok.Literal + tok.Literal + "?")
+	}
+	l.diagnostics = append(l.diagnostics, d)
+	return tok
+}
+
 func (l *Lexer) getToken(tok token.TokenType, ch byte) token.Token {
 	return token.New(tok, ch, token.Position{Line: l.curLine, Column: l.curChar})
 }
@@ -212,24 +254,44 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) skipComment() {
-	if l.ch != '/' {
-		return
+// skipComments skips the whitespace and comments in front of the next token and records the comments
+func (l *Lexer) skipComments() {
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' || l.peekChar() != '/' && l.peekChar() != '*' {
+			return
+		}
+		l.readComment()
 	}
-
+}
+func (l *Lexer) readComment() {
+	position := l.position
+	comment := token.Comment{Position: token.Position{Line: l.curLine, Column: l.curChar}}
 	if l.peekChar() == '/' {
-		for l.ch != '\n' {
-			l.readChar()
-		}
-		l.skipWhitespace()
-	} else if l.peekChar() == '*' {
-		for !(l.ch == '*' && l.peekChar() == '/') {
+		for l.ch != '\n' && l.ch != 0 {
 			l.readChar()
 		}
+	} else {
 		l.readChar()
 		l.readChar()
-		l.skipWhitespace()
+		for !(l.ch == '*' && l.peekChar() == '/') && l.ch != 0 {
+			l.readChar()
+		}
+		if l.ch == 0 {
+			l.diagnostics = append(l.diagnostics, diagnostic.New(diagnostic.UnterminatedComment, diagnostic.At(comment.Position), "unterminated comment"))
+		} else {
+			l.readChar()
+			l.readChar()
+		}
 	}
+	comment.Text = strings.TrimRight(l.input[position:l.position], "\r")
+	comment.End = token.Position{Line: l.curLine, Column: l.curChar}
+	l.comments = append(l.comments, comment)
+}
+
+// Comments returns the comments skipped so far in the order they appear in
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -35,6 +35,7 @@ if (5 < 10) {
 for(true)
 break
 += -= *= /= %
+&& ||
 `
 
 	tests := []struct {
@@ -142,7 +143,9 @@ break
 		{token.MULTASS, "*=", 28, 7},
 		{token.DIVASS, "/=", 28, 10},
 		{token.PERCENT, "%", 28, 13},
-		{token.EOF, "", 29, 1},
+		{token.AND, "&&", 29, 1},
+		{token.OR, "||", 29, 4},
+		{token.EOF, "", 30, 1},
 	}
 
 	l := New(input)
@@ -169,3 +172,43 @@ break
 		}
 	}
 }
+
+func TestComments(t *testing.T) {
+	input := `// first
+// second
+let x = 1 /* inline */ + 2; // trailing
+/* multi
+line */`
+	expectedTokens := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.PLUS, token.INT, token.SEMICOLON, token.EOF}
+	expectedComments := []token.Comment{
+		{Text: "// first", Position: token.Position{Line: 1, Column: 1}, End: token.Position{Line: 1, Column: 9}},
+		{Text: "// second", Position: token.Position{Line: 2, Column: 1}, End: token.Position{Line: 2, Column: 10}},
+		{Text: "/* inline */", Position: token.Position{Line: 3, Column: 11}, End: token.Position{Line: 3, Column: 23}},
+		{Text: "// trailing", Position: token.Position{Line: 3, Column: 29}, End: token.Position{Line: 3, Column: 40}},
+		{Text: "/* multi\nline */", Position: token.Position{Line: 4, Column: 1}, End: token.Position{Line: 5, Column: 8}},
+	}
+
+	l := New(input)
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+
+	l = New("let x = 1 /* open")
+	for l.NextToken().Type != token.EOF {
+	}
+	if len(l.Diagnostics()) != 1 || l.Diagnostics()[0].Error() != "Error at 1:11: unterminated comment" {
+		t.Errorf("wrong diagnostics for unterminated comment. got=%v", l.Diagnostics())
+	}
+}
@@ -0,0 +1,325 @@
+package lsp
+
+import (
+	"fmt"
+	"kol/ast"
+	"kol/compiler"
+	"kol/diagnostic"
+	"kol/lexer"
+	"kol/module"
+	"kol/object"
+	"kol/parser"
+	"kol/token"
+	"strings"
+)
+
+// definition is a name declared in a document or a builtin, which has no declaration
+type definition struct {
+	name string
+	// the identifier that declares the name, nil for builtins
+	ident  *ast.Identifier
+	kind   int
+	detail string
+}
+
+// occurrence is an identifier together with the definition it resolves to
+type occurrence struct {
+	ident      *ast.Identifier
+	definition *definition
+}
+
+// scope holds the names declared by a function, a block or at the top level
+type scope struct {
+	outer *scope
+	table *compiler.SymbolTable
+	// the names in the order they are declared
+	definitions []*definition
+	byName      map[string]*definition
+	// the part of the file the scope covers, the top level scope has no bounds
+	start, end token.Position
+}
+
+type document struct {
+	uri     string
+	path    string
+	text    string
+	program *ast.Program
+
+	diagnostics []*diagnostic.Diagnostic
+	occurrences []occurrence
+	scopes      []*scope
+}
+
+// analyze parses a document, resolves its identifiers and collects the errors the parser or the compiler report.
+// readFile reads the modules the document imports.
+func analyze(uri string, text string, readFile func(name string) ([]byte, error)) *document {
+	doc := &document{uri: uri, path: uriToPath(uri), text: text}
+	p := parser.New(lexer.New(text))
+	doc.program = p.ParseProgram()
+	doc.diagnostics = p.Diagnostics()
+
+	r := &resolver{doc: doc, builtins: make(map[string]*definition), seen: make(map[token.Position]bool)}
+	table := compiler.NewSymbolTable()
+	for i, b := range object.Builtins {
+		table.DefineBuiltin(i, b.Name)
+	}
+	r.enterScope(table, token.Position{}, token.Position{})
+	r.statements(doc.program.Statements)
+
+	if len(doc.diagnostics) != 0 {
+		// the program is incomplete, so the compiler would only report follow-up errors
+		return doc
+	}
+	loader := module.NewLoader()
+	loader.ReadFile = readFile
+	comp := compiler.New()
+	comp.SetLoader(loader)
+	comp.SetFileName(doc.path)
+	if err := comp.Compile(doc.program); err != nil {
+		doc.diagnostics = diagnostic.FromError(err, diagnostic.CompileError)
+	}
+	return doc
+}
+
+// resolver walks a program in the order the compiler does and resolves every identifier with the same symbol tables
+type resolver struct {
+	doc      *document
+	scope    *scope
+	builtins map[string]*definition
+	// positions of the identifiers already resolved, compound assignments repeat the assigned name
+	seen map[token.Position]bool
+}
+
+func (r *resolver) enterScope(table *compiler.SymbolTable, start token.Position, end token.Position) {
+	r.scope = &scope{outer: r.scope, table: table, byName: make(map[string]*definition), start: start, end: end}
+	r.doc.scopes = append(r.doc.scopes, r.scope)
+}
+func (r *resolver) leaveScope() {
+	r.scope = r.scope.outer
+}
+func (r *resolver) define(ident *ast.Identifier, kind int, detail string, mutable bool) {
+	if ident == nil {
+		return
+	}
+	r.scope.table.Define(ident.Value, mutable)
+	d := &definition{name: ident.Value, ident: ident, kind: kind, detail: detail}
+	r.scope.definitions = append(r.scope.definitions, d)
+	r.scope.byName[d.name] = d
+	r.record(ident, d)
+}
+func (r *resolver) resolve(ident *ast.Identifier) {
+	if ident == nil {
+		return
+	}
+	symbol, ok := r.scope.table.Resolve(ident.Value)
+	if !ok {
+		return
+	}
+	if symbol.Scope == compiler.BuiltinScope {
+		d, ok := r.builtins[ident.Value]
+		if !ok {
+			d = &definition{name: ident.Value, kind: completionFunction, detail: "builtin function " + ident.Value}
+			r.builtins[ident.Value] = d
+		}
+		r.record(ident, d)
+		return
+	}
+	for s := r.scope; s != nil; s = s.outer {
+		if d, ok := s.byName[ident.Value]; ok {
+			r.record(ident, d)
+			return
+		}
+	}
+}
+func (r *resolver) record(ident *ast.Identifier, d *definition) {
+	if r.seen[ident.Token.Position] {
+		return
+	}
+	r.seen[ident.Token.Position] = true
+	r.doc.occurrences = append(r.doc.occurrences, occurrence{ident: ident, definition: d})
+}
+
+func (r *resolver) statements(statements []ast.Statement) {
+	for _, stmt := range statements {
+		r.statement(stmt)
+	}
+}
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); stmt.Name == nil {
+			// left by a syntax error, only the value can be resolved
+		} else if ok {
+			r.define(stmt.Name, completionFunction, signature(stmt.Name.Value, fn), stmt.Mutable)
+		} else if stmt.Mutable {
+			r.define(stmt.Name, completionVariable, "let mut "+stmt.Name.Value, true)
+		} else {
+			r.define(stmt.Name, completionVariable, "let "+stmt.Name.Value, false)
+		}
+		r.expression(stmt.Value)
+	case *ast.ReassignStatement:
+		r.resolve(stmt.Name)
+		r.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue)
+	case *ast.BreakStatement:
+		r.expression(stmt.BreakValue)
+	case *ast.BlockStatement:
+		r.block(stmt)
+	case *ast.StructStatement:
+		r.define(stmt.Name, completionStruct, stmt.String(), false)
+	case *ast.ImportStatement:
+		r.define(stmt.Name, completionModule, stmt.String(), false)
+	case *ast.ExportStatement:
+		r.statement(stmt.Statement)
+	}
+}
+func (r *resolver) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		r.resolve(exp)
+	case *ast.PrefixExpression:
+		r.expression(exp.Right)
+	case *ast.InfixExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Right)
+	case *ast.IfExpression:
+		r.expression(exp.Condition)
+		r.statement(exp.Consequence)
+		r.statement(exp.Alternative)
+	case *ast.ForExpression:
+		r.expression(exp.Condition)
+		r.statement(exp.Consequence)
+		r.statement(exp.Alternative)
+	case *ast.FunctionLiteral:
+		r.function(exp)
+	case *ast.CallExpression:
+		r.expression(exp.Function)
+		for _, a := range exp.Arguments {
+			r.expression(a)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			r.expression(el)
+		}
+	case *ast.HashLiteral:
+		for k, v := range exp.Pairs {
+			r.expression(k)
+			r.expression(v)
+		}
+	case *ast.IndexExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Index)
+	case *ast.StructLiteral:
+		if exp.Module != nil {
+			r.resolve(exp.Module)
+		} else {
+			r.resolve(exp.Name)
+		}
+		for _, field := range exp.Fields {
+			r.expression(field.Value)
+		}
+	case *ast.FieldAccessExpression:
+		r.expression(exp.Left)
+	}
+}
+func (r *resolver) function(fn *ast.FunctionLiteral) {
+	if fn == nil {
+		return
+	}
+	r.enterScope(compiler.NewEnclosedSymbolTable(r.scope.table), fn.GetPosition(), r.end(fn.Body))
+	for _, p := range fn.Parameters {
+		r.define(&p.Ident, completionVariable, p.String(), false)
+	}
+	// the body shares the scope of the parameters like in the compiler
+	if fn.Body != nil {
+		r.statements(fn.Body.Statements)
+	}
+	r.leaveScope()
+}
+
+// block resolves a block in a scope of its own, its names hide the outer ones until the closing brace
+func (r *resolver) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	table := r.scope.table
+	table.EnterBlock()
+	r.enterScope(table, block.Token.Position, r.end(block))
+	r.statements(block.Statements)
+	r.leaveScope()
+	table.LeaveBlock()
+}
+
+// end returns the closing brace of a block, a block whose closing brace is missing reaches to the end of the file
+func (r *resolver) end(block *ast.BlockStatement) token.Position {
+	if block != nil && block.Rbrace.Position.Line > 0 {
+		return block.Rbrace.Position
+	}
+	return token.Position{Line: len(strings.Split(r.doc.text, "\n")) + 1}
+}
+
+// signature formats the declared parameter and return types of a function
+func signature(name string, fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.String())
+	}
+	returnType := "void"
+	if fn.ReturnType != nil {
+		returnType = fn.ReturnType.Value
+	}
+	return fmt.Sprintf("fun %s(%s) %s", name, strings.Join(params, ", "), returnType)
+}
+
+// occurrenceAt returns the identifier at a position of the document
+func (doc *document) occurrenceAt(pos token.Position) (occurrence, bool) {
+	for _, o := range doc.occurrences {
+		start := o.ident.Token.Position
+		if start.Line == pos.Line && start.Column <= pos.Column && pos.Column <= start.Column+len(o.ident.Value) {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// references returns the identifiers resolving to a definition in the order they appear in the program
+func (doc *document) references(d *definition, includeDeclaration bool) []*ast.Identifier {
+	idents := []*ast.Identifier{}
+	for _, o := range doc.occurrences {
+		if o.definition == d && (includeDeclaration || o.ident != d.ident) {
+			idents = append(idents, o.ident)
+		}
+	}
+	return idents
+}
+
+// visible returns the names that can be used at a position, inner declarations hiding outer ones
+func (doc *document) visible(pos token.Position) []*definition {
+	names := map[string]bool{}
+	visible := []*definition{}
+	for i := len(doc.scopes) - 1; i >= 0; i-- {
+		s := doc.scopes[i]
+		if s.outer != nil && (before(pos, s.start) || before(s.end, pos)) {
+			continue
+		}
+		for _, d := range s.definitions {
+			if !names[d.name] && before(d.ident.Token.Position, pos) {
+				names[d.name] = true
+				visible = append(visible, d)
+			}
+		}
+	}
+	for _, b := range object.Builtins {
+		if !names[b.Name] {
+			visible = append(visible, &definition{name: b.Name, kind: completionFunction, detail: "builtin function " + b.Name})
+		}
+	}
+	return visible
+}
+
+func before(a token.Position, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
@@ -0,0 +1,257 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/module"
+	"kol/protocol"
+	"os"
+)
+
+// Server answers the requests of an editor about the Kol files it has open.
+// Messages are read from in and the responses and notifications written to out.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// the open documents by their URI
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: make(map[string]*document)}
+}
+
+// Run handles messages until the client sends exit or closes the connection
+func (s *Server) Run() error {
+	for {
+		content, err := protocol.ReadMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			s.replyError(nil, parseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		if req.ID == nil {
+			s.notification(req)
+			continue
+		}
+		result, err := s.request(req)
+		if err != nil {
+			var rpcErr *responseError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &responseError{Code: invalidParams, Message: err.Error()}
+			}
+			s.replyError(req.ID, rpcErr.Code, rpcErr.Message)
+			continue
+		}
+		if err := protocol.WriteMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result}); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	protocol.WriteMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) request(req request) (interface{}, error) {
+	if s.shutdown {
+		return nil, &responseError{Code: invalidRequest, Message: "the server is shut down"}
+	}
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // the whole document is sent on every change
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "kol"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.references(params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params), nil
+	}
+	return nil, &responseError{Code: methodNotFound, Message: "unknown method " + req.Method}
+}
+
+// notification handles a message that isn't answered, unknown notifications are ignored
+func (s *Server) notification(req request) {
+	switch req.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if json.Unmarshal(req.Params, &params) == nil && len(params.ContentChanges) != 0 {
+			changes := params.ContentChanges
+			s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if json.Unmarshal(req.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.publishDiagnostics(params.TextDocument.URI, nil)
+		}
+	}
+}
+
+// update analyzes the new content of a document and publishes its errors
+func (s *Server) update(uri string, text string) {
+	doc := analyze(uri, text, s.readFile)
+	s.documents[uri] = doc
+	s.publishDiagnostics(uri, doc)
+}
+
+// readFile reads an imported module, preferring the unsaved content of open documents
+func (s *Server) readFile(name string) ([]byte, error) {
+	for _, doc := range s.documents {
+		if doc.path == name {
+			return []byte(doc.text), nil
+		}
+	}
+	return os.ReadFile(name)
+}
+
+func (s *Server) publishDiagnostics(uri string, doc *document) {
+	diagnostics := []Diagnostic{}
+	if doc != nil {
+		for _, d := range doc.diagnostics {
+			diagnostics = append(diagnostics, doc.convertDiagnostic(d))
+		}
+	}
+	params := PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics}
+	protocol.WriteMessage(s.out, notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// convertDiagnostic converts a diagnostic of the document. Errors inside an imported module
+// are shown at the import statement that loads the module, or at the start of the document.
+func (doc *document) convertDiagnostic(d *diagnostic.Diagnostic) Diagnostic {
+	span := d.Span
+	message := d.Message
+	if span.File != "" && span.File != doc.path {
+		message = fmt.Sprintf("%s: %s", d.Location(), d.Message)
+		span = diagnostic.Span{}
+		for _, stmt := range doc.program.Statements {
+			if stmt, ok := stmt.(*ast.ImportStatement); ok && module.Resolve(doc.path, stmt.Path) == d.Span.File {
+				span = diagnostic.TokenSpan(stmt.Token)
+				break
+			}
+		}
+	}
+	rng := Range{Start: toPosition(span.Start), End: toPosition(span.End)}
+	if before(span.End, span.Start) {
+		rng.End = rng.Start
+	}
+	severity := 1
+	switch d.Severity {
+	case diagnostic.Warning:
+		severity = 2
+	case diagnostic.Note:
+		severity = 3
+	}
+	return Diagnostic{Range: rng, Severity: severity, Code: string(d.Code), Source: "kol", Message: message}
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) *Location {
+	doc, o, ok := s.occurrenceAt(params)
+	if !ok || o.definition.ident == nil {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: identRange(o.definition.ident)}
+}
+func (s *Server) references(params ReferenceParams) []Location {
+	doc, o, ok := s.occurrenceAt(params.TextDocumentPositionParams)
+	if !ok {
+		return nil
+	}
+	locations := []Location{}
+	for _, ident := range doc.references(o.definition, params.Context.IncludeDeclaration) {
+		locations = append(locations, Location{URI: doc.uri, Range: identRange(ident)})
+	}
+	return locations
+}
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+	_, o, ok := s.occurrenceAt(params)
+	if !ok {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```kol\n" + o.definition.detail + "\n```"},
+		Range:    identRange(o.ident),
+	}
+}
+func (s *Server) completion(params TextDocumentPositionParams) []CompletionItem {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	items := []CompletionItem{}
+	for _, d := range doc.visible(fromPosition(params.Position)) {
+		items = append(items, CompletionItem{Label: d.name, Kind: d.kind, Detail: d.detail})
+	}
+	return items
+}
+
+func (s *Server) occurrenceAt(params TextDocumentPositionParams) (*document, occurrence, bool) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, occurrence{}, false
+	}
+	o, ok := doc.occurrenceAt(fromPosition(params.Position))
+	return doc, o, ok
+}
+func identRange(ident *ast.Identifier) Range {
+	end := ident.Token.Position
+	end.Column += len(ident.Value)
+	return Range{Start: toPosition(ident.Token.Position), End: toPosition(end)}
+}
@@ -0,0 +1,307 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"kol/protocol"
+	"strings"
+	"testing"
+)
+
+// client is a headless editor, it queues messages and runs a server over all of them at once
+type client struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (c *client) request(method string, params interface{}) int {
+	c.nextID++
+	protocol.WriteMessage(&c.in, map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	return c.nextID
+}
+func (c *client) notify(method string, params interface{}) {
+	protocol.WriteMessage(&c.in, map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+func (c *client) open(uri string, text string) {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: text, Version: 1}})
+}
+func (c *client) at(uri string, line int, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run lets a server handle the queued messages and returns the responses by id and the notifications in order
+func (c *client) run(t *testing.T) (map[int]message, []message) {
+	t.Helper()
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	var out bytes.Buffer
+	if err := NewServer(&c.in, &out).Run(); err != nil {
+		t.Fatalf("server failed: %s", err)
+	}
+	responses := map[int]message{}
+	notifications := []message{}
+	r := bufio.NewReader(&out)
+	for {
+		content, err := protocol.ReadMessage(r)
+		if err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			t.Fatalf("invalid message %s: %s", content, err)
+		}
+		if msg.ID != nil {
+			responses[*msg.ID] = msg
+		} else {
+			notifications = append(notifications, msg)
+		}
+	}
+	return responses, notifications
+}
+
+func decode(t *testing.T, msg message, v interface{}) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("unexpected error response: %s", msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatalf("invalid result %s: %s", msg.Result, err)
+	}
+}
+
+const uri = "file:///project/main.kol"
+
+const program = `fun add(a int, b int) int {
+    let sum = a + b
+    return sum
+}
+let mut total = add(1, 2)
+total += add(total, 3)
+`
+
+func TestDiagnostics(t *testing.T) {
+	c := &client{}
+	c.request("initialize", map[string]interface{}{})
+	c.open(uri, "let x = \nlet y = z")
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let y = z"}},
+	})
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: program}},
+	})
+	_, notifications := c.run(t)
+
+	expected := [][]string{
+		{"E0101"},
+		{"E0300 undefined variable z"},
+		{},
+	}
+	if len(notifications) != len(expected) {
+		t.Fatalf("expected %d notifications, got %d", len(expected), len(notifications))
+	}
+	for i, n := range notifications {
+		if n.Method != "textDocument/publishDiagnostics" {
+			t.Fatalf("unexpected notification %s", n.Method)
+		}
+		var params PublishDiagnosticsParams
+		json.Unmarshal(n.Params, &params)
+		if len(params.Diagnostics) != len(expected[i]) {
+			t.Fatalf("expected %d diagnostics in notification %d, got %+v", len(expected[i]), i, params.Diagnostics)
+		}
+		for j, d := range params.Diagnostics {
+			if !strings.HasPrefix(d.Code+" "+d.Message, expected[i][j]) {
+				t.Errorf("expected diagnostic %q, got %s %s", expected[i][j], d.Code, d.Message)
+			}
+		}
+	}
+	var params PublishDiagnosticsParams
+	json.Unmarshal(notifications[1].Params, &params)
+	if r := params.Diagnostics[0].Range; r.Start != (Position{Line: 0, Character: 8}) {
+		t.Errorf("wrong position of undefined variable, got %+v", r.Start)
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	c := &client{}
+	c.open(uri, program)
+	sumDef := c.request("textDocument/definition", c.at(uri, 2, 12))
+	totalDef := c.request("textDocument/definition", c.at(uri, 5, 15))
+	builtinDef := c.request("textDocument/definition", c.at(uri, 0, 0))
+	refs := ReferenceParams{TextDocumentPositionParams: c.at(uri, 0, 5)}
+	refs.Context.IncludeDeclaration = true
+	addRefs := c.request("textDocument/references", refs)
+	responses, _ := c.run(t)
+
+	tests := []struct {
+		id       int
+		expected *Range
+	}{
+		{sumDef, &Range{Start: Position{1, 8}, End: Position{1, 11}}},
+		{totalDef, &Range{Start: Position{4, 8}, End: Position{4, 13}}},
+		{builtinDef, nil},
+	}
+	for _, tt := range tests {
+		var location *Location
+		decode(t, responses[tt.id], &location)
+		if tt.expected == nil {
+			if location != nil {
+				t.Errorf("expected no definition, got %+v", location)
+			}
+			continue
+		}
+		if location == nil || location.URI != uri || location.Range != *tt.expected {
+			t.Errorf("expected definition at %+v, got %+v", tt.expected, location)
+		}
+	}
+
+	var locations []Location
+	decode(t, responses[addRefs], &locations)
+	expected := []Position{{0, 4}, {4, 16}, {5, 9}}
+	if len(locations) != len(expected) {
+		t.Fatalf("expected %d references, got %+v", len(expected), locations)
+	}
+	for i, l := range locations {
+		if l.Range.Start != expected[i] {
+			t.Errorf("expected reference at %+v, got %+v", expected[i], l.Range.Start)
+		}
+	}
+}
+
+const shadowing = `let x = 1
+if true {
+    let x = 2
+    let y = x
+}
+println("%s", x)
+`
+
+func TestBlockScopes(t *testing.T) {
+	c := &client{}
+	c.open(uri, shadowing)
+	inner := c.request("textDocument/definition", c.at(uri, 3, 12))
+	outer := c.request("textDocument/definition", c.at(uri, 5, 14))
+	refs := ReferenceParams{TextDocumentPositionParams: c.at(uri, 0, 4)}
+	refs.Context.IncludeDeclaration = true
+	outerRefs := c.request("textDocument/references", refs)
+	afterBlock := c.request("textDocument/completion", c.at(uri, 5, 0))
+	responses, _ := c.run(t)
+
+	tests := []struct {
+		id       int
+		expected Range
+	}{
+		{inner, Range{Start: Position{2, 8}, End: Position{2, 9}}},
+		{outer, Range{Start: Position{0, 4}, End: Position{0, 5}}},
+	}
+	for _, tt := range tests {
+		var location *Location
+		decode(t, responses[tt.id], &location)
+		if location == nil || location.Range != tt.expected {
+			t.Errorf("expected definition at %+v, got %+v", tt.expected, location)
+		}
+	}
+
+	var locations []Location
+	decode(t, responses[outerRefs], &locations)
+	expected := []Position{{0, 4}, {5, 14}}
+	if len(locations) != len(expected) {
+		t.Fatalf("expected %d references, got %+v", len(expected), locations)
+	}
+	for i, l := range locations {
+		if l.Range.Start != expected[i] {
+			t.Errorf("expected reference at %+v, got %+v", expected[i], l.Range.Start)
+		}
+	}
+
+	var items []CompletionItem
+	decode(t, responses[afterBlock], &items)
+	for _, item := range items {
+		if item.Label == "y" {
+			t.Errorf("unexpected completion y after its block")
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := &client{}
+	c.open(uri, program)
+	add := c.request("textDocument/hover", c.at(uri, 4, 17))
+	param := c.request("textDocument/hover", c.at(uri, 1, 14))
+	total := c.request("textDocument/hover", c.at(uri, 5, 0))
+	nothing := c.request("textDocument/hover", c.at(uri, 3, 0))
+	responses, _ := c.run(t)
+
+	tests := []struct {
+		id       int
+		expected string
+	}{
+		{add, "fun add(a int, b int) int"},
+		{param, "a int"},
+		{total, "let mut total"},
+	}
+	for _, tt := range tests {
+		var hover Hover
+		decode(t, responses[tt.id], &hover)
+		if hover.Contents.Value != "```kol\n"+tt.expected+"\n```" {
+			t.Errorf("expected hover %q, got %q", tt.expected, hover.Contents.Value)
+		}
+	}
+	if string(responses[nothing].Result) != "null" {
+		t.Errorf("expected no hover, got %s", responses[nothing].Result)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := &client{}
+	c.open(uri, program)
+	inFunction := c.request("textDocument/completion", c.at(uri, 2, 4))
+	atTop := c.request("textDocument/completion", c.at(uri, 4, 0))
+	responses, _ := c.run(t)
+
+	tests := []struct {
+		id       int
+		included []string
+		excluded []string
+	}{
+		{inFunction, []string{"add", "a", "b", "sum", "println", "len"}, []string{"total"}},
+		{atTop, []string{"add", "println"}, []string{"a", "sum", "total"}},
+	}
+	for _, tt := range tests {
+		var items []CompletionItem
+		decode(t, responses[tt.id], &items)
+		labels := map[string]bool{}
+		for _, item := range items {
+			labels[item.Label] = true
+		}
+		for _, name := range tt.included {
+			if !labels[name] {
+				t.Errorf("expected completion %s in %+v", name, items)
+			}
+		}
+		for _, name := range tt.excluded {
+			if labels[name] {
+				t.Errorf("unexpected completion %s", name)
+			}
+		}
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	c := &client{}
+	id := c.request("workspace/symbol", map[string]interface{}{})
+	responses, _ := c.run(t)
+	if err := responses[id].Error; err == nil || err.Code != methodNotFound {
+		t.Errorf("expected method not found error, got %+v", responses[id])
+	}
+}
@@ -3,12 +3,32 @@ package main
 import (
 	"fmt"
 	kol "kol/cli"
+	"kol/engine"
+	"kol/testrunner"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 )
 
+// formatFlag selects how errors are printed by the commands that run or check a file
+var formatFlag = &cli.StringFlag{Name: "format", Value: "text", Usage: "print errors as `text` or json"}
+
+// engineFlag selects what runs a program, value is the engine of the command unless the flag is given
+func engineFlag(value string) *cli.StringFlag {
+	return &cli.StringFlag{Name: "engine", Value: value, Usage: "run the program on the `ENGINE` vm or eval"}
+}
+
+func setFormat(cCtx *cli.Context) error {
+	if err := kol.SetDiagnosticFormat(cCtx.String("format")); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	return nil
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "Kol",
@@ -18,20 +38,135 @@ func main() {
 				Name:    "interpret",
 				Aliases: []string{"i"},
 				Usage:   "Start Interpreter",
+				Flags:   []cli.Flag{formatFlag, engineFlag("eval")},
+				Before:  setFormat,
 				Action: func(cCtx *cli.Context) error {
-					startInterpreter(cCtx.Args().First())
-					return nil
+					return start(cCtx.String("engine"), cCtx.Args().First())
 				},
 			},
 			{
 				Name:    "compile",
 				Aliases: []string{"c"},
 				Usage:   "Start Compiler",
+				Flags:   []cli.Flag{formatFlag, engineFlag("vm")},
+				Before:  setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return start(cCtx.String("engine"), cCtx.Args().First())
+				},
+			},
+			{
+				Name:      "check",
+				Usage:     "Type check a file without running it",
+				ArgsUsage: "<file.kol>",
+				Flags:     []cli.Flag{formatFlag},
+				Before:    setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return checkFile(cCtx.Args().First())
+				},
+			},
+			{
+				Name:      "fmt",
+				Usage:     "Format files in the canonical style, stdin is formatted to stdout without files",
+				ArgsUsage: "[file.kol...]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "check", Usage: "only list the files that aren't formatted and fail if there are any"},
+					formatFlag,
+				},
+				Before: setFormat,
 				Action: func(cCtx *cli.Context) error {
-					startCompiler(cCtx.Args().First())
+					if !kol.Format(cCtx.Args().Slice(), cCtx.Bool("check")) {
+						return cli.Exit("", 1)
+					}
 					return nil
 				},
 			},
+			{
+				Name:      "test",
+				Aliases:   []string{"t"},
+				Usage:     "Run the test_* functions of the *_test.kol files in a directory, each on a fresh engine",
+				ArgsUsage: "[dir or file]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "run", Usage: "only run the tests whose name matches the regular expression `PATTERN`"},
+					&cli.BoolFlag{Name: "v", Usage: "list the tests that passed too"},
+					formatFlag,
+					engineFlag("vm"),
+				},
+				Before: setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return testFiles(cCtx.Args().First(), cCtx.String("run"), cCtx.String("engine"), cCtx.Bool("v"))
+				},
+			},
+			{
+				Name:      "debug",
+				Aliases:   []string{"d"},
+				Usage:     "Run a file in the step debugger",
+				ArgsUsage: "<file.kol>",
+				Flags:     []cli.Flag{formatFlag},
+				Before:    setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return debugFile(cCtx.Args().First())
+				},
+			},
+			{
+				Name:      "profile",
+				Aliases:   []string{"p"},
+				Usage:     "Run a file and write a CPU and allocation profile for go tool pprof",
+				ArgsUsage: "<file.kol>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "kol.pprof", Usage: "write the profile to `FILE`"},
+					&cli.IntFlag{Name: "rate", Value: 1000, Usage: "take `N` samples per second"},
+					formatFlag,
+				},
+				Before: setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return profileFile(cCtx.Args().First(), cCtx.String("output"), cCtx.Int("rate"))
+				},
+			},
+			{
+				Name:  "dap",
+				Usage: "Start a debug adapter that speaks DAP over stdio",
+				Action: func(cCtx *cli.Context) error {
+					if !kol.StartDebugAdapter() {
+						return cli.Exit("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "lsp",
+				Usage: "Start a language server that speaks LSP over stdio",
+				Action: func(cCtx *cli.Context) error {
+					if !kol.StartLanguageServer() {
+						return cli.Exit("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "build",
+				Aliases:   []string{"b"},
+				Usage:     "Compile a file to bytecode",
+				ArgsUsage: "<file.kol>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "write the bytecode to `FILE`"},
+					formatFlag,
+				},
+				Before: setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return buildBytecode(cCtx.Args().First(), cCtx.String("output"))
+				},
+			},
+			{
+				Name:      "run",
+				Aliases:   []string{"r"},
+				Usage:     "Run a compiled .kolc file",
+				ArgsUsage: "<file.kolc>",
+				Flags:     []cli.Flag{formatFlag},
+				Before:    setFormat,
+				Action: func(cCtx *cli.Context) error {
+					return runBytecode(cCtx.Args().First())
+				},
+			},
 		},
 	}
 
@@ -40,35 +175,122 @@ func main() {
 	}
 }
 
-func startInterpreter(fileName string) {
+// start runs a file on the engine or starts a REPL without a file
+func start(engineName string, fileName string) error {
+	e, err := engine.New(engineName, engine.Options{})
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	if len(fileName) == 0 {
+		kol.StartRepl(e)
+		return nil
+	}
+	content, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Encountered Error: %s", err), 1)
+	}
+
+	if !kol.Run(e, string(content), fileName) {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+func checkFile(fileName string) error {
+	if len(fileName) == 0 {
+		return cli.Exit("No input file given", 1)
+	}
+	content, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Encountered Error: %s", err), 1)
+	}
+
+	if !kol.Check(string(content), fileName) {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+func testFiles(path string, run string, engineName string, verbose bool) error {
+	if len(path) == 0 {
+		path = "."
+	}
+	options := testrunner.Options{Engine: engineName}
+	if run != "" {
+		pattern, err := regexp.Compile(run)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Invalid -run pattern: %s", err), 1)
+		}
+		options.Run = pattern
+	}
+	if !kol.Test(path, options, verbose) {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+func debugFile(fileName string) error {
 	if len(fileName) == 0 {
-		kol.StartInterpretedRepl()
-		return
+		return cli.Exit("No input file given", 1)
 	}
 	content, err := os.ReadFile(fileName)
 
 	if err != nil {
-		fmt.Printf("Encountered Error: %s\n", err)
-		return
+		return cli.Exit(fmt.Sprintf("Encountered Error: %s", err), 1)
+	}
+
+	if !kol.Debug(string(content), fileName) {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+func profileFile(fileName string, output string, rate int) error {
+	if len(fileName) == 0 {
+		return cli.Exit("No input file given", 1)
+	}
+	if rate < 1 {
+		return cli.Exit("The sample rate has to be positive", 1)
 	}
+	content, err := os.ReadFile(fileName)
 
-	text := string(content)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Encountered Error: %s", err), 1)
+	}
 
-	kol.StartInterpreter(text)
+	if !kol.Profile(string(content), fileName, output, rate) {
+		return cli.Exit("", 1)
+	}
+	return nil
 }
-func startCompiler(fileName string) {
+func buildBytecode(fileName string, output string) error {
 	if len(fileName) == 0 {
-		kol.StartCompiledRepl()
-		return
+		return cli.Exit("No input file given", 1)
+	}
+	if len(output) == 0 {
+		output = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".kolc"
 	}
 	content, err := os.ReadFile(fileName)
 
 	if err != nil {
-		fmt.Printf("Encountered Error: %s\n", err)
-		return
+		return cli.Exit(fmt.Sprintf("Encountered Error: %s", err), 1)
 	}
 
-	text := string(content)
+	if !kol.BuildBytecode(string(content), fileName, output) {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+func runBytecode(fileName string) error {
+	if len(fileName) == 0 {
+		return cli.Exit("No input file given", 1)
+	}
+	content, err := os.ReadFile(fileName)
 
-	kol.StartCompiler(text)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Encountered Error: %s", err), 1)
+	}
+
+	if !kol.RunBytecode(content) {
+		return cli.Exit("", 1)
+	}
+	return nil
 }
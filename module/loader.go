@@ -0,0 +1,107 @@
+package module
+
+import (
+	"fmt"
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/lexer"
+	"kol/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const Extension = ".kol"
+
+// Loader finds and parses the files behind import statements and detects import cycles
+type Loader struct {
+	// ReadFile reads the source of a module, os.ReadFile by default
+	ReadFile func(name string) ([]byte, error)
+
+	// the files currently being loaded, the importing file first
+	loading []string
+}
+
+func NewLoader() *Loader {
+	return &Loader{ReadFile: os.ReadFile}
+}
+
+// Resolve returns the file an import path refers to, relative to the importing file
+func Resolve(importer string, path string) string {
+	if filepath.Ext(path) != Extension {
+		path += Extension
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(importer), path)
+}
+
+// Load parses the module in fileName which is imported by importer.
+// Every successful Load has to be followed by a call to Done once the module is evaluated.
+func (l *Loader) Load(importer string, fileName string) (program *ast.Program, err error) {
+	if len(l.loading) == 0 {
+		l.loading = append(l.loading, filepath.Clean(importer))
+		// there's no Done for a failed import, the next one starts from scratch
+		defer func() {
+			if err != nil {
+				l.loading = nil
+			}
+		}()
+	}
+	for i, loading := range l.loading {
+		if loading == fileName {
+			cycle := append(append([]string{}, l.loading[i:]...), fileName)
+			return nil, fmt.Errorf("import cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	content, err := l.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("can't import %s: %s", fileName, err)
+	}
+	p := parser.New(lexer.New(string(content)))
+	program = p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		diagnostics := p.Diagnostics()
+		for _, d := range diagnostics {
+			d.Span.File = fileName
+		}
+		return nil, &ParseError{FileName: fileName, Errors: p.Errors(), diagnostics: diagnostics}
+	}
+	l.loading = append(l.loading, fileName)
+	return program, nil
+}
+
+// ParseError is returned by Load when an imported file contains syntax errors
+type ParseError struct {
+	FileName    string
+	Errors      []string
+	diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *ParseError) Diagnostics() []*diagnostic.Diagnostic {
+	return e.diagnostics
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("can't import %s:\n%s", e.FileName, strings.Join(e.Errors, "\n"))
+}
+
+// Done marks the module loaded last as evaluated
+func (l *Loader) Done() {
+	l.loading = l.loading[:len(l.loading)-1]
+	if len(l.loading) == 1 {
+		l.loading = nil
+	}
+}
+
+// Exports returns the names a module exports in the order they are declared
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			names = append(names, export.ExportedName())
+		}
+	}
+	return names
+}
@@ -0,0 +1,91 @@
+package module
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testLoader(files map[string]string) *Loader {
+	loader := NewLoader()
+	loader.ReadFile = func(name string) ([]byte, error) {
+		content, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("file does not exist")
+		}
+		return []byte(content), nil
+	}
+	return loader
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		importer string
+		path     string
+		expected string
+	}{
+		{"main.kol", "utils", "utils.kol"},
+		{"main.kol", "utils.kol", "utils.kol"},
+		{"src/main.kol", "lib/strings", "src/lib/strings.kol"},
+		{"src/main.kol", "../shared/math", "shared/math.kol"},
+		{"src/main.kol", "/opt/kol/math", "/opt/kol/math.kol"},
+		{"", "utils", "utils.kol"},
+	}
+	for _, tt := range tests {
+		got := Resolve(tt.importer, tt.path)
+		if got != tt.expected {
+			t.Errorf("Resolve(%q, %q) wrong. expected=%q, got=%q", tt.importer, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	loader := testLoader(map[string]string{
+		"a.kol":   `import "b"; export let x = 1; export fun f() {} export struct P { x int }; let y = 2`,
+		"b.kol":   `import "a"`,
+		"bad.kol": `struct {}`,
+	})
+
+	program, err := loader.Load("main.kol", "a.kol")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	exports := Exports(program)
+	if fmt.Sprint(exports) != "[x f P]" {
+		t.Errorf("wrong exports. got=%v", exports)
+	}
+
+	_, err = loader.Load("a.kol", "b.kol")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = loader.Load("b.kol", "a.kol")
+	expected := "import cycle detected: a.kol -> b.kol -> a.kol"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, err)
+	}
+	_, err = loader.Load("b.kol", "main.kol")
+	expected = "import cycle detected: main.kol -> a.kol -> b.kol -> main.kol"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, err)
+	}
+	loader.Done()
+	loader.Done()
+
+	_, err = loader.Load("main.kol", "missing.kol")
+	expected = "can't import missing.kol: file does not exist"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, err)
+	}
+	_, err = loader.Load("main.kol", "bad.kol")
+	expected = "can't import bad.kol:\nParser error at 1:8: expected next token to be IDENT, got { instead"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, err)
+	}
+	if len(loader.loading) != 0 {
+		t.Errorf("expected a failed import to leave nothing loading, got=%v", loader.loading)
+	}
+	// main.kol isn't loading anymore, so importing it again isn't a cycle
+	if _, err = loader.Load("other.kol", "main.kol"); err == nil || err.Error() != "can't import main.kol: file does not exist" {
+		t.Errorf("expected main.kol not to be found, got=%v", err)
+	}
+}
@@ -2,36 +2,30 @@ package object
 
 import (
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 )
 
-var Builtins = []struct {
+// BuiltinDefinition names a builtin, compiled code refers to it by its index in the definitions
+// the compiler and the VM were given
+type BuiltinDefinition struct {
 	Name    string
 	Builtin *Builtin
-}{
+}
+
+// Builtins are the builtins programs get unless the embedding application chooses others
+var Builtins = []BuiltinDefinition{
 	{
 		"println",
-		&Builtin{func(args ...Object) Object {
-			if len(args) < 1 {
-				return newError("Function needs at least one argument")
-			}
-			msg, ok := args[0].(*String)
-			if !ok {
-				return newError("First argument must be a string (got %s), try str() to expilitly convert to a string", args[0].Type())
-			}
-			a := make([]any, len(args)-1)
-			for i, o := range args[1:] {
-				a[i] = o.Inspect()
-			}
-			fmt.Printf(msg.Inspect(), a...)
-			fmt.Println()
-			return nil
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
+			return printLine(std.Out, args)
 		},
 		},
 	},
 	{
 		"len",
-		&Builtin{func(args ...Object) Object {
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -50,7 +44,7 @@ var Builtins = []struct {
 	},
 	{
 		"str",
-		&Builtin{func(args ...Object) Object {
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
 			var result string
 
 			for _, arg := range args {
@@ -63,7 +57,7 @@ var Builtins = []struct {
 	},
 	{
 		"int",
-		&Builtin{func(args ...Object) Object {
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -86,7 +80,7 @@ var Builtins = []struct {
 	},
 	{
 		"float",
-		&Builtin{func(args ...Object) Object {
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -109,7 +103,7 @@ var Builtins = []struct {
 	},
 	{
 		"push",
-		&Builtin{func(args ...Object) Object {
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
 					len(args))
@@ -129,7 +123,7 @@ var Builtins = []struct {
 	},
 	{
 		"remove",
-		&Builtin{func(args ...Object) Object {
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
 					len(args))
@@ -159,16 +153,182 @@ var Builtins = []struct {
 		},
 		},
 	},
+	{
+		"eprintln",
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
+			return printLine(std.Err, args)
+		},
+		},
+	},
+	{
+		"readln",
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+			line, err := std.ReadLine()
+			if err == io.EOF {
+				return newError("no more input to read")
+			}
+			if err != nil {
+				return newError("could not read input: %s", err)
+			}
+			return &String{Value: line}
+		},
+		},
+	},
+	{
+		"assert",
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0] != True {
+				return newError("assertion failed")
+			}
+			return nil
+		},
+		},
+	},
+	{
+		"assert_eq",
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			actual, expected := args[0], args[1]
+			if actual.Type() != expected.Type() || actual.Inspect() != expected.Inspect() {
+				return newError("values aren't equal\n%s", inspectDiff(actual, expected))
+			}
+			return nil
+		},
+		},
+	},
+	{
+		"fail",
+		&Builtin{Fn: func(std *IO, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			msg, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `fail` must be STRING, got %s", args[0].Type())
+			}
+			return newError("%s", msg.Value)
+		},
+		},
+	},
+}
+
+// inspectDiff shows the expected and the actual value below each other with a caret at the first
+// character they differ in, values that only differ in their type show it instead
+func inspectDiff(actual, expected Object) string {
+	want, got := expected.Inspect(), actual.Inspect()
+	if want == got {
+		return fmt.Sprintf("  expected: %s (%s)\n    actual: %s (%s)", want, expected.Type(), got, actual.Type())
+	}
+	wantRunes, gotRunes := []rune(want), []rune(got)
+	same := 0
+	for same < len(wantRunes) && same < len(gotRunes) && wantRunes[same] == gotRunes[same] {
+		same++
+	}
+	return fmt.Sprintf("  expected: %s\n    actual: %s\n            %s^", want, got, strings.Repeat(" ", same))
+}
+
+// printLine formats a line like println and writes it at once, so lines of runs sharing a writer don't mix
+func printLine(w io.Writer, args []Object) Object {
+	if len(args) < 1 {
+		return newError("Function needs at least one argument")
+	}
+	msg, ok := args[0].(*String)
+	if !ok {
+		return newError("First argument must be a string (got %s), try str() to expilitly convert to a string", args[0].Type())
+	}
+	a := make([]any, len(args)-1)
+	for i, o := range args[1:] {
+		a[i] = o.Inspect()
+	}
+	fmt.Fprintln(w, fmt.Sprintf(msg.Inspect(), a...))
+	return nil
 }
 
 func GetBuiltinByName(name string) *Builtin {
-	for _, def := range Builtins {
+	return LookupBuiltin(Builtins, name)
+}
+func LookupBuiltin(builtins []BuiltinDefinition, name string) *Builtin {
+	for _, def := range builtins {
 		if def.Name == name {
 			return def.Builtin
 		}
 	}
 	return nil
 }
+
+// Signature declares the parameter and result types of a builtin by their names in the source code.
+// AnyType accepts every value.
+type Signature struct {
+	Parameters []string
+	Return     string
+	// the last parameter can be repeated any number of times
+	Variadic bool
+}
+
+const AnyType = "any"
+
+// Call checks the arguments and the result of a builtin against its signature
+func (b *Builtin) Call(std *IO, args ...Object) Object {
+	sig := b.Signature
+	if sig == nil {
+		return b.Fn(std, args...)
+	}
+	if sig.Variadic && len(args) < len(sig.Parameters)-1 {
+		return newError("wrong number of arguments. got=%d, want at least %d", len(args), len(sig.Parameters)-1)
+	}
+	if !sig.Variadic && len(args) != len(sig.Parameters) {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), len(sig.Parameters))
+	}
+	for i, arg := range args {
+		param := sig.Parameters[min(i, len(sig.Parameters)-1)]
+		if !hasType(arg, param) {
+			return newError("argument %d must be %s, got %s", i+1, param, arg.Type())
+		}
+	}
+	result := b.Fn(std, args...)
+	if result == nil || result.Type() == ERROR_OBJ {
+		return result
+	}
+	if !hasType(result, sig.Return) {
+		return newError("builtin returned %s, want %s", result.Type(), sig.Return)
+	}
+	return result
+}
+
+// Validate reports type names that aren't basic types or AnyType, struct types can't be declared
+func (sig *Signature) Validate() error {
+	if sig.Variadic && len(sig.Parameters) == 0 {
+		return fmt.Errorf("variadic signature without parameters")
+	}
+	for _, name := range append([]string{sig.Return}, sig.Parameters...) {
+		if _, ok := TypeFromString(name); !ok && name != AnyType {
+			return fmt.Errorf("unknown type %q", name)
+		}
+	}
+	return nil
+}
+func hasType(obj Object, name string) bool {
+	if name == AnyType {
+		return true
+	}
+	typ, _ := TypeFromString(name)
+	if typ == FUNCTION_OBJ {
+		return obj.Type() == FUNCTION_OBJ || obj.Type() == CLOSURE_OBJ || obj.Type() == BUILTIN_OBJ
+	}
+	return obj.Type() == typ
+}
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
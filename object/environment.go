@@ -1,13 +1,25 @@
 package object
 
+import (
+	"kol/module"
+	"kol/token"
+	"sort"
+)
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Variable)
-	return &Environment{store: s, outer: nil}
+	modules := &Modules{Loader: module.NewLoader(), Evaluated: make(map[string]*Module)}
+	return &Environment{store: s, outer: nil, modules: modules, io: StandardIO()}
 }
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Variable)
+	return &Environment{store: s, outer: outer, fileName: outer.fileName, module: outer.module, modules: outer.modules, budget: outer.budget, call: outer.call, builtins: outer.builtins, io: outer.io}
+}
+
+// NewModuleEnvironment creates the global environment of the module name imported by the program of e
+func (e *Environment) NewModuleEnvironment(name string, fileName string) *Environment {
+	s := make(map[string]Variable)
+	return &Environment{store: s, outer: nil, fileName: fileName, module: name, modules: e.modules, budget: e.budget, builtins: e.builtins, io: e.io}
 }
 
 type Variable struct {
@@ -17,6 +29,45 @@ type Variable struct {
 type Environment struct {
 	store map[string]Variable
 	outer *Environment
+
+	// the file the environment's code comes from, imports are resolved relative to it
+	fileName string
+	// the module the code belongs to, empty for the program itself
+	module  string
+	modules *Modules
+	// the work done by the program, environments created from this one share it
+	budget *Budget
+	// the call whose body runs in the environment, nil at the top level
+	call *Call
+	// the builtins the code can call, nil for the evaluator's own
+	builtins []BuiltinDefinition
+	// where builtins like println and readln write and read
+	io *IO
+}
+
+// Call is a function call active in the evaluator, the calls before it are reached through Caller
+type Call struct {
+	Function string
+	// the file and position of the call expression, in the function of Caller
+	File     string
+	Position token.Position
+	Caller   *Call
+	// the number of active calls including this one
+	Depth int
+}
+
+func NewCall(caller *Call, function string, file string, pos token.Position) *Call {
+	call := &Call{Function: function, File: file, Position: pos, Caller: caller, Depth: 1}
+	if caller != nil {
+		call.Depth = caller.Depth + 1
+	}
+	return call
+}
+
+// Modules is shared by all environments of a program and holds the modules it imported
+type Modules struct {
+	Loader    *module.Loader
+	Evaluated map[string]*Module
 }
 
 func (e *Environment) Get(name string) (Variable, bool) {
@@ -42,3 +93,55 @@ func (e *Environment) HasValue(name string) bool {
 	_, ok := e.store[name]
 	return ok
 }
+
+// Names returns the sorted names of the variables defined in the environment itself
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+func (e *Environment) FileName() string {
+	return e.fileName
+}
+func (e *Environment) Module() string {
+	return e.module
+}
+func (e *Environment) SetFileName(name string) {
+	e.fileName = name
+}
+func (e *Environment) Modules() *Modules {
+	return e.modules
+}
+
+// Budget returns the budget the evaluation of the environment's code counts against, nil without limits
+func (e *Environment) Budget() *Budget {
+	return e.budget
+}
+func (e *Environment) SetBudget(budget *Budget) {
+	e.budget = budget
+}
+
+// SetBuiltins replaces the builtins of the environment and the environments later created from it
+func (e *Environment) SetBuiltins(builtins []BuiltinDefinition) {
+	e.builtins = builtins
+}
+func (e *Environment) Builtins() []BuiltinDefinition {
+	return e.builtins
+}
+
+// SetIO replaces the streams builtins use in the environment and the environments later created from it
+func (e *Environment) SetIO(io *IO) {
+	e.io = io
+}
+func (e *Environment) IO() *IO {
+	return e.io
+}
+func (e *Environment) Call() *Call {
+	return e.call
+}
+func (e *Environment) SetCall(call *Call) {
+	e.call = call
+}
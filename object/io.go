@@ -0,0 +1,36 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// IO is where the builtins of a run read their input and write their output. Every run has its own,
+// so the output of concurrent runs never mixes.
+type IO struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+
+	// buffers In for ReadLine, created on first use
+	reader *bufio.Reader
+}
+
+// StandardIO returns an IO reading and writing the standard streams of the process
+func StandardIO() *IO {
+	return &IO{In: os.Stdin, Out: os.Stdout, Err: os.Stderr}
+}
+
+// ReadLine reads the next line of In without its line break, it returns io.EOF at the end of In
+func (std *IO) ReadLine() (string, error) {
+	if std.reader == nil {
+		std.reader = bufio.NewReader(std.In)
+	}
+	line, err := std.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+}
@@ -0,0 +1,134 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// Limits bound the work a program may do, a zero field means no limit
+type Limits struct {
+	// instructions the VM runs or nodes the evaluator evaluates
+	MaxInstructions int64
+	// nested function calls, the main program doesn't count
+	MaxCallDepth int
+	// estimated bytes of all objects the program creates, freed or not
+	MaxAllocation int64
+}
+
+type Limit int
+
+const (
+	InstructionLimit Limit = iota
+	CallDepthLimit
+	AllocationLimit
+)
+
+// LimitError is returned when a program exceeds one of its limits
+type LimitError struct {
+	Limit Limit
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case InstructionLimit:
+		return fmt.Sprintf("instruction limit of %d exceeded", e.Max)
+	case CallDepthLimit:
+		return fmt.Sprintf("call depth limit of %d exceeded", e.Max)
+	default:
+		return fmt.Sprintf("allocation limit of %d bytes exceeded", e.Max)
+	}
+}
+
+// checkInterval is the number of steps between checks of the context, which is slower than a step
+const checkInterval = 1024
+
+// Budget counts the work of a running program against its limits and watches its context
+type Budget struct {
+	ctx    context.Context
+	limits Limits
+
+	steps     int64
+	depth     int
+	allocated int64
+	// the first limit exceeded, every later check fails with it too
+	err error
+}
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	return &Budget{ctx: ctx, limits: limits}
+}
+
+// Step counts an instruction and checks the context every checkInterval steps
+func (b *Budget) Step() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.steps++
+	if b.limits.MaxInstructions > 0 && b.steps > b.limits.MaxInstructions {
+		b.err = &LimitError{Limit: InstructionLimit, Max: b.limits.MaxInstructions}
+	} else if b.steps%checkInterval == 0 {
+		b.err = b.ctx.Err()
+	}
+	return b.err
+}
+
+// Enter counts a call, Leave has to be called once it returns
+func (b *Budget) Enter() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.depth++
+	if b.limits.MaxCallDepth > 0 && b.depth > b.limits.MaxCallDepth {
+		b.err = &LimitError{Limit: CallDepthLimit, Max: int64(b.limits.MaxCallDepth)}
+	}
+	return b.err
+}
+func (b *Budget) Leave() {
+	b.depth--
+}
+
+// Allocate counts the estimated size of a new object
+func (b *Budget) Allocate(size int64) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.allocated += size
+	if b.limits.MaxAllocation > 0 && b.allocated > b.limits.MaxAllocation {
+		b.err = &LimitError{Limit: AllocationLimit, Max: b.limits.MaxAllocation}
+	}
+	return b.err
+}
+
+// Err returns why the program was stopped, if it was
+func (b *Budget) Err() error {
+	return b.err
+}
+
+// rough sizes on a 64 bit machine, an object is an interface pointing to its value
+const (
+	objectSize   = 16
+	elementSize  = 16
+	hashPairSize = 48
+)
+
+// Size estimates the bytes a new object takes, without the objects it refers to.
+// Booleans and void are shared and take nothing.
+func Size(obj Object) int64 {
+	switch obj := obj.(type) {
+	case nil, *Boolean, *Void:
+		return 0
+	case *String:
+		return objectSize + int64(len(obj.Value))
+	case *Array:
+		return objectSize + elementSize*int64(len(obj.Elements))
+	case *Hash:
+		return objectSize + hashPairSize*int64(len(obj.Pairs))
+	case *Struct:
+		return objectSize + hashPairSize*int64(len(obj.Fields))
+	case *Closure:
+		return objectSize + elementSize*int64(len(obj.Free))
+	default:
+		return objectSize
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"hash/fnv"
 	"kol/ast"
 	"kol/code"
+	"kol/diagnostic"
 	"kol/token"
+	"sort"
 	"strings"
 )
 
 type ObjectType string
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(std *IO, args ...Object) Object
 
 const (
 	INTEGER_OBJ           = "INTEGER"
@@ -20,6 +22,7 @@ const (
 	VOID_OBJ              = "VOID"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
 	BREAK_VALUE_OBJECT    = "BREAK_VALUE"
+	CONTINUE_VALUE_OBJ    = "CONTINUE_VALUE"
 	ERROR_OBJ             = "ERROR"
 	FUNCTION_OBJ          = "FUNCTION"
 	STRING_OBJ            = "STRING"
@@ -28,6 +31,9 @@ const (
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	STRUCT_DEFINITION_OBJ = "STRUCT_DEFINITION"
+	MODULE_OBJ            = "MODULE"
+	UPVALUE_OBJ           = "UPVALUE"
 )
 
 func TypeFromString(input string) (ObjectType, bool) {
@@ -49,7 +55,8 @@ func TypeFromString(input string) (ObjectType, bool) {
 	case "void":
 		return VOID_OBJ, true
 	default:
-		return ERROR_OBJ, false
+		// struct values report their struct name, qualified by the module declaring it, as type
+		return ObjectType(input), false
 	}
 }
 
@@ -92,6 +99,12 @@ type Boolean struct {
 	Value bool
 }
 
+// True and False are the only booleans, the VM and the evaluator compare them by identity
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+)
+
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
@@ -111,20 +124,53 @@ type BreakValue struct {
 	Value Object
 }
 
-func (bv *BreakValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (bv *BreakValue) Type() ObjectType { return BREAK_VALUE_OBJECT }
 func (bv *BreakValue) Inspect() string  { return bv.Value.Inspect() }
 
+type ContinueValue struct{}
+
+func (cv *ContinueValue) Type() ObjectType { return CONTINUE_VALUE_OBJ }
+func (cv *ContinueValue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message  string
 	Position *token.Position
+	File     string // set when the error happened in an imported module
+	// the kind of diagnostic the error is reported as, RuntimeError if empty
+	Code diagnostic.Code
+	// the active calls like "at f (main.kol:3:5)", innermost first, set for stack overflows
+	Trace []string
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string {
+	var out bytes.Buffer
+	if e.Position != nil && e.File != "" {
+		fmt.Fprintf(&out, "Error at %s:%d:%d: %s", e.File, e.Position.Line, e.Position.Column, e.Message)
+	} else if e.Position != nil {
+		fmt.Fprintf(&out, "Error at %d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+	} else {
+		out.WriteString("ERROR: " + e.Message)
+	}
+	for _, entry := range e.Trace {
+		out.WriteString("\n\t" + entry)
+	}
+	return out.String()
+}
+
+// Diagnostic converts the error into a diagnostic that can be rendered with its source
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	span := diagnostic.Span{File: e.File}
 	if e.Position != nil {
-		return fmt.Sprintf("Error at %d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+		span.Start, span.End = *e.Position, *e.Position
+	}
+	code := e.Code
+	if code == "" {
+		code = diagnostic.RuntimeError
 	}
-	return "ERROR: " + e.Message
+	d := diagnostic.New(code, span, "%s", e.Message)
+	d.Notes = append(d.Notes, e.Trace...)
+	return d
 }
 
 type Function struct {
@@ -161,6 +207,8 @@ func (s *String) Inspect() string  { return s.Value }
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// checked on every call, nil for builtins that check their arguments themselves
+	Signature *Signature
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -202,15 +250,23 @@ type Hash struct {
 	Pairs map[HashKey]HashPair
 }
 
+// Inspect shows the pairs sorted by their keys, so equal hashes always look the same
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
-	pairs := []string{}
+	pairs := make([]HashPair, 0, len(h.Pairs))
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+	elements := []string{}
+	for _, pair := range pairs {
+		elements = append(elements, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString(strings.Join(elements, ", "))
 	out.WriteString("}")
 	return out.String()
 }
@@ -220,19 +276,143 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Name          string
+	SourceMap     code.SourceMap
+	// names of the local and free variables by their index, shown by the debugger
+	LocalNames []string
+	FreeNames  []string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
 func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
+func (cf *CompiledFunction) DisplayName() string {
+	if cf.Name == "" {
+		return "<anonymous>"
+	}
+	return cf.Name
+}
 
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []Object
+	Free []*Upvalue
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Upvalue is a variable captured by closures. While the function defining the variable runs,
+// Location points to its slot on the VM stack. Once the function returns the upvalue is
+// closed: the value moves into the upvalue and all closures keep sharing it.
+type Upvalue struct {
+	Location *Object
+	closed   Object
+}
+
+func NewUpvalue(location *Object) *Upvalue {
+	return &Upvalue{Location: location}
+}
+func (u *Upvalue) Type() ObjectType { return UPVALUE_OBJ }
+func (u *Upvalue) Inspect() string  { return fmt.Sprintf("Upvalue[%p]", u) }
+func (u *Upvalue) Get() Object      { return *u.Location }
+func (u *Upvalue) Set(value Object) { *u.Location = value }
+func (u *Upvalue) Close() {
+	u.closed = *u.Location
+	u.Location = &u.closed
+}
+
+type StructField struct {
+	Name string
+	Type string
+}
+type StructDefinition struct {
+	Name string
+	// the module declaring the struct, empty for the program itself
+	Module string
+	Fields []StructField
+}
+
+// QualifyType returns the type a type name in the code of module stands for. The structs of a module are
+// qualified by its name like geometry.Point, so equally named structs of different modules are different
+// types. Basic types and the structs of other modules keep their name
+func QualifyType(module string, name string) string {
+	if _, ok := TypeFromString(name); ok || module == "" || name == AnyType || strings.Contains(name, ".") {
+		return name
+	}
+	return module + "." + name
+}
+
+func (sd *StructDefinition) Type() ObjectType { return STRUCT_DEFINITION_OBJ }
+func (sd *StructDefinition) Inspect() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for _, f := range sd.Fields {
+		fields = append(fields, f.Name+" "+f.Type)
+	}
+	out.WriteString("struct ")
+	out.WriteString(sd.Name)
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
+
+// Instantiate creates a struct value after checking that every field is set exactly once with the declared type
+func (sd *StructDefinition) Instantiate(values map[string]Object) (*Struct, error) {
+	for name := range values {
+		if !sd.HasField(name) {
+			return nil, fmt.Errorf("Struct %s has no field %s", sd.Name, name)
+		}
+	}
+	for _, field := range sd.Fields {
+		value, ok := values[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("Missing field %s for struct %s", field.Name, sd.Name)
+		}
+		if !hasType(value, field.Type) {
+			typ, _ := TypeFromString(field.Type)
+			return nil, fmt.Errorf("Field %s not valid: Expected %s but got %s", field.Name, typ, value.Type())
+		}
+	}
+	return &Struct{Definition: sd, Fields: values}, nil
+}
+func (sd *StructDefinition) HasField(name string) bool {
+	for _, f := range sd.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type Struct struct {
+	Definition *StructDefinition
+	Fields     map[string]Object
+}
+
+func (s *Struct) Type() ObjectType {
+	return ObjectType(QualifyType(s.Definition.Module, s.Definition.Name))
+}
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for _, f := range s.Definition.Fields {
+		fields = append(fields, f.Name+": "+s.Fields[f.Name].Inspect())
+	}
+	out.WriteString(string(s.Type()))
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+type Module struct {
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
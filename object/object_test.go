@@ -17,3 +17,17 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestHashInspect(t *testing.T) {
+	hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+	for i, key := range []string{"d", "b", "e", "a", "c"} {
+		k := &String{Value: key}
+		hash.Pairs[k.HashKey()] = HashPair{Key: k, Value: &Integer{Value: int64(i)}}
+	}
+	expected := "{a: 3, b: 1, c: 4, d: 0, e: 2}"
+	for i := 0; i < 10; i++ {
+		if got := hash.Inspect(); got != expected {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+}
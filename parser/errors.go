@@ -2,18 +2,43 @@ package parser
 
 import (
 	"fmt"
+	"kol/diagnostic"
 	"kol/token"
 	"testing"
 )
 
+// Errors returns the diagnostics of the lexer and the parser formatted as messages
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.Diagnostics() {
+		errors = append(errors, fmt.Sprintf("Parser error at %d:%d: %s", d.Span.Start.Line, d.Span.Start.Column, d.Message))
+	}
+	return errors
+}
+
+// Diagnostics returns the errors of the lexer and the parser ordered by their position
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
+	diagnostics := append(append([]*diagnostic.Diagnostic{}, p.l.Diagnostics()...), p.diagnostics...)
+	diagnostic.Sort(diagnostics)
+	return diagnostics
 }
+
 func (p *Parser) peekError(t token.TokenType, pos token.Position) {
-	p.addError("expected next token to be %s, got %s instead", pos, t, p.peekToken.Type)
+	if p.peekTokenIs(token.ILLEGAL) {
+		// the lexer already reported the illegal character
+		p.panicking = true
+		return
+	}
+	p.report(diagnostic.New(diagnostic.UnexpectedToken, p.span(pos),
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type))
 }
 func (p *Parser) noPrefixParseFnError(t token.TokenType, pos token.Position) {
-	p.addError("no prefix parse function for %s found", pos, t)
+	if t == token.ILLEGAL {
+		p.panicking = true
+		return
+	}
+	p.report(diagnostic.New(diagnostic.MissingExpression, p.span(pos), "no prefix parse function for %s found", t).
+		WithHint("expected an expression here"))
 }
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
@@ -29,6 +54,23 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	t.FailNow()
 }
 func (p *Parser) addError(msg string, pos token.Position, a ...interface{}) {
-	newMsg := fmt.Sprintf(msg, a...)
-	p.errors = append(p.errors, fmt.Sprintf("Parser error at %d:%d: %s", pos.Line, pos.Column, newMsg))
+	p.report(diagnostic.New(diagnostic.InvalidSyntax, p.span(pos), msg, a...))
+}
+func (p *Parser) report(d *diagnostic.Diagnostic) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+// span covers the current or next token if the error is at its position
+func (p *Parser) span(pos token.Position) diagnostic.Span {
+	switch pos {
+	case p.curToken.Position:
+		return diagnostic.TokenSpan(p.curToken)
+	case p.peekToken.Position:
+		return diagnostic.TokenSpan(p.peekToken)
+	}
+	return diagnostic.At(pos)
 }
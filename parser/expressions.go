@@ -148,3 +148,15 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	}
 	return exp
 }
+
+func (p *Parser) parseFieldAccessExpression(left ast.Expression) ast.Expression {
+	exp := &ast.FieldAccessExpression{Token: p.curToken, Left: left}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Field = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if module, ok := left.(*ast.Identifier); ok && p.imports[module.Value] && p.peekTokenIs(token.LBRACE) && p.fieldsFollow() {
+		return p.parseStructLiteral(module)
+	}
+	return exp
+}
@@ -43,11 +43,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit.Parameters = p.parseFunctionParameters()
 	if p.peekTokenIs(token.IDENT) {
 		p.nextToken()
-		if !slices.Contains(ast.Types, p.curToken.Literal) {
-			p.addError("Can't find type with name %s", p.curToken.Position, p.curToken.Literal)
-		}
-
-		lit.ReturnType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		lit.ReturnType, _ = p.parseType()
 	} else {
 		lit.ReturnType = &ast.Identifier{Token: p.curToken, Value: "void"}
 	}
@@ -69,12 +65,11 @@ func (p *Parser) parseFunction() ast.Statement {
 	lit.Parameters = p.parseFunctionParameters()
 	if p.peekTokenIs(token.IDENT) {
 		p.nextToken()
-		if !slices.Contains(ast.Types, p.curToken.Literal) {
-			p.addError("Can't find type with name %s", p.curToken.Position, p.curToken.Literal)
+		returnType, ok := p.parseType()
+		if !ok {
 			return nil
 		}
-
-		lit.ReturnType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		lit.ReturnType = returnType
 	} else {
 		lit.ReturnType = &ast.Identifier{Token: p.curToken, Value: "void"}
 	}
@@ -82,6 +77,7 @@ func (p *Parser) parseFunction() ast.Statement {
 		return nil
 	}
 	lit.Body = p.parseBlockStatement()
+	lit.Name = ident.Literal
 	return &ast.LetStatement{
 		Token:   token.Token{Type: token.LET, Literal: "let", Position: lit.GetPosition()},
 		Name:    &ast.Identifier{Token: ident, Value: ident.Literal},
@@ -103,12 +99,11 @@ func (p *Parser) parseFunctionParameters() []*ast.FunctionParameter {
 		p.addError("No type specified for parameter %s", p.curToken.Position, ident.Value)
 		return nil
 	}
-	if !slices.Contains(ast.Types, p.curToken.Literal) {
-		p.addError("Can't find type with name %s", p.curToken.Position, p.curToken.Literal)
+	expType, ok := p.parseType()
+	if !ok {
 		p.nextToken()
 		return nil
 	}
-	expType := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	arguments = append(arguments, &ast.FunctionParameter{Ident: *ident, Type: *expType})
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
@@ -120,11 +115,10 @@ func (p *Parser) parseFunctionParameters() []*ast.FunctionParameter {
 			p.nextToken()
 			return nil
 		}
-		if !slices.Contains(ast.Types, p.curToken.Literal) {
-			p.addError("Can't find type with name %s", p.curToken.Position, p.curToken.Literal)
+		expType, ok := p.parseType()
+		if !ok {
 			return nil
 		}
-		expType := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		arguments = append(arguments, &ast.FunctionParameter{Ident: *ident, Type: *expType})
 	}
 	if !p.expectPeek(token.RPAREN) {
@@ -163,3 +157,64 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 	return hash
 }
+
+// parseStructLiteral parses the fields of a struct literal whose name is the current token, module is set
+// for structs of imported modules
+func (p *Parser) parseStructLiteral(module *ast.Identifier) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.curToken, Module: module}
+	if module != nil {
+		lit.Token = module.Token
+	}
+	lit.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	lit.Fields = []*ast.StructFieldValue{}
+	p.nextToken()
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		lit.Fields = append(lit.Fields, &ast.StructFieldValue{Name: name, Value: p.parseExpression(LOWEST)})
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return lit
+}
+func (p *Parser) isType(name string) bool {
+	return slices.Contains(ast.Types, name) || p.structs[name]
+}
+
+// parseType parses the type name at the current token, the structs of imported modules are named by the
+// module and the struct name like geometry.Point
+func (p *Parser) parseType() (*ast.Identifier, bool) {
+	typ := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.imports[typ.Value] && p.peekTokenIs(token.PERIOD) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return typ, false
+		}
+		// whether the module exports such a struct is only known once it is loaded
+		typ.Value += "." + p.curToken.Literal
+		return typ, true
+	}
+	if !p.isType(typ.Value) {
+		p.addError("Can't find type with name %s", p.curToken.Position, typ.Value)
+		return typ, false
+	}
+	return typ, true
+}
+
+// fieldsFollow tells if the braces after the current token hold the fields of a struct literal rather than
+// a block, like the one of if geometry.visible { ... }. It reads ahead on a copy of the lexer
+func (p *Parser) fieldsFollow() bool {
+	l := *p.l
+	first := l.NextToken()
+	return first.Type == token.RBRACE || first.Type == token.IDENT && l.NextToken().Type == token.COLON
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"kol/ast"
+	"kol/diagnostic"
 	"kol/lexer"
 	"kol/token"
 )
@@ -9,16 +10,20 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
-	INDEX       // array[index]
+	INDEX       // array[index] or struct.field
 )
 
 var precedences = map[token.TokenType]int{
+	token.OR:       OR,
+	token.AND:      AND,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LTEQ:     LESSGREATER,
@@ -32,11 +37,23 @@ var precedences = map[token.TokenType]int{
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.PERIOD:   INDEX,
 }
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	diagnostics []*diagnostic.Diagnostic
+
+	// names of all structs declared so far, so they can be used as types and in literals
+	structs map[string]bool
+	// names of the modules imported so far, their structs are used as types like geometry.Point
+	imports map[string]bool
+
+	// set after an error until the parser skipped to the next statement,
+	// errors in between are only follow-up errors of the first one
+	panicking bool
+	// number of blocks the current token is nested in
+	depth int
 
 	curToken  token.Token
 	peekToken token.Token
@@ -51,7 +68,7 @@ type (
 )
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, structs: make(map[string]bool), imports: make(map[string]bool)}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
@@ -85,8 +102,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GTEQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.PERIOD, p.parseFieldAccessExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -95,6 +115,9 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
+	if p.peekTokenIs(token.LBRACE) && p.structs[p.curToken.Literal] {
+		return p.parseStructLiteral(nil)
+	}
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
@@ -108,8 +131,10 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
+		stmt := p.parseTopLevelStatement()
+		if p.panicking {
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -125,14 +150,34 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// parseTopLevelStatement parses the statements that are only allowed outside of blocks
+func (p *Parser) parseTopLevelStatement() ast.Statement {
+	switch p.curToken.Type {
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	default:
+		return p.parseStatement()
+	}
+}
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
+	case token.SEMICOLON:
+		return nil
+	case token.IMPORT, token.EXPORT:
+		p.addError("%s is only allowed at the top level of a file", p.curToken.Position, p.curToken.Literal)
+		return nil
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.BREAK:
 		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
 	case token.FUNCTION:
 		if !p.peekTokenIs(token.IDENT) {
 			return p.parseExpressionStatement()
@@ -151,9 +196,7 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipSemicolon()
 	return stmt
 }
 
@@ -177,3 +220,46 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	return leftExp
 }
+
+// statementStarts are the keywords the parser resynchronizes on after an error, if and for aren't
+// among them since they also start expressions in the middle of a statement
+var statementStarts = map[token.TokenType]bool{
+	token.LET:      true,
+	token.FUNCTION: true,
+	token.RETURN:   true,
+	token.STRUCT:   true,
+	token.IMPORT:   true,
+	token.EXPORT:   true,
+}
+
+// synchronize skips the rest of a statement that contains an error, so the next
+// statement is parsed on its own instead of producing follow-up errors. A statement
+// ends at a semicolon, a closing brace, the end of its line or before a keyword
+// starting the next one, but not inside of brackets opened by the skipped tokens
+func (p *Parser) synchronize() {
+	p.panicking = false
+	open := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			open++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			if open > 0 {
+				open--
+			} else if p.curTokenIs(token.RBRACE) {
+				return
+			}
+		case token.SEMICOLON:
+			if open == 0 {
+				return
+			}
+		}
+		if p.peekTokenIs(token.EOF) {
+			return
+		}
+		if open == 0 && (statementStarts[p.peekToken.Type] || p.peekTokenIs(token.RBRACE) && p.depth > 0 || p.peekToken.Position.Line > p.curToken.Position.Line) {
+			return
+		}
+		p.nextToken()
+	}
+}
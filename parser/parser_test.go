@@ -5,6 +5,7 @@ import (
 	"kol/ast"
 	"kol/lexer"
 	"kol/token"
+	"strings"
 	"testing"
 )
 
@@ -526,6 +527,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a == b) && (c < d)) || (!e))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -736,6 +749,27 @@ func TestForElseExpression(t *testing.T) {
 	}
 }
 
+func TestLoopControlStatements(t *testing.T) {
+	input := `for true { break; break 5; continue; }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	loop := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForExpression)
+	body := loop.Consequence.Statements
+	if len(body) != 3 {
+		t.Fatalf("loop body does not contain 3 statements. got=%d", len(body))
+	}
+	if stmt, ok := body[0].(*ast.BreakStatement); !ok || stmt.BreakValue != nil {
+		t.Errorf("body[0] is not a break without value. got=%T (%+v)", body[0], body[0])
+	}
+	if stmt, ok := body[1].(*ast.BreakStatement); !ok || !testLiteralExpression(t, stmt.BreakValue, 5) {
+		t.Errorf("body[1] is not a break with value 5. got=%T (%+v)", body[1], body[1])
+	}
+	if _, ok := body[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body[2] is not ast.ContinueStatement. got=%T", body[2])
+	}
+}
 func TestFunctionParsing(t *testing.T) {
 	input := "fun add(a int, b int) int { a + b; }"
 	l := lexer.New(input)
@@ -792,12 +826,12 @@ func TestFunctionLiteralParsing(t *testing.T) {
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input              string
-		expectedParams     map[string]string
+		expectedParams     [][2]string
 		expectedReturnType string
 	}{
-		{input: "fun() {};", expectedParams: map[string]string{}, expectedReturnType: "void"},
-		{input: "fun(x int) int {};", expectedParams: map[string]string{"x": "int"}, expectedReturnType: "int"},
-		{input: "fun(x int, y bool, z str) array {};", expectedParams: map[string]string{"x": "int", "y": "bool", "z": "str"}, expectedReturnType: "array"},
+		{input: "fun() {};", expectedParams: [][2]string{}, expectedReturnType: "void"},
+		{input: "fun(x int) int {};", expectedParams: [][2]string{{"x", "int"}}, expectedReturnType: "int"},
+		{input: "fun(x int, y bool, z str) array {};", expectedParams: [][2]string{{"x", "int"}, {"y", "bool"}, {"z", "str"}}, expectedReturnType: "array"},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -810,11 +844,9 @@ func TestFunctionParameterParsing(t *testing.T) {
 			t.Errorf("length parameters wrong. want %d, got=%d\n",
 				len(tt.expectedParams), len(function.Parameters))
 		}
-		i := 0
-		for ident, typ := range tt.expectedParams {
-			testLiteralExpression(t, &function.Parameters[i].Ident, ident)
-			testLiteralExpression(t, &function.Parameters[i].Type, typ)
-			i++
+		for i, param := range tt.expectedParams {
+			testLiteralExpression(t, &function.Parameters[i].Ident, param[0])
+			testLiteralExpression(t, &function.Parameters[i].Type, param[1])
 		}
 		if tt.expectedReturnType != function.ReturnType.Value {
 			t.Fatalf("Wrong return type. expected=%s, got=%s", tt.expectedReturnType, function.ReturnType.Value)
@@ -969,3 +1001,239 @@ func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 	}
 	return true
 }
+
+func TestStructParsing(t *testing.T) {
+	input := `struct Point { x int, y int }
+let p = Point{x: 1, y: 2 + 3};
+p.x;`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+	def, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if def.Name.Value != "Point" {
+		t.Fatalf("struct name is not 'Point'. got=%q", def.Name.Value)
+	}
+	if len(def.Fields) != 2 {
+		t.Fatalf("struct has wrong number of fields. got=%d", len(def.Fields))
+	}
+	testLiteralExpression(t, &def.Fields[0].Ident, "x")
+	testLiteralExpression(t, &def.Fields[0].Type, "int")
+	testLiteralExpression(t, &def.Fields[1].Ident, "y")
+
+	lit, ok := program.Statements[1].(*ast.LetStatement).Value.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("let value is not ast.StructLiteral. got=%T", program.Statements[1].(*ast.LetStatement).Value)
+	}
+	if len(lit.Fields) != 2 {
+		t.Fatalf("struct literal has wrong number of fields. got=%d", len(lit.Fields))
+	}
+	testLiteralExpression(t, lit.Fields[0].Value, 1)
+	testInfixExpression(t, lit.Fields[1].Value, 2, "+", 3)
+
+	access, ok := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.FieldAccessExpression)
+	if !ok {
+		t.Fatalf("expression is not ast.FieldAccessExpression. got=%T", program.Statements[2].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, access.Left, "p")
+	testIdentifier(t, access.Field, "x")
+}
+func TestStructTypeParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"struct Point { x int }; fun(p Point) Point { p };", ""},
+		{"struct Node { value int, next Node }", ""},
+		{"struct Point { x Foo }", "Parser error at 1:18: Can't find type with name Foo"},
+		{"struct Point { x int, x int }", "Parser error at 1:23: Field x is already defined in struct Point"},
+		{"fun(p Point) {};", "Parser error at 1:7: Can't find type with name Point"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		if tt.expectedError == "" {
+			checkParserErrors(t, p)
+			continue
+		}
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%q", tt.input, tt.expectedError, p.Errors())
+		}
+	}
+}
+func TestImportExportParsing(t *testing.T) {
+	input := `import "lib/strings";
+import "../math.kol"
+export let x = 1;
+export fun double(a int) int { a * 2 }
+export struct Point { x int }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 5 {
+		t.Fatalf("program.Statements does not contain 5 statements. got=%d", len(program.Statements))
+	}
+	imports := []struct {
+		path string
+		name string
+	}{
+		{"lib/strings", "strings"},
+		{"../math.kol", "math"},
+	}
+	for i, tt := range imports {
+		stmt, ok := program.Statements[i].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("Statements[%d] is not ast.ImportStatement. got=%T", i, program.Statements[i])
+		}
+		if stmt.Path != tt.path {
+			t.Errorf("import path wrong. expected=%q, got=%q", tt.path, stmt.Path)
+		}
+		testIdentifier(t, stmt.Name, tt.name)
+	}
+	for i, name := range []string{"x", "double", "Point"} {
+		stmt, ok := program.Statements[i+2].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("Statements[%d] is not ast.ExportStatement. got=%T", i+2, program.Statements[i+2])
+		}
+		if stmt.ExportedName() != name {
+			t.Errorf("exported name wrong. expected=%q, got=%q", name, stmt.ExportedName())
+		}
+	}
+}
+func TestModuleStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/geometry"; fun f(p geometry.Point) geometry.Point { p }`, "import \"lib/geometry\";let f = fun(p geometry.Point) geometry.Point p;"},
+		{`import "lib/geometry"; struct Line { from geometry.Point }`, "import \"lib/geometry\";struct Line { from geometry.Point }"},
+		{`import "lib/geometry"; geometry.Point{x: 1, y: 2}`, "import \"lib/geometry\";geometry.Point{x: 1, y: 2}"},
+		{`import "lib/geometry"; geometry.Empty{}`, "import \"lib/geometry\";geometry.Empty{}"},
+		{`import "lib/geometry"; if geometry.visible { geometry.draw() }`, "import \"lib/geometry\";if(geometry.visible) (geometry.draw)()"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+	p := New(lexer.New(`import "lib/geometry"; geometry.Point{x: 1}`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	lit, ok := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("expression is not ast.StructLiteral. got=%T", program.Statements[1].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, lit.Module, "geometry")
+	testIdentifier(t, lit.Name, "Point")
+	if lit.GetPosition().Column != 24 {
+		t.Errorf("struct literal should start at the module name, got %+v", lit.GetPosition())
+	}
+}
+func TestImportExportErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`import utils`, "Parser error at 1:8: expected next token to be STRING, got IDENT instead"},
+		{`import "lib/my-utils"`, `Parser error at 1:8: Can't import "lib/my-utils": "my-utils" is not a valid module name`},
+		{`import "lib/if"`, `Parser error at 1:8: Can't import "lib/if": "if" is not a valid module name`},
+		{`export 1 + 2`, "Parser error at 1:8: Only let, fun and struct declarations can be exported"},
+		{`import "lib/geometry"; fun f(p geometry.) {}`, "Parser error at 1:41: expected next token to be IDENT, got ) instead"},
+		{`fun f(p geometry.Point) {}`, "Parser error at 1:9: Can't find type with name geometry"},
+		{`fun f() { import "utils" }`, "Parser error at 1:11: import is only allowed at the top level of a file"},
+		{`if (true) { export let x = 1 }`, "Parser error at 1:13: export is only allowed at the top level of a file"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected error %q for %q, got none", tt.expectedError, tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{"let = 5; let y = 1; y", []string{"Parser error at 1:5: expected next token to be IDENT, got = instead"}, "let y = 1;y"},
+		{"let x = 1 + ; let y = 2", []string{"Parser error at 1:13: no prefix parse function for ; found"}, "let y = 2;"},
+		{"let f = fun() { let = 1 }; f()", []string{"Parser error at 1:21: expected next token to be IDENT, got = instead"}, "let f = fun() void ;f()"},
+		{"let f = fun() { 1 + }; f()", []string{"Parser error at 1:21: no prefix parse function for } found"}, "let f = fun() void ;f()"},
+		{"if (x) 1 }\nlet y = 2", []string{"Parser error at 1:8: expected next token to be {, got INT instead"}, "let y = 2;"},
+		{"}\nlet a = 1", []string{"Parser error at 1:1: no prefix parse function for } found"}, "let a = 1;"},
+		{"let a = [1, 2;\nlet b = 3", []string{"Parser error at 1:14: expected next token to be ], got ; instead"}, "let b = 3;"},
+		{"let f = fun(a int { a }\nlet b = 3", []string{"Parser error at 1:19: expected next token to be ), got { instead"}, "let b = 3;"},
+		{"let f = fun() {\n let a = 1\n", []string{"Parser error at 3:1: expected next token to be }, got EOF instead"}, ""},
+		{"let a = ;\nlet b = 1\nlet c = );\nc", []string{
+			"Parser error at 1:9: no prefix parse function for ; found",
+			"Parser error at 3:9: no prefix parse function for ) found",
+		}, "let b = 1;c"},
+		{"fun f() { 1 };\nf();;", nil, "let f = fun() void 1;f()"},
+		{"let b = add(1 2, if (true) { 1 } else { 2 })\nlet c = 3", []string{"Parser error at 1:15: expected next token to be ), got INT instead"}, "let c = 3;"},
+		{"let a = [1 for (true) { break }]\nlet b = 1", []string{"Parser error at 1:12: expected next token to be ], got FOR instead"}, "let b = 1;"},
+		{"let f = fun(a int {\n    a\n}\nlet b = 3", []string{"Parser error at 1:19: expected next token to be ), got { instead"}, "let b = 3;"},
+		{"let a = 1 +\n    * 2\nlet b = a", []string{"Parser error at 2:5: no prefix parse function for * found"}, "let b = a;"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%q, got=%q", tt.input, tt.expectedErrors, errors)
+			continue
+		}
+		for i, err := range errors {
+			if err != tt.expectedErrors[i] {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedErrors[i], err)
+			}
+		}
+		if program.String() != tt.expectedStatements {
+			t.Errorf("wrong statements for %q. expected=%q, got=%q", tt.input, tt.expectedStatements, program.String())
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // code, start and end of every diagnostic
+	}{
+		{"let = 5;", []string{"E0100 1:5-1:6"}},
+		{"let x = ;", []string{"E0101 1:9-1:10"}},
+		{"let x = 1 & 2;\nlet = 3;", []string{"E0001 1:11-1:12", "E0100 2:5-2:6"}},
+		{`import "1a"`, []string{"E0102 1:8-1:12"}},
+		{"let x = 5 | 3", []string{"E0001 1:11-1:12"}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		diagnostics := p.Diagnostics()
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, fmt.Sprintf("%s %d:%d-%d:%d", d.Code, d.Span.Start.Line, d.Span.Start.Column, d.Span.End.Line, d.Span.End.Column))
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("wrong diagnostics for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -2,6 +2,22 @@ package parser
 
 import "kol/token"
 
+// skipSemicolon consumes the optional semicolon ending a statement. After an error the
+// current token is left alone, it might be the closing brace the parser resynchronizes on.
+func (p *Parser) skipSemicolon() {
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
+		p.nextToken()
+	}
+}
+
+// Precedence returns how strongly an infix operator binds, LOWEST for other tokens
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -3,6 +3,9 @@ package parser
 import (
 	"kol/ast"
 	"kol/token"
+	"path"
+	"slices"
+	"strings"
 )
 
 func (p *Parser) parseLetStatement() ast.Statement {
@@ -26,11 +29,12 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
-
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
 	}
 
+	p.skipSemicolon()
+
 	return stmt
 }
 func (p *Parser) parseReassignStatement() ast.Statement {
@@ -40,13 +44,12 @@ func (p *Parser) parseReassignStatement() ast.Statement {
 
 	p.nextToken()
 	tok := p.curToken
+	stmt.Operator = tok.Literal
 	p.nextToken()
 
 	stmt.Value = getValue(*stmt.Name, tok, p.parseExpression(LOWEST))
 
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipSemicolon()
 
 	return stmt
 }
@@ -98,36 +101,157 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 		stmt.ReturnValue = p.parseExpression(LOWEST)
 	}
 
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipSemicolon()
 
 	return stmt
 }
 func (p *Parser) parseBreakStatement() ast.Statement {
 	stmt := &ast.BreakStatement{Token: p.curToken}
 
-	p.nextToken()
-
-	stmt.BreakValue = p.parseExpression(LOWEST)
-
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		stmt.BreakValue = nil
+	} else {
 		p.nextToken()
+		stmt.BreakValue = p.parseExpression(LOWEST)
 	}
 
+	p.skipSemicolon()
+
+	return stmt
+}
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
+func (p *Parser) parseStructStatement() ast.Statement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	if slices.Contains(ast.Types, p.curToken.Literal) {
+		p.addError("Can't redefine builtin type %s", p.curToken.Position, p.curToken.Literal)
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// registered before the fields are parsed so a struct can refer to itself
+	p.structs[stmt.Name.Value] = true
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Fields = []*ast.StructField{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.StructField{Token: p.curToken}
+		field.Ident = ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		typ, ok := p.parseType()
+		if !ok {
+			return nil
+		}
+		field.Type = *typ
+		for _, f := range stmt.Fields {
+			if f.Ident.Value == field.Ident.Value {
+				p.addError("Field %s is already defined in struct %s", field.Token.Position, field.Ident.Value, stmt.Name.Value)
+				return nil
+			}
+		}
+		stmt.Fields = append(stmt.Fields, field)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	p.skipSemicolon()
 	return stmt
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.depth++
+	defer func() { p.depth-- }()
+	// a block following an error is skipped, the statement containing it resynchronizes
+	skipped := p.panicking
+
 	p.nextToken()
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking && !skipped {
+			p.synchronize()
+			if p.curTokenIs(token.RBRACE) {
+				break
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.addError("expected next token to be %s, got %s instead", p.curToken.Position, token.RBRACE, token.EOF)
+	}
+	block.Rbrace = p.curToken
 	return block
 }
+
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+	name := moduleName(stmt.Path)
+	if !isIdentifier(name) {
+		p.addError("Can't import %q: %q is not a valid module name", p.curToken.Position, stmt.Path, name)
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Position: p.curToken.Position}, Value: name}
+	p.imports[name] = true
+	p.skipSemicolon()
+	return stmt
+}
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	p.nextToken()
+	switch {
+	case p.curTokenIs(token.LET):
+		stmt.Statement = p.parseLetStatement()
+	case p.curTokenIs(token.STRUCT):
+		stmt.Statement = p.parseStructStatement()
+	case p.curTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT):
+		stmt.Statement = p.parseFunction()
+	default:
+		p.addError("Only let, fun and struct declarations can be exported", p.curToken.Position)
+		return nil
+	}
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// moduleName returns the name an imported module is bound to, the last element of its path
+func moduleName(importPath string) string {
+	return strings.TrimSuffix(path.Base(importPath), ".kol")
+}
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+package profile
+
+import (
+	"encoding/binary"
+	"kol/code"
+	"kol/object"
+	"kol/vm"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the values every sample has, in this order
+const (
+	samplesValue = iota
+	cpuValue
+	allocValue
+)
+
+var SampleTypes = []ValueType{
+	{Type: "samples", Unit: "count"},
+	{Type: "cpu", Unit: "nanoseconds"},
+	{Type: "alloc_objects", Unit: "count"},
+}
+
+// Profile holds where a program spent its time and allocated objects, Write encodes it for go tool pprof
+type Profile struct {
+	Samples   []*Sample
+	Locations []*Location
+	Functions []*Function
+	// when the program started and how long it ran
+	TimeNanos     int64
+	DurationNanos int64
+	// the time between two samples
+	Period int64
+}
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Sample is a call stack, innermost call first, with the values measured in it
+type Sample struct {
+	Location []*Location
+	Value    []int64
+}
+
+// Location is a source line of a function
+type Location struct {
+	ID       uint64
+	Function *Function
+	Line     int64
+}
+type Function struct {
+	ID        uint64
+	Name      string
+	File      string
+	StartLine int64
+}
+
+type locationKey struct {
+	fn   *object.CompiledFunction
+	line int
+}
+
+// Profiler samples the call stack of a program running on the VM. It is attached with SetHook(p.Hook)
+// between Start and Stop. Time is sampled every period, allocations are counted exactly.
+type Profiler struct {
+	profile *Profile
+	period  time.Duration
+	ticker  *time.Ticker
+	done    chan struct{}
+	// set by the ticker, the next instruction takes a sample
+	tick atomic.Bool
+	last time.Time
+
+	functions map[*object.CompiledFunction]*Function
+	locations map[locationKey]*Location
+	// samples by their encoded call stack
+	samples map[string]*Sample
+	key     []byte
+	stack   []*Location
+}
+
+func New(period time.Duration) *Profiler {
+	return &Profiler{
+		profile:   &Profile{Period: period.Nanoseconds()},
+		period:    period,
+		functions: make(map[*object.CompiledFunction]*Function),
+		locations: make(map[locationKey]*Location),
+		samples:   make(map[string]*Sample),
+	}
+}
+
+// Start begins sampling time
+func (p *Profiler) Start() {
+	p.last = time.Now()
+	p.profile.TimeNanos = p.last.UnixNano()
+	p.ticker = time.NewTicker(p.period)
+	p.done = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				p.tick.Store(true)
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends sampling and returns the profile
+func (p *Profiler) Stop() *Profile {
+	p.ticker.Stop()
+	close(p.done)
+	p.profile.DurationNanos = time.Now().UnixNano() - p.profile.TimeNanos
+	return p.profile
+}
+
+// Hook is called by the VM before every instruction
+func (p *Profiler) Hook(machine *vm.VM) error {
+	if p.tick.Load() {
+		p.tick.Store(false)
+		now := time.Now()
+		sample := p.sample(machine)
+		sample.Value[samplesValue]++
+		sample.Value[cpuValue] += now.Sub(p.last).Nanoseconds()
+		p.last = now
+	}
+	if code.Allocates(machine.Opcode()) {
+		p.sample(machine).Value[allocValue]++
+	}
+	return nil
+}
+
+// sample returns the sample of the current call stack
+func (p *Profiler) sample(machine *vm.VM) *Sample {
+	p.key = p.key[:0]
+	p.stack = p.stack[:0]
+	for call := 0; call < machine.Depth(); call++ {
+		loc := p.location(machine, call)
+		p.stack = append(p.stack, loc)
+		p.key = binary.AppendUvarint(p.key, loc.ID)
+	}
+	if sample, ok := p.samples[string(p.key)]; ok {
+		return sample
+	}
+	sample := &Sample{Location: append([]*Location{}, p.stack...), Value: make([]int64, len(SampleTypes))}
+	p.samples[string(p.key)] = sample
+	p.profile.Samples = append(p.profile.Samples, sample)
+	return sample
+}
+func (p *Profiler) location(machine *vm.VM, call int) *Location {
+	fn, ip := machine.Function(call)
+	pos, _ := fn.SourceMap.Lookup(ip)
+	key := locationKey{fn: fn, line: pos.Line}
+	if loc, ok := p.locations[key]; ok {
+		return loc
+	}
+	loc := &Location{ID: uint64(len(p.profile.Locations) + 1), Function: p.function(fn, call == machine.Depth()-1), Line: int64(pos.Line)}
+	p.locations[key] = loc
+	p.profile.Locations = append(p.profile.Locations, loc)
+	return loc
+}
+func (p *Profiler) function(fn *object.CompiledFunction, main bool) *Function {
+	if f, ok := p.functions[fn]; ok {
+		return f
+	}
+	name := fn.DisplayName()
+	if main {
+		name = "<main>"
+	}
+	// pprof drops names in angle brackets like C++ template arguments
+	f := &Function{ID: uint64(len(p.profile.Functions) + 1), Name: strings.Trim(name, "<>"), File: fn.SourceMap.File}
+	if len(fn.SourceMap.Entries) > 0 {
+		f.StartLine = int64(fn.SourceMap.Entries[0].Position.Line)
+	}
+	p.functions[fn] = f
+	p.profile.Functions = append(p.profile.Functions, f)
+	return f
+}
@@ -0,0 +1,180 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"kol/compiler"
+	"kol/lexer"
+	"kol/parser"
+	"kol/vm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func run(t *testing.T, input string, period time.Duration) *Profile {
+	t.Helper()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	comp.SetFileName("main.kol")
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	profiler := New(period)
+	machine.SetHook(profiler.Hook)
+	profiler.Start()
+	err := machine.Run()
+	p := profiler.Stop()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return p
+}
+
+// stack formats the call stack of a sample like "pair:1 main:2"
+func stack(s *Sample) string {
+	frames := []string{}
+	for _, loc := range s.Location {
+		frames = append(frames, fmt.Sprintf("%s:%d", loc.Function.Name, loc.Line))
+	}
+	return strings.Join(frames, " ")
+}
+
+func TestAllocations(t *testing.T) {
+	input := `let pair = fun(x int) {
+    [x, x + 1]
+}
+pair(1)
+pair(2)
+fun(x int) { -x }(3)
+`
+	p := run(t, input, time.Hour)
+	allocs := map[string]int64{}
+	for _, s := range p.Samples {
+		allocs[stack(s)] = s.Value[allocValue]
+		if s.Value[samplesValue] != 0 || s.Value[cpuValue] != 0 {
+			t.Errorf("expected no time samples, got %v at %s", s.Value, stack(s))
+		}
+	}
+	expected := map[string]int64{
+		"main:1":             1,
+		"main:4":             1,
+		"pair:2 main:4":      2,
+		"main:5":             1,
+		"pair:2 main:5":      2,
+		"main:6":             2,
+		"anonymous:6 main:6": 1,
+	}
+	if len(allocs) != len(expected) {
+		t.Errorf("expected %d call stacks, got %v", len(expected), allocs)
+	}
+	for s, n := range expected {
+		if allocs[s] != n {
+			t.Errorf("expected %d allocations at %s, got %d", n, s, allocs[s])
+		}
+	}
+	if len(p.Functions) != 3 || len(p.Locations) != 6 {
+		t.Errorf("expected 3 functions and 6 locations, got %d and %d", len(p.Functions), len(p.Locations))
+	}
+}
+
+func TestCPU(t *testing.T) {
+	input := `let fibonacci = fun(x int) int {
+    if (x < 2) {
+        return x
+    }
+    fibonacci(x - 1) + fibonacci(x - 2)
+}
+fibonacci(20)
+`
+	p := run(t, input, 100*time.Microsecond)
+	var samples, cpu int64
+	for _, s := range p.Samples {
+		samples += s.Value[samplesValue]
+		cpu += s.Value[cpuValue]
+		if s.Value[samplesValue] > 0 && s.Location[0].Function.Name != "fibonacci" {
+			t.Errorf("expected time to be spent in fibonacci, got %s", stack(s))
+		}
+	}
+	if samples == 0 || cpu <= 0 || cpu > p.DurationNanos {
+		t.Errorf("expected samples within the duration %d, got %d samples of %dns", p.DurationNanos, samples, cpu)
+	}
+}
+
+// fields decodes the top level fields of a protocol buffer message, keeping only the last varint of a field
+func fields(t *testing.T, data []byte) (map[int]uint64, map[int][][]byte) {
+	varints, messages := map[int]uint64{}, map[int][][]byte{}
+	uvarint := func() uint64 {
+		var v uint64
+		for shift := 0; ; shift += 7 {
+			b := data[0]
+			data = data[1:]
+			v |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return v
+			}
+		}
+	}
+	for len(data) > 0 {
+		key := uvarint()
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			varints[field] = uvarint()
+		case wireBytes:
+			n := uvarint()
+			messages[field] = append(messages[field], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return varints, messages
+}
+
+func TestWrite(t *testing.T) {
+	p := &Profile{Period: 1000, DurationNanos: 5000}
+	main := &Function{ID: 1, Name: "main", File: "main.kol", StartLine: 1}
+	add := &Function{ID: 2, Name: "add", File: "main.kol", StartLine: 2}
+	p.Functions = []*Function{main, add}
+	p.Locations = []*Location{{ID: 1, Function: main, Line: 5}, {ID: 2, Function: add, Line: 3}}
+	p.Samples = []*Sample{{Location: []*Location{p.Locations[1], p.Locations[0]}, Value: []int64{1, 1000, 2}}}
+
+	var out bytes.Buffer
+	if err := p.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile isn't gzipped: %s", err)
+	}
+	data, _ := io.ReadAll(r)
+	varints, messages := fields(t, data)
+
+	strs := []string{}
+	for _, s := range messages[6] {
+		strs = append(strs, string(s))
+	}
+	expected := []string{"", "samples", "count", "cpu", "nanoseconds", "alloc_objects", "main", "main.kol", "add"}
+	if strings.Join(strs, ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong string table, expected %q, got %q", expected, strs)
+	}
+	if len(messages[1]) != 3 || len(messages[2]) != 1 || len(messages[4]) != 2 || len(messages[5]) != 2 {
+		t.Errorf("wrong number of sample types, samples, locations or functions")
+	}
+	if varints[10] != 5000 || varints[12] != 1000 || varints[14] != 3 {
+		t.Errorf("wrong duration, period or default sample type %v", varints)
+	}
+
+	_, sample := fields(t, messages[2][0])
+	if !bytes.Equal(sample[1][0], []byte{2, 1}) || !bytes.Equal(sample[2][0], []byte{1, 0xe8, 0x07, 2}) {
+		t.Errorf("wrong sample %v", sample)
+	}
+	function, name := fields(t, messages[5][1])
+	if function[1] != 2 || function[2] != 8 || function[4] != 7 || function[5] != 2 || len(name) != 0 {
+		t.Errorf("wrong function %v", function)
+	}
+}
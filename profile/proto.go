@@ -0,0 +1,129 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Write encodes the profile as gzipped protocol buffer in the format of
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+func (p *Profile) Write(w io.Writer) error {
+	strings := &stringTable{indices: map[string]int64{"": 0}, values: []string{""}}
+	var b buffer
+	for _, t := range SampleTypes {
+		b.message(1, valueType(t, strings))
+	}
+	for _, s := range p.Samples {
+		var sample buffer
+		ids := make([]uint64, len(s.Location))
+		for i, loc := range s.Location {
+			ids[i] = loc.ID
+		}
+		sample.packed(1, ids)
+		values := make([]uint64, len(s.Value))
+		for i, v := range s.Value {
+			values[i] = uint64(v)
+		}
+		sample.packed(2, values)
+		b.message(2, sample)
+	}
+	for _, loc := range p.Locations {
+		var location, line buffer
+		location.varint(1, loc.ID)
+		line.varint(1, loc.Function.ID)
+		line.varint(2, uint64(loc.Line))
+		location.message(4, line)
+		b.message(4, location)
+	}
+	for _, f := range p.Functions {
+		var function buffer
+		function.varint(1, f.ID)
+		function.varint(2, uint64(strings.index(f.Name)))
+		function.varint(3, uint64(strings.index(f.Name)))
+		function.varint(4, uint64(strings.index(f.File)))
+		function.varint(5, uint64(f.StartLine))
+		b.message(5, function)
+	}
+	b.varint(9, uint64(p.TimeNanos))
+	b.varint(10, uint64(p.DurationNanos))
+	b.message(11, valueType(SampleTypes[cpuValue], strings))
+	b.varint(12, uint64(p.Period))
+	b.varint(14, uint64(strings.index(SampleTypes[cpuValue].Type)))
+	// the string table comes last, every other field has added its strings by now
+	for _, s := range strings.values {
+		b.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+func valueType(t ValueType, strings *stringTable) buffer {
+	var b buffer
+	b.varint(1, uint64(strings.index(t.Type)))
+	b.varint(2, uint64(strings.index(t.Unit)))
+	return b
+}
+
+// stringTable numbers the strings of a profile, which refers to them by index
+type stringTable struct {
+	indices map[string]int64
+	values  []string
+}
+
+func (t *stringTable) index(s string) int64 {
+	if i, ok := t.indices[s]; ok {
+		return i
+	}
+	i := int64(len(t.values))
+	t.indices[s] = i
+	t.values = append(t.values, s)
+	return i
+}
+
+// buffer encodes the fields of a protocol buffer message
+type buffer []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *buffer) uvarint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+func (b *buffer) key(field int, wireType int) {
+	b.uvarint(uint64(field)<<3 | uint64(wireType))
+}
+
+// varint writes a field, zero values are left out like protocol buffers do
+func (b *buffer) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.uvarint(v)
+}
+func (b *buffer) bytes(field int, v []byte) {
+	b.key(field, wireBytes)
+	b.uvarint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+func (b *buffer) message(field int, m buffer) {
+	b.bytes(field, m)
+}
+
+// packed writes a repeated number field as one length delimited field
+func (b *buffer) packed(field int, values []uint64) {
+	var p buffer
+	for _, v := range values {
+		p.uvarint(v)
+	}
+	b.bytes(field, p)
+}
@@ -0,0 +1,159 @@
+// Package testrunner runs tests written in Kol. Tests are top level functions named test_* without
+// parameters in files ending in _test.kol, each runs on a fresh engine and fails with the first error
+// it runs into, like the ones of the assert, assert_eq and fail builtins.
+package testrunner
+
+import (
+	"context"
+	"io/fs"
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/engine"
+	"kol/lexer"
+	"kol/object"
+	"kol/parser"
+	"kol/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FileSuffix = "_test.kol"
+	TestPrefix = "test_"
+)
+
+type Options struct {
+	// the engine the tests run on, vm when empty
+	Engine string
+	// only tests with a matching name run, all of them when nil
+	Run *regexp.Regexp
+}
+
+// Test is a test function found in a file
+type Test struct {
+	Name     string
+	Position token.Position
+}
+
+// Result is the outcome of running one test
+type Result struct {
+	Test
+	File string
+	// what the test printed
+	Output string
+	// how long the test function ran
+	Duration time.Duration
+	// the diagnostics of the error the test failed with, empty when it passed
+	Failure []*diagnostic.Diagnostic
+}
+
+func (r *Result) Passed() bool {
+	return len(r.Failure) == 0
+}
+
+// Files returns the test files in a directory and its subdirectories sorted by path, a path to a
+// file is returned as it is
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(name, FileSuffix) {
+			files = append(files, name)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Tests returns the test functions declared at the top level of a program in the order they are declared
+func Tests(program *ast.Program) []Test {
+	var tests []Test
+	for _, statement := range program.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, TestPrefix) {
+			continue
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok && len(fn.Parameters) == 0 {
+			tests = append(tests, Test{Name: let.Name.Value, Position: let.Name.Token.Position})
+		}
+	}
+	return tests
+}
+
+// RunFile runs the tests of a file that match the options. The error reports files that can't be
+// read, parsed, type checked or whose top level code fails, none of their tests run then.
+func RunFile(ctx context.Context, fileName string, options Options) ([]*Result, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	input := string(content)
+	if _, err := load(ctx, fileName, input, options, &strings.Builder{}); err != nil {
+		return nil, err
+	}
+	// the engine already parsed it without errors
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var results []*Result
+	for _, test := range Tests(program) {
+		if options.Run != nil && !options.Run.MatchString(test.Name) {
+			continue
+		}
+		results = append(results, runTest(ctx, fileName, input, test, options))
+	}
+	return results, nil
+}
+
+// load runs the top level code of a test file on a new engine, which defines the test functions
+func load(ctx context.Context, fileName string, input string, options Options, output *strings.Builder) (engine.Engine, error) {
+	name := options.Engine
+	if name == "" {
+		name = "vm"
+	}
+	e, err := engine.New(name, engine.Options{IO: &object.IO{In: strings.NewReader(""), Out: output, Err: output}})
+	if err != nil {
+		return nil, err
+	}
+	_, err = e.Run(ctx, fileName, input)
+	return e, err
+}
+
+// runTest runs a test in isolation, the top level code of its file runs again before it
+func runTest(ctx context.Context, fileName string, input string, test Test, options Options) *Result {
+	result := &Result{Test: test, File: fileName}
+	var output strings.Builder
+	e, err := load(ctx, fileName, input, options, &output)
+	if err == nil {
+		// the duration is the one of the test alone, without the top level code
+		start := time.Now()
+		_, err = e.Call(ctx, test.Name)
+		result.Duration = time.Since(start)
+	}
+	result.Output = output.String()
+	if err != nil {
+		result.Failure = diagnostic.FromError(err, diagnostic.RuntimeError)
+		for _, d := range result.Failure {
+			if d.Span.File == "" {
+				d.Span.File = fileName
+			}
+		}
+	}
+	return result
+}
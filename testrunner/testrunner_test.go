@@ -0,0 +1,93 @@
+package testrunner
+
+import (
+	"context"
+	"kol/engine"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFiles(t *testing.T) {
+	files, err := Files("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join("testdata", "broken", "broken_test.kol"),
+		filepath.Join("testdata", "slow", "slow_test.kol"),
+		filepath.Join("testdata", "strings_test.kol"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+	files, err = Files("testdata/strings.kol")
+	if err != nil || len(files) != 1 || files[0] != "testdata/strings.kol" {
+		t.Errorf("expected a file to be returned as it is, got %v, %v", files, err)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	expected := map[string]string{
+		"test_repeat":   "",
+		"test_isolated": "",
+		"test_wrong":    "testdata/strings_test.kol:17:14: values aren't equal\n  expected: aaa\n    actual: aa\n              ^",
+		"test_fail":     "testdata/strings_test.kol:21:9: not implemented",
+	}
+	for _, name := range engine.Names {
+		results, err := RunFile(context.Background(), "testdata/strings_test.kol", Options{Engine: name})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		var names []string
+		for _, result := range results {
+			names = append(names, result.Name)
+			failure := ""
+			if !result.Passed() {
+				failure = result.Failure[0].Location() + ": " + result.Failure[0].Message
+			}
+			if failure != expected[result.Name] {
+				t.Errorf("%s: expected %s to fail with %q, got %q", name, result.Name, expected[result.Name], failure)
+			}
+		}
+		if !reflect.DeepEqual(names, []string{"test_repeat", "test_isolated", "test_wrong", "test_fail"}) {
+			t.Errorf("%s: expected the tests in the order they are declared, got %v", name, names)
+		}
+		if results[2].Output != "repeating a\n" || results[2].Position.Line != 15 {
+			t.Errorf("%s: expected the output and position of test_wrong, got %q at %v", name, results[2].Output, results[2].Position)
+		}
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	results, err := RunFile(context.Background(), "testdata/strings_test.kol", Options{Run: regexp.MustCompile("^test_(repeat|fail)$")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "test_repeat" || results[1].Name != "test_fail" {
+		t.Errorf("expected only the matching tests to run, got %v", results)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	start := time.Now()
+	results, err := RunFile(context.Background(), "testdata/slow/slow_test.kol", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the top level code runs twice, once to find the tests and once before the test
+	if total := time.Since(start); !results[0].Passed() || results[0].Duration > total/4 {
+		t.Errorf("expected the duration of the test without the top level code, got %s of %s", results[0].Duration, total)
+	}
+}
+func TestLoadError(t *testing.T) {
+	_, err := RunFile(context.Background(), "testdata/broken/broken_test.kol", Options{})
+	if err == nil || err.Error() != "Error at testdata/broken/broken_test.kol:2:12: Parameter 1 not valid: Expected bool but got int" {
+		t.Errorf("expected a type error, got %v", err)
+	}
+	if _, err := RunFile(context.Background(), "testdata/strings_test.kol", Options{Engine: "jit"}); err == nil {
+		t.Errorf("expected an unknown engine error")
+	}
+}
@@ -8,8 +8,16 @@ type Token struct {
 	Position Position
 }
 type Position struct {
-	Line   int
-	Column int
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Comment is a comment skipped by the lexer, Text includes the comment markers
+// and End is the position right after it
+type Comment struct {
+	Text     string
+	Position Position
+	End      Position
 }
 
 func New(tokenType TokenType, ch byte, pos Position) Token {
@@ -41,6 +49,9 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	LTEQ = "<="
 	GTEQ = ">="
 	LT   = "<"
@@ -66,22 +77,28 @@ const (
 	ELSE     = "ELSE"
 	FOR      = "FOR"
 	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	RETURN   = "RETURN"
 	STRUCT   = "STRUCT"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 )
 
 var keywords = map[string]TokenType{
-	"fun":    FUNCTION,
-	"let":    LET,
-	"mut":    MUT,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"for":    FOR,
-	"break":  BREAK,
-	"return": RETURN,
-	"struct": STRUCT,
+	"fun":      FUNCTION,
+	"let":      LET,
+	"mut":      MUT,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"return":   RETURN,
+	"struct":   STRUCT,
+	"import":   IMPORT,
+	"export":   EXPORT,
 }
 
 func LookupIdent(ident string) TokenType {
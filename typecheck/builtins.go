@@ -0,0 +1,17 @@
+package typecheck
+
+// builtins holds the signatures of the builtin functions, builtins missing here are unchecked
+var builtins = map[string]*Function{
+	"println":   {Parameters: []Type{String, Unknown}, Return: Void, Variadic: true},
+	"len":       {Parameters: []Type{Unknown}, Return: Int},
+	"str":       {Parameters: []Type{Unknown}, Return: String, Variadic: true},
+	"int":       {Parameters: []Type{String}, Return: Int},
+	"float":     {Parameters: []Type{String}, Return: Float},
+	"push":      {Parameters: []Type{Array, Unknown}, Return: Array},
+	"remove":    {Parameters: []Type{Array, Int}, Return: Array},
+	"eprintln":  {Parameters: []Type{String, Unknown}, Return: Void, Variadic: true},
+	"readln":    {Return: String},
+	"assert":    {Parameters: []Type{Bool}, Return: Void},
+	"assert_eq": {Parameters: []Type{Unknown, Unknown}, Return: Void},
+	"fail":      {Parameters: []Type{String}, Return: Void},
+}
@@ -0,0 +1,218 @@
+package typecheck
+
+import (
+	"kol/ast"
+	"kol/diagnostic"
+	"kol/token"
+	"maps"
+)
+
+type variable struct {
+	typ     Type
+	mutable bool
+}
+
+// scope holds the variables of a function or block
+type scope struct {
+	outer *scope
+	vars  map[string]variable
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, vars: make(map[string]variable)}
+}
+func (s *scope) get(name string) (variable, bool) {
+	v, ok := s.vars[name]
+	if !ok && s.outer != nil {
+		return s.outer.get(name)
+	}
+	return v, ok
+}
+
+// Checker infers the types of a program and verifies them without running it
+type Checker struct {
+	errors []*diagnostic.Diagnostic
+
+	scope   *scope
+	structs map[string]*Struct
+	// names defined at the top level, functions may use them before they are defined
+	globals map[string]bool
+	// the return types of the functions being checked, innermost last
+	returnTypes []Type
+	// the signatures of the builtins, builtins missing here are unchecked
+	builtins map[string]*Function
+	// set while checking an expression whose value is used, a break or continue inside of it would leave the value
+	// unfinished
+	inExpression bool
+}
+
+func New() *Checker {
+	return &Checker{scope: newScope(nil), structs: make(map[string]*Struct), globals: make(map[string]bool), builtins: maps.Clone(builtins)}
+}
+
+// DefineBuiltin adds or replaces the signature of a builtin
+func (c *Checker) DefineBuiltin(name string, fn *Function) {
+	c.builtins[name] = fn
+}
+
+func (c *Checker) Errors() []*diagnostic.Diagnostic {
+	return c.errors
+}
+
+// Check verifies a program and returns all type errors it contains
+func Check(program *ast.Program) []*diagnostic.Diagnostic {
+	c := New()
+	c.Check(program)
+	return c.Errors()
+}
+
+func (c *Checker) Check(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		if name := declaredName(stmt); name != "" {
+			c.globals[name] = true
+		}
+	}
+	for _, stmt := range program.Statements {
+		c.checkStatement(stmt)
+	}
+}
+func declaredName(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Name.Value
+	case *ast.StructStatement:
+		return stmt.Name.Value
+	case *ast.ImportStatement:
+		return stmt.Name.Value
+	case *ast.ExportStatement:
+		return stmt.ExportedName()
+	}
+	return ""
+}
+
+func (c *Checker) addError(pos token.Position, format string, a ...interface{}) {
+	c.errors = append(c.errors, diagnostic.New(diagnostic.TypeError, diagnostic.At(pos), format, a...))
+}
+func (c *Checker) define(name string, typ Type, mutable bool) {
+	c.scope.vars[name] = variable{typ: typ, mutable: mutable}
+}
+
+func (c *Checker) checkStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		c.checkExpressionStatement(stmt)
+	case *ast.LetStatement:
+		c.checkLetStatement(stmt)
+	case *ast.ReassignStatement:
+		c.checkReassignStatement(stmt)
+	case *ast.ReturnStatement:
+		c.checkReturnStatement(stmt)
+	case *ast.BreakStatement:
+		if c.inExpression {
+			c.addError(stmt.GetPosition(), "break can't be used inside of an expression whose value is used")
+		}
+		if stmt.BreakValue != nil {
+			c.checkValue(stmt.BreakValue)
+		}
+	case *ast.ContinueStatement:
+		if c.inExpression {
+			c.addError(stmt.GetPosition(), "continue can't be used inside of an expression whose value is used")
+		}
+	case *ast.StructStatement:
+		c.checkStructStatement(stmt)
+	case *ast.ImportStatement:
+		c.define(stmt.Name.Value, Unknown, false)
+	case *ast.ExportStatement:
+		c.checkStatement(stmt.Statement)
+	case *ast.BlockStatement:
+		c.checkBlock(stmt)
+	}
+}
+func (c *Checker) checkExpressionStatement(stmt *ast.ExpressionStatement) Type {
+	switch exp := stmt.Expression.(type) {
+	case *ast.IfExpression, *ast.ForExpression:
+		// their blocks can be left as long as their value isn't used by an expression around them
+		return c.checkExpression(exp)
+	}
+	return c.checkValue(stmt.Expression)
+}
+func (c *Checker) checkLetStatement(stmt *ast.LetStatement) {
+	if _, ok := c.scope.vars[stmt.Name.Value]; ok {
+		c.addError(stmt.GetPosition(), "Variable %s can't be redefined", stmt.Name.Value)
+	}
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		// defined before the body is checked so the function can call itself
+		c.define(stmt.Name.Value, c.signature(fn), stmt.Mutable)
+	}
+	typ := c.checkValue(stmt.Value)
+	c.define(stmt.Name.Value, typ, stmt.Mutable)
+}
+func (c *Checker) checkReassignStatement(stmt *ast.ReassignStatement) {
+	typ := c.checkValue(stmt.Value)
+	v, ok := c.scope.get(stmt.Name.Value)
+	if !ok {
+		if !c.globals[stmt.Name.Value] {
+			c.addError(stmt.GetPosition(), "Variable %s isn't defined", stmt.Name.Value)
+		}
+		return
+	}
+	if !v.mutable {
+		c.addError(stmt.GetPosition(), "Variable %s isn't mutable", stmt.Name.Value)
+		return
+	}
+	if !compatible(v.typ, typ) {
+		c.addError(stmt.GetPosition(), "Can't change type of variable from %s to %s", v.typ, typ)
+	}
+}
+func (c *Checker) checkReturnStatement(stmt *ast.ReturnStatement) {
+	typ := Type(Void)
+	if stmt.ReturnValue != nil {
+		typ = c.checkValue(stmt.ReturnValue)
+	}
+	if len(c.returnTypes) == 0 {
+		return
+	}
+	expected := c.returnTypes[len(c.returnTypes)-1]
+	if !compatible(expected, typ) {
+		c.addError(stmt.GetPosition(), "Returned type %s doesn't match expected type %s", typ, expected)
+	}
+}
+func (c *Checker) checkStructStatement(stmt *ast.StructStatement) {
+	if _, ok := c.scope.vars[stmt.Name.Value]; ok {
+		c.addError(stmt.GetPosition(), "Variable %s can't be redefined", stmt.Name.Value)
+	}
+	s := &Struct{Name: stmt.Name.Value, Fields: make(map[string]Type)}
+	// registered before the fields are resolved so a struct can refer to itself
+	c.structs[s.Name] = s
+	for _, field := range stmt.Fields {
+		s.Fields[field.Ident.Value] = c.typeFromName(&field.Type)
+	}
+	c.define(s.Name, Unknown, false)
+}
+
+// checkBlock checks a block in a scope of its own and returns the type of the value it evaluates to
+func (c *Checker) checkBlock(block *ast.BlockStatement) Type {
+	c.scope = newScope(c.scope)
+	typ := c.checkStatements(block)
+	c.scope = c.scope.outer
+	return typ
+}
+
+// checkStatements checks the statements of a block in the current scope
+func (c *Checker) checkStatements(block *ast.BlockStatement) Type {
+	typ := Type(Void)
+	for _, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			typ = c.checkExpressionStatement(stmt)
+		case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			// the block never evaluates to a value
+			c.checkStatement(stmt)
+			typ = Unknown
+		default:
+			c.checkStatement(stmt)
+			typ = Void
+		}
+	}
+	return typ
+}
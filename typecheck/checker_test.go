@@ -0,0 +1,96 @@
+package typecheck
+
+import (
+	"kol/lexer"
+	"kol/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{`let a = 1; let b = a + 2.5; b * 2`, nil},
+		{`let add = fun(a int, b int) int { a + b }; add(1, 2) + 3`, nil},
+		{`let fib = fun(n int) int { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }`, nil},
+		{`fun adder() fn { let mut i = 0; return fun() int { i += 1; i } } adder()()`, nil},
+		{`let even = fun(n int) bool { if (n == 0) { true } else { odd(n - 1) } }; let odd = fun(n int) bool { !even(n) }`, nil},
+		{`struct Point { x int, y float }; let p = Point{x: 1, y: 2.5}; p.y + p.x`, nil},
+		{`let mut s = "a"; s = s + "b"; println("%s", s); len(s) + 1`, nil},
+		{`let m = {"a": 1, 2: true}; let a = [1, "2"]; m["a"]; a[0]`, nil},
+		{`import "lib/math"; math.double(2) + 1`, nil},
+		{`import "lib/geometry"; struct Point { y int }; fun f(p geometry.Point) geometry.Point { p }; f(geometry.Point{x: 1})`, nil},
+		{`import "lib/geometry"; geometry.Point{x: 1 + "a"}`, []string{"Error at 1:44: type mismatch: int + str"}},
+		{`let a = 1; a + "b"`, []string{"Error at 1:14: type mismatch: int + str"}},
+		{`"a" - "b"`, []string{"Error at 1:5: unknown operator: str - str"}},
+		{`1.5 % 2`, []string{"Error at 1:5: Can't take the remainder of non-integers"}},
+		{`-true; !1`, []string{"Error at 1:1: unknown operator: -bool", "Error at 1:8: unknown operator: !int"}},
+		{`if (1) { 2 }`, []string{"Error at 1:5: int is not of type bool and can't be used as a condition"}},
+		{`for ("x") { 2 }`, []string{"Error at 1:6: str is not of type bool and can't be used as a condition"}},
+		{`true && 1`, []string{"Error at 1:9: int is not of type bool and can't be used as a condition"}},
+		{`let x = 1; let x = 2`, []string{"Error at 1:12: Variable x can't be redefined"}},
+		{`let a = true; if (a) { let x = 1; x } else { let x = 2; x }; let x = "b"`, nil},
+		{`let x = 1; if (true) { let x = "a"; x + "b" }; x + 1`, nil},
+		{`if (true) { let y = 1; let y = 2 }; y`, []string{
+			"Error at 1:24: Variable y can't be redefined",
+			"Error at 1:37: identifier not found: y",
+		}},
+		{`let f = fun(a int) int { let a = 2; a }`, []string{"Error at 1:26: Variable a can't be redefined"}},
+		{`let x = 1; x = 2`, []string{"Error at 1:12: Variable x isn't mutable"}},
+		{`let mut x = 1; x = "a"`, []string{"Error at 1:16: Can't change type of variable from int to str"}},
+		{`for (true) { if (true) { break } else { continue }; let a = for (true) { break 1 }; break a }`, nil},
+		{`for (true) { let a = [1, if (true) { break 2 } else { 3 }] }`, []string{
+			"Error at 1:38: break can't be used inside of an expression whose value is used",
+		}},
+		{`for (true) { 1 + if (true) { continue } else { 2 }; let f = fun() { for (true) { break } } }`, []string{
+			"Error at 1:30: continue can't be used inside of an expression whose value is used",
+		}},
+		{`y = 1`, []string{"Error at 1:1: Variable y isn't defined"}},
+		{`y + 1`, []string{"Error at 1:1: identifier not found: y"}},
+		{`let f = fun(a int) int { a }; f(1, 2); f("a")`, []string{
+			"Error at 1:32: Wrong number of arguments: want=1, got=2",
+			"Error at 1:42: Parameter 1 not valid: Expected int but got str",
+		}},
+		{`let f = fun() int { return "a" }`, []string{"Error at 1:21: Returned type str doesn't match expected type int"}},
+		{`let f = fun() int { "a" }`, []string{"Error at 1:19: Returned type str doesn't match expected type int"}},
+		{`let f = fun() { 1 }`, []string{"Error at 1:15: Returned type int doesn't match expected type void"}},
+		{`let f = fun() int { if (true) { return 1 } else { return 2 } }`, nil},
+		{`let a = 1; a()`, []string{"Error at 1:13: not a function: int"}},
+		{`println(1)`, []string{"Error at 1:9: Parameter 1 not valid: Expected str but got int"}},
+		{`len()`, []string{"Error at 1:4: Wrong number of arguments: want=1, got=0"}},
+		{`"abc"[0]; [1][true]`, []string{
+			"Error at 1:6: index operator not supported: str",
+			"Error at 1:15: index must be int, got bool",
+		}},
+		{`{[1]: 2}`, []string{"Error at 1:2: unusable as hash key: array"}},
+		{`struct P { x int, y int }; P{x: "a", z: 1}`, []string{
+			"Error at 1:33: Field x not valid: Expected int but got str",
+			"Error at 1:38: Struct P has no field z",
+			"Error at 1:28: Missing field y for struct P",
+		}},
+		{`struct P { x int }; P{x: 1}.y; let i = 1; i.x`, []string{
+			"Error at 1:29: Struct P has no field y",
+			"Error at 1:45: field access not supported: int",
+		}},
+		{`struct Node { value int, next Node }; fun f(n Node) int { n.next.value }`, nil},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+		errors := Check(program)
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%q, got=%q", tt.input, tt.expectedErrors, errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.Error() != tt.expectedErrors[i] {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedErrors[i], err.Error())
+			}
+		}
+	}
+}
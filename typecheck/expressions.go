@@ -0,0 +1,312 @@
+package typecheck
+
+import (
+	"kol/ast"
+	"sort"
+)
+
+// checkValue checks an expression whose value is used
+func (c *Checker) checkValue(exp ast.Expression) Type {
+	outer := c.inExpression
+	c.inExpression = true
+	typ := c.checkExpression(exp)
+	c.inExpression = outer
+	return typ
+}
+func (c *Checker) checkExpression(exp ast.Expression) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.FloatLiteral:
+		return Float
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.Identifier:
+		return c.checkIdentifier(exp)
+	case *ast.PrefixExpression:
+		return c.checkPrefixExpression(exp)
+	case *ast.InfixExpression:
+		return c.checkInfixExpression(exp)
+	case *ast.IfExpression:
+		return c.checkIfExpression(exp)
+	case *ast.ForExpression:
+		c.checkCondition(exp.Condition)
+		// breaks and continues of the body leave this loop, not the expression around it
+		outer := c.inExpression
+		c.inExpression = false
+		c.checkBlock(exp.Consequence)
+		c.inExpression = outer
+		if exp.Alternative != nil {
+			c.checkBlock(exp.Alternative)
+		}
+		return Unknown
+	case *ast.FunctionLiteral:
+		return c.checkFunctionLiteral(exp)
+	case *ast.CallExpression:
+		return c.checkCallExpression(exp)
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			c.checkExpression(el)
+		}
+		return Array
+	case *ast.HashLiteral:
+		return c.checkHashLiteral(exp)
+	case *ast.IndexExpression:
+		return c.checkIndexExpression(exp)
+	case *ast.StructLiteral:
+		return c.checkStructLiteral(exp)
+	case *ast.FieldAccessExpression:
+		return c.checkFieldAccessExpression(exp)
+	}
+	return Unknown
+}
+func (c *Checker) checkIdentifier(ident *ast.Identifier) Type {
+	if v, ok := c.scope.get(ident.Value); ok {
+		return v.typ
+	}
+	if fn, ok := c.builtins[ident.Value]; ok {
+		return fn
+	}
+	if !c.globals[ident.Value] {
+		c.addError(ident.GetPosition(), "identifier not found: %s", ident.Value)
+	}
+	return Unknown
+}
+func (c *Checker) checkPrefixExpression(exp *ast.PrefixExpression) Type {
+	right := c.checkExpression(exp.Right)
+	switch {
+	case right == Unknown:
+		if exp.Operator == "!" {
+			return Bool
+		}
+		return Unknown
+	case exp.Operator == "!" && right == Bool:
+		return Bool
+	case exp.Operator == "-" && isNumber(right):
+		return right
+	}
+	c.addError(exp.GetPosition(), "unknown operator: %s%s", exp.Operator, right)
+	return Unknown
+}
+func (c *Checker) checkInfixExpression(exp *ast.InfixExpression) Type {
+	if exp.Operator == "&&" || exp.Operator == "||" {
+		c.checkCondition(exp.Left)
+		c.checkCondition(exp.Right)
+		return Bool
+	}
+	left := c.checkExpression(exp.Left)
+	right := c.checkExpression(exp.Right)
+
+	switch exp.Operator {
+	case "==", "!=":
+		return Bool
+	}
+	if left == Unknown || right == Unknown {
+		switch exp.Operator {
+		case "<", ">", "<=", ">=":
+			return Bool
+		case "/":
+			return Float
+		}
+		return Unknown
+	}
+
+	switch {
+	case isNumber(left) && isNumber(right):
+		switch exp.Operator {
+		case "+", "-", "*":
+			if left == Int && right == Int {
+				return Int
+			}
+			return Float
+		case "/":
+			return Float
+		case "%":
+			if left == Int && right == Int {
+				return Int
+			}
+			c.addError(exp.GetPosition(), "Can't take the remainder of non-integers")
+			return Unknown
+		case "<", ">", "<=", ">=":
+			return Bool
+		}
+	case left == String && right == String && exp.Operator == "+":
+		return String
+	case !compatible(left, right):
+		c.addError(exp.GetPosition(), "type mismatch: %s %s %s", left, exp.Operator, right)
+		return Unknown
+	}
+	c.addError(exp.GetPosition(), "unknown operator: %s %s %s", left, exp.Operator, right)
+	return Unknown
+}
+
+// checkCondition verifies an expression is used as a condition
+func (c *Checker) checkCondition(exp ast.Expression) {
+	typ := c.checkValue(exp)
+	if !compatible(Bool, typ) {
+		c.addError(exp.GetPosition(), "%s is not of type bool and can't be used as a condition", typ)
+	}
+}
+func (c *Checker) checkIfExpression(exp *ast.IfExpression) Type {
+	c.checkCondition(exp.Condition)
+	consequence := c.checkBlock(exp.Consequence)
+	if exp.Alternative == nil {
+		if consequence == Void {
+			return Void
+		}
+		return Unknown
+	}
+	alternative := c.checkBlock(exp.Alternative)
+	if consequence == Unknown || alternative == Unknown || consequence.String() != alternative.String() {
+		return Unknown
+	}
+	return consequence
+}
+
+// signature returns the type of a function literal without checking its body
+func (c *Checker) signature(fn *ast.FunctionLiteral) *Function {
+	typ := &Function{Return: c.typeFromName(fn.ReturnType)}
+	for _, param := range fn.Parameters {
+		typ.Parameters = append(typ.Parameters, c.typeFromName(&param.Type))
+	}
+	return typ
+}
+func (c *Checker) checkFunctionLiteral(fn *ast.FunctionLiteral) Type {
+	typ := c.signature(fn)
+
+	outer := c.inExpression
+	c.inExpression = false
+	c.scope = newScope(c.scope)
+	c.returnTypes = append(c.returnTypes, typ.Return)
+	for i, param := range fn.Parameters {
+		c.define(param.Ident.Value, typ.Parameters[i], false)
+	}
+
+	// the parameters and the body share the scope of the function
+	body := c.checkStatements(fn.Body)
+	if !compatible(typ.Return, body) {
+		c.addError(fn.Body.GetPosition(), "Returned type %s doesn't match expected type %s", body, typ.Return)
+	}
+
+	c.returnTypes = c.returnTypes[:len(c.returnTypes)-1]
+	c.scope = c.scope.outer
+	c.inExpression = outer
+	return typ
+}
+func (c *Checker) checkCallExpression(exp *ast.CallExpression) Type {
+	callee := c.checkExpression(exp.Function)
+	args := make([]Type, len(exp.Arguments))
+	for i, arg := range exp.Arguments {
+		args[i] = c.checkExpression(arg)
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		if callee != Unknown && callee != Fn {
+			c.addError(exp.GetPosition(), "not a function: %s", callee)
+		}
+		return Unknown
+	}
+
+	want := len(fn.Parameters)
+	if fn.Variadic && len(args) < want-1 || !fn.Variadic && len(args) != want {
+		c.addError(exp.GetPosition(), "Wrong number of arguments: want=%d, got=%d", want, len(args))
+		return fn.Return
+	}
+	for i, arg := range args {
+		param := fn.Parameters[min(i, want-1)]
+		if !compatible(param, arg) {
+			c.addError(exp.Arguments[i].GetPosition(), "Parameter %d not valid: Expected %s but got %s", i+1, param, arg)
+		}
+	}
+	return fn.Return
+}
+func (c *Checker) checkHashLiteral(exp *ast.HashLiteral) Type {
+	keys := []ast.Expression{}
+	for k := range exp.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		typ := c.checkExpression(k)
+		if typ != Unknown && typ != Int && typ != Bool && typ != String {
+			c.addError(k.GetPosition(), "unusable as hash key: %s", typ)
+		}
+		c.checkExpression(exp.Pairs[k])
+	}
+	return Map
+}
+func (c *Checker) checkIndexExpression(exp *ast.IndexExpression) Type {
+	left := c.checkExpression(exp.Left)
+	index := c.checkExpression(exp.Index)
+	switch left {
+	case Unknown, Map:
+	case Array:
+		if !compatible(Int, index) {
+			c.addError(exp.Index.GetPosition(), "index must be int, got %s", index)
+		}
+	default:
+		c.addError(exp.GetPosition(), "index operator not supported: %s", left)
+	}
+	return Unknown
+}
+func (c *Checker) checkStructLiteral(exp *ast.StructLiteral) Type {
+	if exp.Module != nil {
+		// the fields of structs of other modules are only known once the module is loaded
+		c.checkExpression(exp.Module)
+		for _, field := range exp.Fields {
+			c.checkExpression(field.Value)
+		}
+		return Unknown
+	}
+	s, ok := c.structs[exp.Name.Value]
+	if !ok {
+		c.addError(exp.GetPosition(), "%s is not a struct", exp.Name.Value)
+		return Unknown
+	}
+	set := make(map[string]bool)
+	for _, field := range exp.Fields {
+		typ := c.checkExpression(field.Value)
+		expected, ok := s.Fields[field.Name.Value]
+		switch {
+		case !ok:
+			c.addError(field.Name.GetPosition(), "Struct %s has no field %s", s.Name, field.Name.Value)
+		case set[field.Name.Value]:
+			c.addError(field.Name.GetPosition(), "Field %s is set more than once", field.Name.Value)
+		case !compatible(expected, typ):
+			c.addError(field.Value.GetPosition(), "Field %s not valid: Expected %s but got %s", field.Name.Value, expected, typ)
+		}
+		set[field.Name.Value] = true
+	}
+	missing := []string{}
+	for name := range s.Fields {
+		if !set[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		c.addError(exp.GetPosition(), "Missing field %s for struct %s", name, s.Name)
+	}
+	return s
+}
+func (c *Checker) checkFieldAccessExpression(exp *ast.FieldAccessExpression) Type {
+	left := c.checkExpression(exp.Left)
+	switch left := left.(type) {
+	case *Struct:
+		typ, ok := left.Fields[exp.Field.Value]
+		if !ok {
+			c.addError(exp.Field.GetPosition(), "Struct %s has no field %s", left.Name, exp.Field.Value)
+			return Unknown
+		}
+		return typ
+	case unknown:
+		return Unknown
+	}
+	c.addError(exp.Field.GetPosition(), "field access not supported: %s", left)
+	return Unknown
+}
@@ -0,0 +1,75 @@
+package typecheck
+
+import "kol/ast"
+
+// Type is the static type of an expression
+type Type interface {
+	String() string
+}
+
+// Basic is one of the builtin types, named like in the source code
+type Basic string
+
+func (b Basic) String() string { return string(b) }
+
+const (
+	Int    Basic = "int"
+	Float  Basic = "float"
+	Bool   Basic = "bool"
+	String Basic = "str"
+	Map    Basic = "map"
+	Array  Basic = "array"
+	Fn     Basic = "fn"
+	Void   Basic = "void"
+)
+
+// Function is the type of a function whose signature is known
+type Function struct {
+	Parameters []Type
+	Return     Type
+	// the last parameter can be repeated any number of times
+	Variadic bool
+}
+
+func (f *Function) String() string { return string(Fn) }
+
+type Struct struct {
+	Name   string
+	Fields map[string]Type
+}
+
+func (s *Struct) String() string { return s.Name }
+
+type unknown struct{}
+
+func (unknown) String() string { return "unknown" }
+
+// Unknown is the type of expressions that can only be typed at runtime.
+// It is compatible with every other type.
+var Unknown Type = unknown{}
+
+func compatible(expected Type, actual Type) bool {
+	if expected == Unknown || actual == Unknown {
+		return true
+	}
+	return expected.String() == actual.String()
+}
+func isNumber(t Type) bool {
+	return t == Int || t == Float
+}
+
+// typeFromName returns the type a type annotation refers to
+func (c *Checker) typeFromName(name *ast.Identifier) Type {
+	if name == nil {
+		return Void
+	}
+	if s, ok := c.structs[name.Value]; ok {
+		return s
+	}
+	for _, t := range ast.Types {
+		if t == name.Value {
+			return Basic(name.Value)
+		}
+	}
+	return Unknown
+}
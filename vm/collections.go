@@ -41,7 +41,7 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	i := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 	if i < 0 || i > max {
-		return vm.push(Void)
+		return fmt.Errorf("Index %d out of bounds for array of size %d", i, max+1)
 	}
 	return vm.push(arrayObject.Elements[i])
 }
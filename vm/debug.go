@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"errors"
+	"kol/code"
+	"kol/object"
+	"kol/token"
+	"strconv"
+)
+
+// Hook is called before every instruction once it is set, a VM without a hook only pays a nil check.
+// Returning an error stops the program with that error.
+type Hook func(vm *VM) error
+
+// ErrStopped is returned by hooks to end the program early, Run returns it unchanged
+var ErrStopped = errors.New("program stopped")
+
+func (vm *VM) SetHook(hook Hook) {
+	vm.hook = hook
+}
+
+// Variable is a named value of a running program, Value is nil while it has none
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Depth returns the number of active calls, the main program counts as one
+func (vm *VM) Depth() int {
+	return vm.framesIndex
+}
+
+// Position returns the file and source position of the instruction about to run
+func (vm *VM) Position() (string, token.Position, bool) {
+	frame := vm.currentFrame()
+	pos, ok := frame.cl.Fn.SourceMap.Lookup(frame.ip)
+	return frame.cl.Fn.SourceMap.File, pos, ok
+}
+
+// CallStack returns the active calls, innermost first
+func (vm *VM) CallStack() []TraceEntry {
+	return vm.stackTrace()
+}
+
+// Function returns the function of a call and the offset of its current instruction, counted like CallStack
+func (vm *VM) Function(call int) (*object.CompiledFunction, int) {
+	frame := vm.frames[vm.framesIndex-1-call]
+	return frame.cl.Fn, frame.ip
+}
+
+// Opcode returns the instruction about to run
+func (vm *VM) Opcode() code.Opcode {
+	frame := vm.currentFrame()
+	return code.Opcode(frame.Instructions()[frame.ip])
+}
+
+// Locals returns the local variables of a call, counted like CallStack from the innermost one
+func (vm *VM) Locals(call int) []Variable {
+	frame := vm.frames[vm.framesIndex-1-call]
+	fn := frame.cl.Fn
+	locals := []Variable{}
+	for i := 0; i < fn.NumLocals; i++ {
+		locals = append(locals, Variable{Name: variableName(fn.LocalNames, i), Value: vm.stack[frame.basePointer+i]})
+	}
+	return locals
+}
+
+// FreeVariables returns the variables a call captured from enclosing functions
+func (vm *VM) FreeVariables(call int) []Variable {
+	cl := vm.frames[vm.framesIndex-1-call].cl
+	free := []Variable{}
+	for i, upvalue := range cl.Free {
+		free = append(free, Variable{Name: variableName(cl.Fn.FreeNames, i), Value: upvalue.Get()})
+	}
+	return free
+}
+
+// Global returns the value of the global variable with the given index
+func (vm *VM) Global(index int) object.Object {
+	return vm.globals[index]
+}
+
+// variableName returns the name of a variable, bytecode compiled without names shows the index
+func variableName(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return "$" + strconv.Itoa(index)
+}
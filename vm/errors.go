@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"kol/diagnostic"
+	"kol/token"
+)
+
+// RuntimeError is returned by Run for every error raised while executing bytecode
+type RuntimeError struct {
+	Message  string
+	File     string
+	Position *token.Position
+	Trace    []TraceEntry // innermost call first
+	// calls left out of Trace after its first traceHead entries, deep recursion has too many to show
+	Omitted int
+	// the error raised by the program, like an *object.LimitError or context.DeadlineExceeded
+	err error
+}
+type TraceEntry struct {
+	Function string
+	File     string
+	Position *token.Position
+}
+
+func (e *RuntimeError) Error() string {
+	var out bytes.Buffer
+	if e.Position != nil {
+		fmt.Fprintf(&out, "Error at %s: %s", formatLocation(e.File, e.Position), e.Message)
+	} else {
+		out.WriteString("Error: " + e.Message)
+	}
+	for i, entry := range e.Trace {
+		if i == traceHead && e.Omitted > 0 {
+			fmt.Fprintf(&out, "\n\t... %d more calls", e.Omitted)
+		}
+		fmt.Fprintf(&out, "\n\tat %s", entry.Function)
+		if entry.Position != nil {
+			fmt.Fprintf(&out, " (%s)", formatLocation(entry.File, entry.Position))
+		}
+	}
+	return out.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.err
+}
+
+// Diagnostic converts the error into a diagnostic, the call stack becomes its notes
+func (e *RuntimeError) Diagnostic() *diagnostic.Diagnostic {
+	span := diagnostic.Span{File: e.File}
+	if e.Position != nil {
+		span.Start, span.End = *e.Position, *e.Position
+	}
+	d := diagnostic.New(diagnostic.RuntimeError, span, "%s", e.Message)
+	for i, entry := range e.Trace {
+		if i == traceHead && e.Omitted > 0 {
+			d.Notes = append(d.Notes, fmt.Sprintf("... %d more calls", e.Omitted))
+		}
+		note := "at " + entry.Function
+		if entry.Position != nil {
+			note += " (" + formatLocation(entry.File, entry.Position) + ")"
+		}
+		d.Notes = append(d.Notes, note)
+	}
+	return d
+}
+
+func formatLocation(file string, pos *token.Position) string {
+	if file == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, pos.Line, pos.Column)
+}
+
+// newRuntimeError attaches the current source position and call stack to err
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr
+	}
+	runtimeErr = &RuntimeError{Message: err.Error(), Trace: vm.stackTrace(), err: err}
+	if len(runtimeErr.Trace) > 0 {
+		runtimeErr.File = runtimeErr.Trace[0].File
+		runtimeErr.Position = runtimeErr.Trace[0].Position
+	}
+	if n := len(runtimeErr.Trace); n > traceHead+traceTail {
+		runtimeErr.Omitted = n - traceHead - traceTail
+		runtimeErr.Trace = append(runtimeErr.Trace[:traceHead], runtimeErr.Trace[n-traceTail:]...)
+	}
+	return runtimeErr
+}
+
+// a runtime error shows the innermost traceHead and the outermost traceTail calls
+const (
+	traceHead = 10
+	traceTail = 5
+)
+
+// stackOverflow reports a value or call that doesn't fit on the stack anymore, which is
+// usually a recursion without end in the current function
+func (vm *VM) stackOverflow() error {
+	name := "<main>"
+	if vm.framesIndex > 1 {
+		name = vm.currentFrame().cl.Fn.DisplayName()
+	}
+	return fmt.Errorf("stack overflow in %s", name)
+}
+func (vm *VM) stackTrace() []TraceEntry {
+	trace := []TraceEntry{}
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		if frame.host {
+			break
+		}
+		fn := frame.cl.Fn
+		entry := TraceEntry{Function: fn.DisplayName(), File: fn.SourceMap.File}
+		if i == 0 {
+			entry.Function = "<main>"
+		}
+		if pos, ok := fn.SourceMap.Lookup(frame.ip); ok {
+			entry.Position = &pos
+		}
+		trace = append(trace, entry)
+	}
+	return trace
+}
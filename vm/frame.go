@@ -7,10 +7,15 @@ import (
 
 const MaxFrames = 1024
 
+// frameSize estimates the bytes of a frame, its locals live on the stack
+const frameSize = 32
+
 type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+	// the frame of a call from Go, the frames below it belong to whatever ran before
+	host bool
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -23,9 +28,13 @@ func (f *Frame) Instructions() code.Instructions {
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames || f.basePointer+f.cl.Fn.NumLocals >= StackSize {
+		return vm.stackOverflow()
+	}
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	return nil
 }
 func (vm *VM) popFrame() *Frame {
 	vm.framesIndex--
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"kol/object"
 )
@@ -11,9 +12,9 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	if !ok {
 		return fmt.Errorf("not a function: %+v", constant)
 	}
-	free := make([]object.Object, numFree)
+	free := make([]*object.Upvalue, numFree)
 	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+		free[i] = vm.stack[vm.sp-numFree+i].(*object.Upvalue)
 	}
 	vm.sp = vm.sp - numFree
 	closure := &object.Closure{Fn: function, Free: free}
@@ -36,18 +37,67 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
 			cl.Fn.NumParameters, numArgs)
 	}
+	if vm.budget != nil {
+		err := vm.budget.Enter()
+		if err == nil {
+			err = vm.budget.Allocate(frameSize)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	// the slots of the locals still hold values of earlier calls, which aren't the locals' previous values
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	return nil
+}
+
+// executeTailCall calls a closure in the frame of the current call, which returns its result anyway.
+// Other callees are called as usual and the following OpReturnValue returns their result.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return vm.executeCall(numArgs)
+	}
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+	frame := vm.currentFrame()
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return vm.stackOverflow()
+	}
+	// the locals of the current call are done, closures that captured them keep their values
+	vm.closeUpvalues(frame.basePointer)
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	frame.cl = cl
+	frame.ip = -1
 	return nil
 }
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
-	if result != nil && result.Type() == object.ERROR_OBJ {
-		return fmt.Errorf(result.Inspect())
+	result := builtin.Call(vm.io, args...)
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
 	}
 	vm.sp = vm.sp - numArgs - 1
+	if vm.budget != nil {
+		err := vm.budget.Allocate(object.Size(result))
+		if err != nil {
+			return err
+		}
+	}
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -55,3 +105,51 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	}
 	return nil
 }
+
+type openUpvalue struct {
+	slot    int
+	upvalue *object.Upvalue
+}
+
+// captureLocal returns the upvalue of a stack slot, all closures capturing the slot share it
+func (vm *VM) captureLocal(slot int) *object.Upvalue {
+	var upvalue *object.Upvalue
+	vm.openUpvalues, upvalue = capture(vm.openUpvalues, slot, vm.stack)
+	return upvalue
+}
+
+// captureGlobal returns the upvalue of a global declared in a loop body until the iteration ends
+func (vm *VM) captureGlobal(index int) *object.Upvalue {
+	var upvalue *object.Upvalue
+	vm.openGlobalUpvalues, upvalue = capture(vm.openGlobalUpvalues, index, vm.globals)
+	return upvalue
+}
+func capture(open []openUpvalue, slot int, slots []object.Object) ([]openUpvalue, *object.Upvalue) {
+	for _, o := range open {
+		if o.slot == slot {
+			return open, o.upvalue
+		}
+	}
+	upvalue := object.NewUpvalue(&slots[slot])
+	return append(open, openUpvalue{slot: slot, upvalue: upvalue}), upvalue
+}
+
+// closeUpvalues closes the upvalues of the stack slots from the first one on, which belong to the
+// current frame. Its upvalues are the last ones opened but not ordered by their slots.
+func (vm *VM) closeUpvalues(first int) {
+	vm.openUpvalues = closeFrom(vm.openUpvalues, first)
+}
+func (vm *VM) closeGlobalUpvalues(first int) {
+	vm.openGlobalUpvalues = closeFrom(vm.openGlobalUpvalues, first)
+}
+func closeFrom(open []openUpvalue, first int) []openUpvalue {
+	kept := open[:0]
+	for _, o := range open {
+		if o.slot >= first {
+			o.upvalue.Close()
+			continue
+		}
+		kept = append(kept, o)
+	}
+	return kept
+}
@@ -47,6 +47,15 @@ func (vm *VM) executeBinaryNumberOperation(
 		}
 	case code.OpDiv:
 		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		if left.Type() != object.INTEGER_OBJ || right.Type() != object.INTEGER_OBJ {
+			return fmt.Errorf("Can't take the remainder of non-integers")
+		}
+		divisor := right.(*object.Integer).Value
+		if divisor == 0 {
+			return fmt.Errorf("Can't take the remainder of a division by zero")
+		}
+		return vm.push(&object.Integer{Value: left.(*object.Integer).Value % divisor})
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
@@ -81,6 +90,15 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	if object.IsNumber(left) && object.IsNumber(right) {
 		return vm.executeNumberComparison(op, left, right)
 	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		equal := left.(*object.String).Value == right.(*object.String).Value
+		switch op {
+		case code.OpEqual:
+			return vm.push(nativeBoolToBooleanObject(equal))
+		case code.OpNotEqual:
+			return vm.push(nativeBoolToBooleanObject(!equal))
+		}
+	}
 
 	switch op {
 	case code.OpEqual:
@@ -118,6 +136,10 @@ func (vm *VM) executeNumberComparison(
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
 	case code.OpGreaterEqualsThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqualsThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -1,7 +1,6 @@
 package vm
 
 import (
-	"fmt"
 	"kol/object"
 )
 
@@ -16,7 +15,7 @@ func (vm *VM) StackTop() object.Object {
 
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return vm.stackOverflow()
 	}
 
 	vm.stack[vm.sp] = o
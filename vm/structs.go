@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"fmt"
+	"kol/object"
+)
+
+func (vm *VM) buildStruct(startIndex, endIndex int) (object.Object, error) {
+	definition, ok := vm.stack[startIndex-1].(*object.StructDefinition)
+	if !ok {
+		return nil, fmt.Errorf("not a struct: %s", vm.stack[startIndex-1].Type())
+	}
+	values := make(map[string]object.Object)
+	for i := startIndex; i < endIndex; i += 2 {
+		name := vm.stack[i].(*object.String).Value
+		values[name] = vm.stack[i+1]
+	}
+	return definition.Instantiate(values)
+}
+func (vm *VM) buildModule(startIndex, endIndex int) object.Object {
+	name := vm.stack[startIndex-1].(*object.String).Value
+	exports := make(map[string]object.Object)
+	for i := startIndex; i < endIndex; i += 2 {
+		exports[vm.stack[i].(*object.String).Value] = vm.stack[i+1]
+	}
+	return &object.Module{Name: name, Exports: exports}
+}
+func (vm *VM) executeFieldAccess(left object.Object, field string) error {
+	if module, ok := left.(*object.Module); ok {
+		value, ok := module.Exports[field]
+		if !ok {
+			return fmt.Errorf("Module %s has no export %s", module.Name, field)
+		}
+		return vm.push(value)
+	}
+	structObject, ok := left.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("field access not supported: %s", left.Type())
+	}
+	value, ok := structObject.Fields[field]
+	if !ok {
+		return fmt.Errorf("Struct %s has no field %s", structObject.Definition.Name, field)
+	}
+	return vm.push(value)
+}
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"context"
 	"fmt"
 	"kol/code"
 	"kol/compiler"
@@ -9,13 +10,16 @@ import (
 
 const GlobalsSize = 65536
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
+var True = object.True
+var False = object.False
 
 var Void = &object.Void{}
 
 type VM struct {
 	constants []object.Object
+	builtins  []object.BuiltinDefinition
+	// where builtins like println and readln write and read
+	io *object.IO
 
 	stack []object.Object
 	sp    int
@@ -24,10 +28,22 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	// upvalues still pointing to the stack, in the order they were opened
+	openUpvalues []openUpvalue
+	// upvalues still pointing to globals declared in loop bodies
+	openGlobalUpvalues []openUpvalue
+
+	// called before every instruction while a debugger is attached
+	hook Hook
+
+	limits object.Limits
+	// counts the work of the running program, nil while it runs without limits or context
+	budget *object.Budget
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 	frames := make([]*Frame, MaxFrames)
@@ -35,6 +51,8 @@ func New(bytecode *compiler.Bytecode) *VM {
 
 	return &VM{
 		constants: bytecode.Constants,
+		builtins:  object.Builtins,
+		io:        object.StandardIO(),
 
 		stack: make([]object.Object, StackSize),
 		sp:    0,
@@ -51,12 +69,96 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// SetBuiltins replaces the builtins OpGetBuiltin loads, they have to be the ones the bytecode was compiled with
+func (vm *VM) SetBuiltins(builtins []object.BuiltinDefinition) {
+	vm.builtins = builtins
+}
+
+// SetIO replaces the standard streams builtins read from and write to
+func (vm *VM) SetIO(io *object.IO) {
+	vm.io = io
+}
+
+// SetLimits bounds the work of the next runs, exceeding a limit fails with an *object.LimitError
+func (vm *VM) SetLimits(limits object.Limits) {
+	vm.limits = limits
+}
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it ends, exceeds a limit or ctx is done
+func (vm *VM) RunContext(ctx context.Context) error {
+	return vm.execute(ctx)
+}
+
+// Call calls a function of the program from Go with the limits of RunContext and returns its result.
+// The program has usually run before, so the function sees the globals it defined. Builtins may call
+// back into the program while it runs.
+func (vm *VM) Call(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	if len(args) > maxArgs {
+		return nil, fmt.Errorf("can't call a function with %d arguments, at most %d are allowed", len(args), maxArgs)
+	}
+	// the slot at sp holds the last popped value, which stays the result of the program
+	sp, framesIndex, lastPopped := vm.sp, vm.framesIndex, vm.stack[vm.sp]
+	defer func() {
+		vm.closeUpvalues(sp)
+		vm.sp, vm.framesIndex, vm.stack[sp] = sp, framesIndex, lastPopped
+	}()
+	for _, obj := range append([]object.Object{fn}, args...) {
+		if err := vm.push(obj); err != nil {
+			return nil, vm.newRuntimeError(err)
+		}
+	}
+	// the function is called by a frame of its own, which ends the run once the call returns
+	caller := &object.Closure{Fn: &object.CompiledFunction{Instructions: code.Make(code.OpCall, len(args)), Name: "<host>"}}
+	frame := NewFrame(caller, vm.sp)
+	frame.host = true
+	if err := vm.pushFrame(frame); err != nil {
+		return nil, vm.newRuntimeError(err)
+	}
+	if err := vm.execute(ctx); err != nil {
+		return nil, err
+	}
+	return vm.stack[vm.sp-1], nil
+}
+
+// maxArgs is the number of arguments the one byte operand of OpCall can pass
+const maxArgs = 255
+
+func (vm *VM) execute(ctx context.Context) error {
+	// calls made by builtins while the program runs count against the budget of the run
+	if vm.budget == nil && (ctx.Done() != nil || vm.limits != (object.Limits{})) {
+		vm.budget = object.NewBudget(ctx, vm.limits)
+		defer func() { vm.budget = nil }()
+	}
+	err := vm.run()
+	if err == ErrStopped {
+		return err
+	}
+	if err != nil {
+		return vm.newRuntimeError(err)
+	}
+	return nil
+}
+func (vm *VM) run() error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
+		if vm.budget != nil {
+			err := vm.budget.Step()
+			if err != nil {
+				return err
+			}
+		}
+		if vm.hook != nil {
+			err := vm.hook(vm)
+			if err != nil {
+				return err
+			}
+		}
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
@@ -70,7 +172,7 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -85,7 +187,7 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqualsThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqualsThan, code.OpLessThan, code.OpLessEqualsThan:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -103,17 +205,20 @@ func (vm *VM) Run() error {
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			definition := object.Builtins[builtinIndex]
+			if int(builtinIndex) >= len(vm.builtins) {
+				return fmt.Errorf("unknown builtin %d, the program was compiled with other builtins", builtinIndex)
+			}
+			definition := vm.builtins[builtinIndex]
 			err := vm.push(definition.Builtin)
 			if err != nil {
 				return err
 			}
-		case code.OpSetGlobal:
+		case code.OpSetGlobal, code.OpDefineGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
 			newVal := vm.pop()
-			if vm.globals[globalIndex] != nil && newVal.Type() != vm.globals[globalIndex].Type() {
+			if op == code.OpSetGlobal && vm.globals[globalIndex] != nil && newVal.Type() != vm.globals[globalIndex].Type() {
 				return fmt.Errorf("Type Error: Can't convert %s to %s", vm.globals[globalIndex].Type(), newVal.Type())
 			}
 			vm.globals[globalIndex] = newVal
@@ -124,14 +229,14 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpSetLocal:
+		case code.OpSetLocal, code.OpDefineLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
 
 			pos := frame.basePointer + int(localIndex)
 			newVal := vm.pop()
-			if vm.stack[pos] != nil && newVal.Type() != vm.stack[pos].Type() {
+			if op == code.OpSetLocal && vm.stack[pos] != nil && newVal.Type() != vm.stack[pos].Type() {
 				return fmt.Errorf("Type Error: Can't convert %s to %s", vm.stack[pos].Type(), newVal.Type())
 			}
 			vm.stack[pos] = newVal
@@ -146,18 +251,48 @@ func (vm *VM) Run() error {
 		case code.OpSetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			currentClosure := vm.currentFrame().cl
+			upvalue := vm.currentFrame().cl.Free[freeIndex]
 
 			newVal := vm.pop()
-			if currentClosure.Free[freeIndex] != nil && newVal.Type() != currentClosure.Free[freeIndex].Type() {
-				return fmt.Errorf("Type Error: Can't convert %s to %s", currentClosure.Free[freeIndex].Type(), newVal.Type())
+			if upvalue.Get() != nil && newVal.Type() != upvalue.Get().Type() {
+				return fmt.Errorf("Type Error: Can't convert %s to %s", upvalue.Get().Type(), newVal.Type())
 			}
-			currentClosure.Free[freeIndex] = newVal
+			upvalue.Set(newVal)
 		case code.OpGetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			err := vm.push(currentClosure.Free[freeIndex].Get())
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			upvalue := vm.captureLocal(vm.currentFrame().basePointer + int(localIndex))
+			err := vm.push(upvalue)
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err := vm.push(vm.captureGlobal(int(globalIndex)))
+			if err != nil {
+				return err
+			}
+		case code.OpCloseUpvalues:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.closeUpvalues(vm.currentFrame().basePointer + int(localIndex))
+		case code.OpCloseGlobalUpvalues:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.closeGlobalUpvalues(int(globalIndex))
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex])
 			if err != nil {
 				return err
 			}
@@ -168,9 +303,6 @@ func (vm *VM) Run() error {
 			}
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			if vm.currentFrame().ip > pos {
-				vm.pop()
-			}
 			vm.currentFrame().ip = pos - 1
 		case code.OpJumpNotTrue:
 			pos := int(code.ReadUint16(ins[ip+1:]))
@@ -182,6 +314,11 @@ func (vm *VM) Run() error {
 			if !isTrue(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpAssertBoolean:
+			condition := vm.StackTop()
+			if condition.Type() != object.BOOLEAN_OBJ {
+				return fmt.Errorf("%s is not of type BOOLEAN and can't be used as a condition", condition.Type())
+			}
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -203,6 +340,36 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpStruct:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			structObject, err := vm.buildStruct(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements - 1
+			err = vm.push(structObject)
+			if err != nil {
+				return err
+			}
+		case code.OpModule:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			module := vm.buildModule(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements - 1
+			err := vm.push(module)
+			if err != nil {
+				return err
+			}
+		case code.OpGetField:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			left := vm.pop()
+			field := vm.constants[constIndex].(*object.String).Value
+			err := vm.executeFieldAccess(left, field)
+			if err != nil {
+				return err
+			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -218,9 +385,21 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil {
+				return err
+			}
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 			frame := vm.popFrame()
+			if vm.budget != nil {
+				vm.budget.Leave()
+			}
+			vm.closeUpvalues(frame.basePointer)
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(returnValue)
@@ -229,6 +408,10 @@ func (vm *VM) Run() error {
 			}
 		case code.OpReturn:
 			frame := vm.popFrame()
+			if vm.budget != nil {
+				vm.budget.Leave()
+			}
+			vm.closeUpvalues(frame.basePointer)
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(Void)
@@ -247,6 +430,13 @@ func (vm *VM) Run() error {
 		case code.OpPop:
 			vm.pop()
 		}
+		// calls charge their frames and the results of builtins themselves
+		if vm.budget != nil && code.Allocates(op) && op != code.OpCall && op != code.OpTailCall {
+			err := vm.budget.Allocate(object.Size(vm.StackTop()))
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -1,13 +1,19 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"kol/ast"
 	"kol/compiler"
 	"kol/lexer"
+	"kol/module"
 	"kol/object"
 	"kol/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 type vmTestCase struct {
@@ -39,6 +45,11 @@ func TestNumberArithmetic(t *testing.T) {
 		{"-10.4", -10.4},
 		{"-50 + 100 + -50.5", -0.5},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50.0},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"1 + 10 % 4 * 2", 5},
+		{"7 % 0", &object.Error{Message: "Can't take the remainder of a division by zero"}},
+		{"7.5 % 2", &object.Error{Message: "Can't take the remainder of non-integers"}},
 	}
 	runVmTests(t, tests)
 }
@@ -74,6 +85,39 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!false", true},
 		{"!!true", true},
 		{"!!false", false},
+		{"let mut xs = []; let f = fun(x int) int { xs = push(xs, x); x }; f(1) < f(2); f(3) <= f(4); xs", []int{1, 2, 3, 4}},
+	}
+	runVmTests(t, tests)
+}
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"false && true || true", true},
+		{"false && 1", false},
+		{"true || 1", true},
+		{"if (1 > 2 || 2 > 1) { 10 } else { 20 }", 10},
+		{"let mut n = 0; fun inc() bool { n += 1; return true } false && inc(); true || inc(); n", 0},
+		{"true && 1", &object.Error{Message: "INTEGER is not of type BOOLEAN and can't be used as a condition"}},
+	}
+	runVmTests(t, tests)
+}
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let mut i = 0; for i < 3 { i += 1 }; i", 3},
+		{"let mut i = 0; for true { i += 1; if i == 5 { break i * 2 } }", 10},
+		{"let mut i = 0; for i < 3 { i += 1 } else { 42 }", 42},
+		{"let mut i = 0; for true { i += 1; if i == 5 { break; } }; i", 5},
+		{"let mut i = 0; let mut sum = 0; for i < 10 { i += 1; if i == 2 || i == 4 || i == 6 || i == 8 || i == 10 { continue; } sum += i }; sum", 25},
+		{"let mut i = 0; let mut n = 0; let mut j = 0; for i < 3 { i += 1; j = 0; for true { j += 1; if j == 4 { break; } n += 1 } }; n", 9},
+		{"let f = fun() int { let mut i = 0; for true { i += 1; if i == 7 { return i } } }; f()", 7},
+		{"fun f() int { let mut i = 0; for true { i += 1; if i == 3 { break } } i } f()", 3},
+		{`let mut i = 0; let mut n = 0; for i < 2 { let v = if i == 0 { 1 } else { "s" }; n += len(str(v)); i += 1 }; n`, 2},
+		{`fun f() int { let mut i = 0; for i < 2 { let v = if i == 0 { [1] } else { 2 }; i += 1 }; i } f()`, 2},
+		{`let mut a = 1; let b = if true { "s" } else { 1 }; a = b`, &object.Error{Message: "Type Error: Can't convert INTEGER to STRING"}},
 	}
 	runVmTests(t, tests)
 }
@@ -98,6 +142,9 @@ func TestGlobalLetStatements(t *testing.T) {
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
 		{"let mut one = 1; let two = one * 2; one = two + one; one", 3},
+		{"let a = true; let b = if (a) { let x = 1; x } else { let x = 2; x }; let x = b + 1; x", 2},
+		{"let f = fun(a bool) int { let x = 5; if (a) { let x = 3; x } else { x } }; f(true) * 10 + f(false)", 35},
+		{"let mut sum = 0; for (sum < 6) { let x = 1; if (true) { let x = 2; sum += x }; sum += x }; sum", 6},
 	}
 	runVmTests(t, tests)
 }
@@ -106,6 +153,9 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"mon" + "key" != "monkey"`, false},
+		{`"a" != "b"`, true},
 	}
 	runVmTests(t, tests)
 }
@@ -143,9 +193,9 @@ func TestIndexExpressions(t *testing.T) {
 		{"[1, 2, 3][1]", 2},
 		{"[1, 2, 3][0 + 2]", 3},
 		{"[[1, 1, 1]][0][0]", 1},
-		{"[][0]", Void},
-		{"[1, 2, 3][99]", Void},
-		{"[1][-1]", Void},
+		{"[][0]", &object.Error{Message: "Index 0 out of bounds for array of size 0"}},
+		{"[1, 2, 3][99]", &object.Error{Message: "Index 99 out of bounds for array of size 3"}},
+		{"[1][-1]", &object.Error{Message: "Index -1 out of bounds for array of size 1"}},
 		{"{\"1\": 1, \"2\": 2}[\"1\"]", 1},
 		{"{\"1\": 1, \"2\": 2}[\"2\"]", 2},
 		{"{\"1\": 1}[\"0\"]", Void},
@@ -291,6 +341,13 @@ minusOne() + minusTwo();
 `,
 			expected: 97,
 		},
+		{
+			input: `
+let count = fun() int { let mut n = len([1, 2]); n };
+len("a" + str(1)) + count();
+`,
+			expected: 4,
+		},
 	}
 	runVmTests(t, tests)
 }
@@ -387,7 +444,7 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 		if err == nil {
 			t.Fatalf("expected VM error but resulted in none.")
 		}
-		if err.Error() != tt.expected {
+		if err.(*RuntimeError).Message != tt.expected {
 			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
 		}
 	}
@@ -400,12 +457,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{
 			`len(1)`,
 			&object.Error{
-				Message: "ERROR: argument to `len` not supported, got INTEGER",
+				Message: "argument to `len` not supported, got INTEGER",
 			},
 		},
 		{`len("one", "two")`,
 			&object.Error{
-				Message: "ERROR: wrong number of arguments. got=2, want=1",
+				Message: "wrong number of arguments. got=2, want=1",
 			},
 		},
 		{`len([1, 2, 3])`, 3},
@@ -413,8 +470,161 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`println("hello", "world!")`, Void},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, &object.Error{
-			Message: "ERROR: argument to `push` must be ARRAY, got INTEGER",
+			Message: "argument to `push` must be ARRAY, got INTEGER",
+		},
+		},
+		{`assert(1 < 2)`, Void},
+		{`assert(1 > 2)`, &object.Error{Message: "assertion failed"}},
+		{`assert_eq(push([1], 2), [1, 2])`, Void},
+		{`assert_eq([1, 2], [1, 3])`, &object.Error{
+			Message: "values aren't equal\n  expected: [1, 3]\n    actual: [1, 2]\n                ^",
+		},
+		},
+		{`assert_eq({"b": 1, "a": 2, "d": 3, "c": 4}, {"c": 4, "d": 3, "a": 2, "b": 1})`, Void},
+		{`assert_eq({"c": 3, "a": 1, "b": 2}, {"a": 1, "b": 5, "c": 3})`, &object.Error{
+			Message: "values aren't equal\n  expected: {a: 1, b: 5, c: 3}\n    actual: {a: 1, b: 2, c: 3}\n                      ^",
+		},
+		},
+		{`assert_eq(1, 1.0)`, &object.Error{
+			Message: "values aren't equal\n  expected: 1 (FLOAT)\n    actual: 1 (INTEGER)",
+		},
+		},
+		{`fail("not yet")`, &object.Error{Message: "not yet"}},
+		{`let len = fun(x int) int { x * 2 }; len(3)`, 6},
+	}
+	runVmTests(t, tests)
+}
+func TestClosuresShareVariables(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let counter = fun() int {
+	let mut count = 0
+	let inc = fun() int { count += 1; count }
+	inc()
+	inc()
+	count
+}
+counter()
+`,
+			expected: 2,
+		},
+		{
+			input: `
+let pair = fun() array {
+	let mut value = 0
+	let set = fun(v int) { value = v }
+	let get = fun() int { value };
+	[set, get]
+}
+let p = pair()
+p[0](5)
+p[1]()
+`,
+			expected: 5,
+		},
+		{
+			input: `
+let outer = fun() int {
+	let mut n = 1
+	let middle = fun() fn {
+		fun() int { n += 10; n }
+	}
+	let inner = middle()
+	inner()
+	n += 100
+	inner()
+}
+outer()
+`,
+			expected: 121,
+		},
+		{
+			input: `
+let make = fun() fn {
+	let mut total = 0
+	let add = fun(x int) int { total += x; total }
+	add
+}
+let a = make()
+let b = make()
+a(1)
+a(2)
+b(10)
+a(3)
+`,
+			expected: 6,
+		},
+		{
+			input: `
+let run = fun() int {
+	let fib = fun(n int) int { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }
+	fib(10)
+}
+run()
+`,
+			expected: 55,
+		},
+	}
+	runVmTests(t, tests)
+}
+func TestClosuresInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+let mut fns = [];
+let mut i = 0;
+for i < 3 { let j = i; fns = push(fns, fun() int { return j; }); i = i + 1 };
+[fns[0](), fns[1](), fns[2]()]
+`,
+			expected: []int{0, 1, 2},
 		},
+		{
+			input: `
+let run = fun() array {
+	let mut fns = [];
+	let mut i = 0;
+	for i < 3 { let j = i; fns = push(fns, fun() int { j }); i = i + 1 };
+	[fns[0](), fns[1](), fns[2]()]
+}
+run()
+`,
+			expected: []int{0, 1, 2},
+		},
+		{
+			// the closures of an iteration share its variables, continue and break end the iteration too
+			input: `
+let run = fun() array {
+	let mut fns = [];
+	let mut i = 0;
+	for i < 5 {
+		i += 1;
+		let mut j = i;
+		let inc = fun() int { j += 10; j };
+		inc();
+		fns = push(fns, fun() int { j });
+		if i == 2 { continue; }
+		if i == 3 { break; }
+	};
+	[fns[0](), fns[1](), fns[2]()]
+}
+run()
+`,
+			expected: []int{11, 12, 13},
+		},
+		{
+			input: `
+let mut fns = [];
+let mut i = 0;
+for i < 2 {
+	i += 1;
+	let a = i;
+	let mut k = 0;
+	for k < 2 { k += 1; let b = k; fns = push(fns, fun() int { a * 10 + b }) };
+};
+[fns[0](), fns[1](), fns[2](), fns[3]()]
+`,
+			expected: []int{11, 12, 21, 22},
 		},
 	}
 	runVmTests(t, tests)
@@ -495,6 +705,153 @@ closure();
 	}
 	runVmTests(t, tests)
 }
+func TestRuntimeErrorPositions(t *testing.T) {
+	input := `let add = fun(a int, b bool) int {
+    a + b
+};
+let outer = fun() int { add(1, true) + 0 };
+outer();`
+	program := parse(input)
+	comp := compiler.New()
+	comp.SetFileName("test.kol")
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError. got=%T (%+v)", err, err)
+	}
+	if runtimeErr.Message != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Message)
+	}
+	expectedTrace := []struct {
+		function string
+		line     int
+		column   int
+	}{
+		{"add", 2, 7},
+		{"outer", 4, 28},
+		{"<main>", 5, 6},
+	}
+	if len(runtimeErr.Trace) != len(expectedTrace) {
+		t.Fatalf("wrong trace length. want=%d, got=%d (%+v)", len(expectedTrace), len(runtimeErr.Trace), runtimeErr.Trace)
+	}
+	for i, expected := range expectedTrace {
+		entry := runtimeErr.Trace[i]
+		if entry.Function != expected.function || entry.File != "test.kol" {
+			t.Errorf("wrong trace entry %d. got=%+v", i, entry)
+		}
+		if entry.Position == nil || entry.Position.Line != expected.line || entry.Position.Column != expected.column {
+			t.Errorf("wrong position for trace entry %d. want=%d:%d, got=%+v", i, expected.line, expected.column, entry.Position)
+		}
+	}
+	expected := `Error at test.kol:2:7: unsupported types for binary operation: INTEGER BOOLEAN
+	at add (test.kol:2:7)
+	at outer (test.kol:4:28)
+	at <main> (test.kol:5:6)`
+	if err.Error() != expected {
+		t.Errorf("wrong error string.\nwant=%q\ngot =%q", expected, err.Error())
+	}
+}
+
+var testModules = map[string]string{
+	"lib/math.kol": `
+let offset = 1
+export let base = 10
+export fun inc(x int) int { x + offset }
+export struct Point { x int }
+export fun origin() Point { Point{x: 0} }
+export fun x(p Point) int { p.x }
+`,
+	"lib/shapes.kol": `
+import "math"
+export fun area(w int, h int) int { math.inc(w * h) }
+`,
+	"cycle_a.kol":   `import "cycle_b"`,
+	"cycle_b.kol":   `import "cycle_a"`,
+	"failing.kol":   `let x = 1 + true`,
+	"returning.kol": `return 1`,
+	"counter.kol":   `export let mut count = 0; count = count + 1`,
+	"lib/tally.kol": `import "../counter"; export let count = counter.count`,
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib/math"; math.inc(math.base)`, 11},
+		{`import "lib/math.kol"; math.origin().x`, 0},
+		{`import "lib/shapes"; shapes.area(2, 3)`, 7},
+		{`import "lib/math"; let base = 3; base + math.base`, 13},
+		{`import "lib/tally"; import "counter"; counter.count + tally.count`, 2},
+		{`import "lib/math"; math.Point{x: 3}.x`, 3},
+		{`import "lib/math"; fun f(p math.Point) math.Point { p }; math.x(f(math.Point{x: 4}))`, 4},
+		{`import "lib/math"; struct Line { from math.Point }; Line{from: math.origin()}.from.x`, 0},
+		{`import "lib/math"; struct Point { x int }; let mut p = math.origin(); p = Point{x: 1}`, "Error at main.kol:1:71: Type Error: Can't convert math.Point to Point\n\tat <main> (main.kol:1:71)"},
+		{`import "lib/math"; struct Point { x int }; struct Line { from math.Point }; Line{from: Point{x: 1}}`, "Error at main.kol:1:77: Field from not valid: Expected math.Point but got Point\n\tat <main> (main.kol:1:77)"},
+		{`import "lib/math"; math.offset`, "Error at main.kol:1:24: Module math has no export offset\n\tat <main> (main.kol:1:24)"},
+		{`import "failing"`, "Error at failing.kol:1:11: unsupported types for binary operation: INTEGER BOOLEAN\n\tat <module failing> (failing.kol:1:11)\n\tat <main> (main.kol:1:1)"},
+		{`import "lib/math"; import "lib/math"`, "Error at main.kol:1:20: Variable math is already defined"},
+		{`import "missing"`, "Error at main.kol:1:1: can't import missing.kol: file does not exist"},
+		{`import "cycle_a"`, "Error at cycle_b.kol:1:1: import cycle detected: cycle_a.kol -> cycle_b.kol -> cycle_a.kol"},
+		{`import "returning"`, "Error at returning.kol:1:1: return outside of a function"},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		comp.SetFileName("main.kol")
+		loader := module.NewLoader()
+		loader.ReadFile = func(name string) ([]byte, error) {
+			content, ok := testModules[name]
+			if !ok {
+				return nil, fmt.Errorf("file does not exist")
+			}
+			return []byte(content), nil
+		}
+		comp.SetLoader(loader)
+		err := comp.Compile(parse(tt.input))
+		if err == nil {
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err == nil {
+				testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+				continue
+			}
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+func TestRunDecodedBytecode(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+struct Point { x int }
+let sum = fun(p Point, b int) int { p.x + b };
+sum(Point{x: 40}, 2);
+`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	err = comp.Bytecode().Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	bytecode, err := compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	vm := New(bytecode)
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 42, vm.LastPoppedStackElem())
+}
 func TestRecursiveFibonacci(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -517,6 +874,23 @@ fibonacci(15);
 	}
 	runVmTests(t, tests)
 }
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x int, y int }; let p = Point{x: 1, y: 2}; p.x + p.y", 3},
+		{"struct Point { x int, y int }; Point{y: 2, x: 1}.y", 2},
+		{"struct Point { x int }; struct Line { from Point }; Line{from: Point{x: 4}}.from.x", 4},
+		{"struct Point { x int }; fun getX(p Point) int { p.x } getX(Point{x: 7})", 7},
+		{"fun make() int { struct Point { x int }; Point{x: 3}.x } make()", 3},
+		{"struct Op { apply fn }; let base = 10; let op = Op{apply: fun(x int) int { x + base }}; op.apply(5)", 15},
+		{"struct Op { apply fn }; Op{apply: len}.apply([1, 2])", 2},
+		{"struct Op { apply fn }; Op{apply: 1}", &object.Error{Message: "Field apply not valid: Expected FUNCTION but got INTEGER"}},
+		{"struct Point { x int, y int }; Point{x: 1, y: true}", &object.Error{Message: "Field y not valid: Expected INTEGER but got BOOLEAN"}},
+		{"struct Point { x int, y int }; Point{x: 1}", &object.Error{Message: "Missing field y for struct Point"}},
+		{"struct Point { x int }; Point{x: 1}.y", &object.Error{Message: "Struct Point has no field y"}},
+		{"let a = 1; a.x", &object.Error{Message: "field access not supported: INTEGER"}},
+	}
+	runVmTests(t, tests)
+}
 
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
@@ -535,8 +909,8 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		err = vm.Run()
 		if err != nil {
 			if _, ok := tt.expected.(*object.Error); ok {
-				testExpectedObject(t, tt.expected, &object.Error{Message: err.Error()})
-				return
+				testExpectedObject(t, tt.expected, &object.Error{Message: err.(*RuntimeError).Message})
+				continue
 			} else {
 				t.Fatalf("vm error: %s", err)
 			}
@@ -665,3 +1039,319 @@ func testStringObject(expected string, actual object.Object) error {
 	}
 	return nil
 }
+func TestHook(t *testing.T) {
+	input := `let add = fun(a int, b int) int { let sum = a + b; sum };
+let x = add(1, 2);
+x`
+	comp := compiler.New()
+	comp.SetFileName("test.kol")
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	var locals []Variable
+	vm.SetHook(func(vm *VM) error {
+		_, pos, _ := vm.Position()
+		// the sum returned by add, all of its locals are set by then
+		if vm.Depth() == 2 && pos.Column == 52 {
+			locals = vm.Locals(0)
+			return ErrStopped
+		}
+		return nil
+	})
+	err = vm.Run()
+	if err != ErrStopped {
+		t.Fatalf("expected the hook to stop the program. got=%v", err)
+	}
+	expected := []string{"a = 1", "b = 2", "sum = 3"}
+	if len(locals) != len(expected) {
+		t.Fatalf("wrong number of locals. want=%d, got=%+v", len(expected), locals)
+	}
+	for i, v := range locals {
+		if actual := v.Name + " = " + v.Value.Inspect(); actual != expected[i] {
+			t.Errorf("wrong local %d. want=%q, got=%q", i, expected[i], actual)
+		}
+	}
+	if trace := vm.CallStack(); len(trace) != 2 || trace[0].Function != "add" {
+		t.Errorf("wrong call stack. got=%+v", trace)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected object.Limit
+	}{
+		{"let mut i = 0; for true { i += 1 }", object.Limits{MaxInstructions: 1000}, object.InstructionLimit},
+		{"let f = fun(x int) int { f(x + 1) + 1 }; f(0)", object.Limits{MaxCallDepth: 100}, object.CallDepthLimit},
+		{"let mut a = []; for true { a = push(a, 1) }", object.Limits{MaxAllocation: 10000}, object.AllocationLimit},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		err = vm.Run()
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != tt.expected {
+			t.Errorf("expected limit %d to be exceeded by %q. got=%v", tt.expected, tt.input, err)
+			continue
+		}
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Position == nil {
+			t.Errorf("expected the error to have a position. got=%#v", err)
+		}
+	}
+
+	// programs within their limits run as usual
+	comp := compiler.New()
+	comp.Compile(parse("let f = fun(x int) int { if (x == 0) { 0 } else { f(x - 1) } }; f(10)"))
+	vm := New(comp.Bytecode())
+	vm.SetLimits(object.Limits{MaxInstructions: 1000, MaxCallDepth: 11, MaxAllocation: 10000})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := testIntegerObject(0, vm.LastPoppedStackElem()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	comp := compiler.New()
+	comp.Compile(parse("for true { }"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the loop. got=%v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelling to stop the loop. got=%v", err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		function string
+	}{
+		// runs out of stack slots first
+		{"let f = fun(x int) int { let y = x; f(y + 1) + 1 }; f(0)", "f"},
+		// runs out of frames first
+		{"let g = fun() int { g() + 1 }; g()", "g"},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = New(comp.Bytecode()).Run()
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("expected *RuntimeError. got=%T (%+v)", err, err)
+		}
+		if runtimeErr.Message != "stack overflow in "+tt.function {
+			t.Errorf("wrong error message. got=%q", runtimeErr.Message)
+		}
+		if len(runtimeErr.Trace) != traceHead+traceTail || runtimeErr.Omitted == 0 {
+			t.Fatalf("expected a truncated trace. got %d entries, %d omitted", len(runtimeErr.Trace), runtimeErr.Omitted)
+		}
+		if runtimeErr.Trace[0].Function != tt.function || runtimeErr.Trace[len(runtimeErr.Trace)-1].Function != "<main>" {
+			t.Errorf("wrong trace %+v", runtimeErr.Trace)
+		}
+		if !strings.Contains(err.Error(), fmt.Sprintf("\n\t... %d more calls\n", runtimeErr.Omitted)) {
+			t.Errorf("expected the omitted calls in the message. got=%q", err.Error())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{"let countdown = fun(n int) int { if (n == 0) { return 0 }; countdown(n - 1) }; countdown(1000000)", 0},
+		{"let sum = fun(n int, acc int) int { if (n == 0) { acc } else { return sum(n - 1, acc + n) } }; sum(1000000, 0)", 500000500000},
+		{`let done = fun(n int) int { n * 2 };
+let loop = fun(n int) int { if (n == 0) { return done(21) }; loop(n - 1) };
+loop(1000000)`, 42},
+		// closures keep the values of the frame a tail call reused
+		{`let f = fun(n int, g fn) int { if (n == 0) { return g() }; let h = fun() int { n }; f(n - 1, h) };
+f(3, fun() int { 100 })`, 1},
+		{"let length = fun(s str) int { len(s) }; length(\"ab\")", 2},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		depth := 0
+		vm.SetHook(func(vm *VM) error {
+			depth = max(depth, vm.Depth())
+			return nil
+		})
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+		if depth > 3 {
+			t.Errorf("expected tail calls to run in constant frame space, got a depth of %d for %q", depth, tt.input)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	input := `let mut count = 0;
+let add = fun(a int, b int) int { count = count + 1; a + b };
+let fail = fun() int { -"a" };
+let deep = fun(n int) int { deep(n + 1) + 1 };
+let spin = fun() { for true { } };
+"done"`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	global := func(name string) object.Object {
+		symbol, ok := comp.SymbolTable().Resolve(name)
+		if !ok {
+			t.Fatalf("%s isn't defined", name)
+		}
+		return machine.Global(symbol.Index)
+	}
+	sp := machine.sp
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := machine.Call(ctx, global("add"), &object.Integer{Value: 1}, &object.Integer{Value: 2})
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if err := testIntegerObject(3, result); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := testIntegerObject(2, global("count")); err != nil {
+		t.Errorf("expected the calls to update the global: %s", err)
+	}
+	result, err := machine.Call(ctx, object.GetBuiltinByName("len"), &object.String{Value: "abc"})
+	if err != nil || testIntegerObject(3, result) != nil {
+		t.Errorf("expected builtins to be callable, got %v, %v", result, err)
+	}
+
+	_, err = machine.Call(ctx, global("fail"))
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok || len(runtimeErr.Trace) != 1 || runtimeErr.Trace[0].Function != "fail" {
+		t.Errorf("expected an error with a trace of the call only, got %v", err)
+	}
+	_, err = machine.Call(ctx, global("deep"), &object.Integer{Value: 0})
+	if err == nil || !strings.HasPrefix(err.Error(), "Error at 4:33: stack overflow in deep") {
+		t.Errorf("expected a stack overflow, got %v", err)
+	}
+	_, err = machine.Call(ctx, global("add"), &object.Integer{Value: 1})
+	if err == nil || err.Error() != "Error: wrong number of arguments: want=2, got=1" {
+		t.Errorf("expected the arguments to be counted, got %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = machine.Call(cancelled, global("spin")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelling to stop the call, got %v", err)
+	}
+
+	if machine.sp != sp || machine.framesIndex != 1 || len(machine.openUpvalues) != 0 {
+		t.Errorf("expected the calls to leave the VM as they found it")
+	}
+	if machine.LastPoppedStackElem().Inspect() != "done" {
+		t.Errorf("expected the result of the program to stay, got %s", machine.LastPoppedStackElem().Inspect())
+	}
+}
+
+func TestCallFromBuiltin(t *testing.T) {
+	var machine *VM
+	apply := &object.Builtin{Fn: func(std *object.IO, args ...object.Object) object.Object {
+		result, err := machine.Call(context.Background(), args[0], args[1:]...)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}}
+	builtins := []object.BuiltinDefinition{{Name: "apply", Builtin: apply}}
+	comp := compiler.NewWithBuiltins(builtins)
+	if err := comp.Compile(parse("let base = 1; apply(fun(x int) int { x * 2 + base }, 20) + 1")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine = New(comp.Bytecode())
+	machine.SetBuiltins(builtins)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(42, machine.LastPoppedStackElem()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIO(t *testing.T) {
+	comp := compiler.New()
+	comp.Compile(parse(`let name = readln(); println("hello %s", name); eprintln("%s lines left", 1); readln() + readln()`))
+	var stdout, stderr bytes.Buffer
+	machine := New(comp.Bytecode())
+	machine.SetIO(&object.IO{In: strings.NewReader("kol\r\na\nb"), Out: &stdout, Err: &stderr})
+	if err := machine.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := testStringObject("ab", machine.LastPoppedStackElem()); err != nil {
+		t.Error(err)
+	}
+	if stdout.String() != "hello kol\n" || stderr.String() != "1 lines left\n" {
+		t.Errorf("wrong output %q and %q", stdout.String(), stderr.String())
+	}
+
+	comp = compiler.New()
+	comp.Compile(parse("readln()"))
+	machine = New(comp.Bytecode())
+	machine.SetIO(&object.IO{In: strings.NewReader("")})
+	var runtimeErr *RuntimeError
+	if err := machine.Run(); !errors.As(err, &runtimeErr) || runtimeErr.Message != "no more input to read" {
+		t.Errorf("expected the end of the input to fail, got %v", err)
+	}
+}
+
+func TestConcurrentOutput(t *testing.T) {
+	comp := compiler.New()
+	comp.Compile(parse(`let id = readln(); let mut i = 0; for i < 100 { println("%s", id); i += 1 }`))
+	bytecode := comp.Bytecode()
+	outputs := make([]bytes.Buffer, 8)
+	errs := make(chan error, len(outputs))
+	for i := range outputs {
+		go func(i int) {
+			machine := New(bytecode)
+			machine.SetIO(&object.IO{In: strings.NewReader(fmt.Sprint(i)), Out: &outputs[i]})
+			errs <- machine.Run()
+		}(i)
+	}
+	for range outputs {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, output := range outputs {
+		if expected := strings.Repeat(fmt.Sprintf("%d\n", i), 100); output.String() != expected {
+			t.Errorf("run %d printed %q", i, output.String())
+		}
+	}
+}